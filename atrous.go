@@ -1,7 +1,7 @@
 // À trous wavelet
 package goimagefreq
 
-import "sync"
+import "context"
 
 // Base B3-spline kernel used in à trous wavelets
 var atrousKernel = []float64{1.0 / 16, 4.0 / 16, 6.0 / 16, 4.0 / 16, 1.0 / 16}
@@ -30,96 +30,155 @@ func AtrousDilateKernel(w int) []float64 {
 	return out
 }
 
-// AtrousWavelet performs an undecimated wavelet transform.
+// Transform is a redundant multiscale decomposition into
+// detail layers (fine → coarse) and a residual that sum back
+// to src, such as AtrousWaveletPlaneCtx, SWTDecomposePlaneCtx,
+// MMTPlaneCtx, MedianWaveletTransform or MultiBandTransform.
+// It reports one progress step per level.
+type Transform func(ctx context.Context, src *Plane, levels int, edge Edge, progress ProgressFunc) (details []*Plane, residual *Plane, err error)
+
+// AtrousWaveletPlane performs an undecimated wavelet transform.
 //
 // Returns:
 //
 //	details[level] = band-pass layer
 //	residual       = final smooth image
-func AtrousWavelet(src [][]float32, levels int) (details [][][]float32, residual [][]float32) {
+//
+// Samples outside the image are read according to edge.
+func AtrousWaveletPlane(src *Plane, levels int, edge Edge) (details []*Plane, residual *Plane) {
+	details, residual, err := AtrousWaveletPlaneCtx(context.Background(), src, levels, edge, nil)
+	panicOnError(err)
+	return details, residual
+}
+
+// AtrousWaveletPlaneCtx is AtrousWaveletPlane with
+// cancellation. It reports one progress step per level.
+func AtrousWaveletPlaneCtx(ctx context.Context, src *Plane, levels int, edge Edge, progress ProgressFunc) (details []*Plane, residual *Plane, err error) {
+	if err := validateTransform(src, levels, edge); err != nil {
+		return nil, nil, err
+	}
+
 	current := src
 	for level := 0; level < levels; level++ {
 		k := AtrousDilateKernel(level)
-		tmp := Convolve1D(current, k, true)
-		smooth := Convolve1D(tmp, k, false)
+		tmp, err := convolve1D(ctx, current, k, true, edge)
+		if err != nil {
+			return nil, nil, err
+		}
+		smooth, err := convolve1D(ctx, tmp, k, false, edge)
+		if err != nil {
+			return nil, nil, err
+		}
 
 		// detail = current - smooth
-		h := len(src)
-		w := len(src[0])
-		detail := make([][]float32, h)
+		h := src.H
+		w := src.W
+		detail := NewPlane(w, h)
 		for y := 0; y < h; y++ {
-			detail[y] = make([]float32, w)
+			cur, sm, d := current.Row(y), smooth.Row(y), detail.Row(y)
 			for x := 0; x < w; x++ {
-				detail[y][x] = current[y][x] - smooth[y][x]
+				d[x] = cur[x] - sm[x]
 			}
 		}
 		details = append(details, detail)
 		current = smooth
+		progress.report(level+1, levels)
 	}
 	residual = current
-	return
+	return details, residual, nil
+}
+
+// AtrousWavelet is the [][]float32 adapter for AtrousWaveletPlane
+// (clamp-to-edge).
+func AtrousWavelet(src [][]float32, levels int) (details [][][]float32, residual [][]float32) {
+	d, r := AtrousWaveletPlane(PlaneFromRows(src), levels, Edge{})
+	return planesToRows(d), r.Rows()
 }
 
-// AtrousReconstruct reconstructs the image
+// AtrousReconstructPlane reconstructs the image
 // by summing residual + all detail layers.
-func AtrousReconstruct(details [][][]float32, residual [][]float32) [][]float32 {
-	h := len(residual)
-	w := len(residual[0])
-	out := make([][]float32, h)
-	for y := range out {
-		out[y] = make([]float32, w)
-		for x := 0; x < w; x++ {
-			out[y][x] = residual[y][x]
-		}
-	}
+func AtrousReconstructPlane(details []*Plane, residual *Plane) *Plane {
+	h := residual.H
+	w := residual.W
+	out := residual.Clone()
 
 	for _, d := range details {
 		for y := 0; y < h; y++ {
+			o, dr := out.Row(y), d.Row(y)
 			for x := 0; x < w; x++ {
-				out[y][x] += d[y][x]
+				o[x] += dr[x]
 			}
 		}
 	}
 	return out
 }
 
+// AtrousReconstruct is the [][]float32 adapter for AtrousReconstructPlane.
+func AtrousReconstruct(details [][][]float32, residual [][]float32) [][]float32 {
+	return AtrousReconstructPlane(planesFromRows(details), PlaneFromRows(residual)).Rows()
+}
+
 // AtrousWaveletRGB runs AtrousWavelet on each channel and returns details as
 // slices [levels][h][w] for each channel plus residuals.
 func AtrousWaveletRGB(r, g, b [][]float32, levels int) (rDetails, gDetails, bDetails [][][]float32, rResid, gResid, bResid [][]float32) {
-	var wg sync.WaitGroup
-	wg.Add(3)
-
-	go func() {
-		defer wg.Done()
-		rDetails, rResid = AtrousWavelet(r, levels)
-	}()
-	go func() {
-		defer wg.Done()
-		gDetails, gResid = AtrousWavelet(g, levels)
-	}()
-	go func() {
-		defer wg.Done()
-		bDetails, bResid = AtrousWavelet(b, levels)
-	}()
+	rDetails, gDetails, bDetails, rResid, gResid, bResid, err := AtrousWaveletRGBErr(r, g, b, levels)
+	panicOnError(err)
 	return
 }
 
+// AtrousWaveletRGBErr is AtrousWaveletRGB returning an error
+// instead of panicking on empty, ragged or mismatched
+// channels or a negative level count.
+func AtrousWaveletRGBErr(r, g, b [][]float32, levels int) (rDetails, gDetails, bDetails [][][]float32, rResid, gResid, bResid [][]float32, err error) {
+	if err := validateRowsSameSize(r, g, b); err != nil {
+		return nil, nil, nil, nil, nil, nil, err
+	}
+	type result struct {
+		details  [][][]float32
+		residual [][]float32
+	}
+	in := [3][][]float32{r, g, b}
+	res, err := dispatchErr(3, func(c int) (result, error) {
+		d, rs, err := AtrousWaveletPlaneCtx(context.Background(), PlaneFromRows(in[c]), levels, Edge{}, nil)
+		if err != nil {
+			return result{}, err
+		}
+		return result{planesToRows(d), rs.Rows()}, nil
+	})
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, err
+	}
+	return res[0].details, res[1].details, res[2].details, res[0].residual, res[1].residual, res[2].residual, nil
+}
+
 // AtrousReconstructRGB reconstructs the RGB image from per-channel details+residual.
 func AtrousReconstructRGB(rDetails, gDetails, bDetails [][][]float32, rResid, gResid, bResid [][]float32) (r, g, b [][]float32) {
-	var wg sync.WaitGroup
-	wg.Add(3)
-
-	go func() {
-		defer wg.Done()
-		r = AtrousReconstruct(rDetails, rResid)
-	}()
-	go func() {
-		defer wg.Done()
-		g = AtrousReconstruct(gDetails, gResid)
-	}()
-	go func() {
-		defer wg.Done()
-		b = AtrousReconstruct(bDetails, bResid)
-	}()
+	r, g, b, err := AtrousReconstructRGBErr(rDetails, gDetails, bDetails, rResid, gResid, bResid)
+	panicOnError(err)
 	return
 }
+
+// AtrousReconstructRGBErr is AtrousReconstructRGB returning
+// an error instead of panicking on empty, ragged or
+// mismatched layers.
+func AtrousReconstructRGBErr(rDetails, gDetails, bDetails [][][]float32, rResid, gResid, bResid [][]float32) (r, g, b [][]float32, err error) {
+	details := [3][][][]float32{rDetails, gDetails, bDetails}
+	resid := [3][][]float32{rResid, gResid, bResid}
+	if err := validateLayersRGB(details, resid); err != nil {
+		return nil, nil, nil, err
+	}
+	out := dispatch(3, func(c int) [][]float32 {
+		return AtrousReconstruct(details[c], resid[c])
+	})
+	return out[0], out[1], out[2], nil
+}
+
+// validateLayersRGB checks that the residuals and detail
+// layers of all three channels are valid and of one size.
+func validateLayersRGB(details [3][][][]float32, resid [3][][]float32) error {
+	all := append([][][]float32{}, resid[:]...)
+	for _, d := range details {
+		all = append(all, d...)
+	}
+	return validateRowsSameSize(all...)
+}
@@ -1,141 +1,105 @@
 // Blur functions
 package goimagefreq
 
-import (
-	"runtime"
-	"sync"
-)
+import "context"
 
-// GaussianBlur applies a full 2D Gaussian blur
+// GaussianBlurPlane applies a full 2D Gaussian blur
 // using separable convolution (horizontal + vertical).
-func GaussianBlur(src [][]float32, sigma float64) [][]float32 {
-	k := GaussianKernel(sigma)
-	tmp := Convolve1D(src, k, true)
-	return Convolve1D(tmp, k, false)
+// A sigma of 0 means no blur and returns a copy of src, as
+// GaussianKernel(0) is the identity.
+func GaussianBlurPlane(src *Plane, sigma float64, edge Edge) *Plane {
+	out, err := GaussianBlurPlaneCtx(context.Background(), src, sigma, edge, nil)
+	panicOnError(err)
+	return out
 }
 
-// GaussianBlurYCbCr blurs only luminance (Y channel).
-func GaussianBlurYCbCr(img RGBImage, sigma float64) RGBImage {
-	h, w := img.H, img.W
+// GaussianBlurPlaneCtx is GaussianBlurPlane with cancellation.
+// It reports two progress steps (horizontal and vertical pass).
+func GaussianBlurPlaneCtx(ctx context.Context, src *Plane, sigma float64, edge Edge, progress ProgressFunc) (*Plane, error) {
+	return GaussianBlurMethodPlaneCtx(ctx, src, sigma, edge, GaussianFIR, progress)
+}
 
-	Y := make([][]float32, h)
-	Cb := make([][]float32, h)
-	Cr := make([][]float32, h)
+// GaussianBlurMethodPlane is GaussianBlurPlane computed with
+// the given method; GaussianRecursive keeps large blurs
+// (background models, coarse bands) at a constant cost per
+// pixel.
+func GaussianBlurMethodPlane(src *Plane, sigma float64, edge Edge, method GaussianMethod) *Plane {
+	out, err := GaussianBlurMethodPlaneCtx(context.Background(), src, sigma, edge, method, nil)
+	panicOnError(err)
+	return out
+}
 
-	for y := 0; y < h; y++ {
-		Y[y] = make([]float32, w)
-		Cb[y] = make([]float32, w)
-		Cr[y] = make([]float32, w)
+// GaussianBlurMethodPlaneCtx is GaussianBlurMethodPlane with
+// cancellation. It reports two progress steps.
+func GaussianBlurMethodPlaneCtx(ctx context.Context, src *Plane, sigma float64, edge Edge, method GaussianMethod, progress ProgressFunc) (*Plane, error) {
+	if err := validateSameSize(src); err != nil {
+		return nil, err
 	}
-
-	// RGB → YCbCr (parallel)
-	wg := sync.WaitGroup{}
-	workers := runtime.GOMAXPROCS(0)
-	jobs := make(chan int, h)
-
-	for i := 0; i < workers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for y := range jobs {
-				for x := 0; x < w; x++ {
-					Y[y][x], Cb[y][x], Cr[y][x] =
-						RGBToYCbCr(img.R[y][x], img.G[y][x], img.B[y][x])
-				}
-			}
-		}()
+	if err := validateBlurSigma("sigma", sigma); err != nil {
+		return nil, err
 	}
-
-	for y := 0; y < h; y++ {
-		jobs <- y
+	if err := edge.validate(); err != nil {
+		return nil, err
 	}
-	close(jobs)
-	wg.Wait()
-
-	// Blur luminance only
-	Yb := GaussianBlur(Y, sigma)
-
-	// Recombine
-	out := RGBImage{
-		W: w,
-		H: h,
-		R: make([][]float32, h),
-		G: make([][]float32, h),
-		B: make([][]float32, h),
+	if err := method.validate(); err != nil {
+		return nil, err
 	}
 
-	for y := 0; y < h; y++ {
-		out.R[y] = make([]float32, w)
-		out.G[y] = make([]float32, w)
-		out.B[y] = make([]float32, w)
-		for x := 0; x < w; x++ {
-			out.R[y][x], out.G[y][x], out.B[y][x] =
-				YCbCrToRGB(Yb[y][x], Cb[y][x], Cr[y][x])
+	pass := func(p *Plane, horizontal bool) (*Plane, error) {
+		if method == GaussianRecursive && sigma >= recursiveMinSigma {
+			return recursiveGaussian1D(ctx, p, sigma, horizontal, edge)
 		}
+		return convolve1D(ctx, p, GaussianKernel(sigma), horizontal, edge)
+	}
+	tmp, err := pass(src, true)
+	if err != nil {
+		return nil, err
+	}
+	progress.report(1, 2)
+	out, err := pass(tmp, false)
+	if err != nil {
+		return nil, err
 	}
+	progress.report(2, 2)
+	return out, nil
+}
 
-	return out
+// GaussianBlur is the [][]float32 adapter for GaussianBlurPlane
+// (clamp-to-edge).
+func GaussianBlur(src [][]float32, sigma float64) [][]float32 {
+	return GaussianBlurPlane(PlaneFromRows(src), sigma, Edge{}).Rows()
 }
 
-// GaussianBlurLab blurs only the L* channel (perceptual luminance).
-func GaussianBlurLab(img RGBImage, sigma float64) RGBImage {
-	h, w := img.H, img.W
+// GaussianBlurMethod is the [][]float32 adapter for
+// GaussianBlurMethodPlane (clamp-to-edge).
+func GaussianBlurMethod(src [][]float32, sigma float64, method GaussianMethod) [][]float32 {
+	return GaussianBlurMethodPlane(PlaneFromRows(src), sigma, Edge{}, method).Rows()
+}
 
-	L := make([][]float32, h)
-	A := make([][]float32, h)
-	B := make([][]float32, h)
+// GaussianBlurYCbCr blurs only luminance (Y channel).
+func GaussianBlurYCbCr(img RGBImage, sigma float64) RGBImage {
+	r, g, b := img.Planes()
 
-	for y := 0; y < h; y++ {
-		L[y] = make([]float32, w)
-		A[y] = make([]float32, w)
-		B[y] = make([]float32, w)
-	}
+	// RGB → YCbCr (parallel)
+	Y, Cb, Cr := RGBToYCbCrPlane(r, g, b)
 
-	wg := sync.WaitGroup{}
-	workers := runtime.GOMAXPROCS(0)
-	jobs := make(chan int, h)
+	// Blur luminance only
+	Yb := GaussianBlurPlane(Y, sigma, Edge{})
 
-	// RGB → Lab
-	for i := 0; i < workers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for y := range jobs {
-				for x := 0; x < w; x++ {
-					L[y][x], A[y][x], B[y][x] =
-						RGBToLab(img.R[y][x], img.G[y][x], img.B[y][x])
-				}
-			}
-		}()
-	}
+	// Recombine
+	return RGBImageFromPlanes(YCbCrToRGBPlane(Yb, Cb, Cr))
+}
 
-	for y := 0; y < h; y++ {
-		jobs <- y
-	}
-	close(jobs)
-	wg.Wait()
+// GaussianBlurLab blurs only the L* channel (perceptual luminance).
+func GaussianBlurLab(img RGBImage, sigma float64) RGBImage {
+	r, g, b := img.Planes()
+
+	// RGB → Lab
+	L, A, B := RGBToLabPlane(r, g, b)
 
 	// Blur luminance only
-	Lb := GaussianBlur(L, sigma)
+	Lb := GaussianBlurPlane(L, sigma, Edge{})
 
 	// Recombine
-	out := RGBImage{
-		W: w,
-		H: h,
-		R: make([][]float32, h),
-		G: make([][]float32, h),
-		B: make([][]float32, h),
-	}
-
-	for y := 0; y < h; y++ {
-		out.R[y] = make([]float32, w)
-		out.G[y] = make([]float32, w)
-		out.B[y] = make([]float32, w)
-		for x := 0; x < w; x++ {
-			out.R[y][x], out.G[y][x], out.B[y][x] =
-				LabToRGB(Lb[y][x], A[y][x], B[y][x])
-		}
-	}
-
-	return out
+	return RGBImageFromPlanes(LabToRGBPlane(Lb, A, B))
 }
@@ -0,0 +1,515 @@
+// BM3D collaborative filtering denoiser
+package goimagefreq
+
+import (
+	"context"
+	"math"
+)
+
+// BM3DParams controls BM3DPlane. Zero fields take the
+// defaults noted.
+type BM3DParams struct {
+	// Sigma is the noise standard deviation; 0 estimates it
+	// by MAD on the first à trous layer.
+	Sigma float32
+
+	BlockSize    int // block side in pixels; 0 means 8
+	Step         int // spacing of reference blocks; 0 means 3
+	SearchRadius int // block matching within ±r pixels; 0 means 16
+	MaxMatches   int // blocks per group, rounded down to a power of 2; 0 means 16
+}
+
+// withDefaults fills in the zero fields.
+func (p BM3DParams) withDefaults() BM3DParams {
+	if p.BlockSize == 0 {
+		p.BlockSize = 8
+	}
+	if p.Step == 0 {
+		p.Step = 3
+	}
+	if p.SearchRadius == 0 {
+		p.SearchRadius = 16
+	}
+	if p.MaxMatches == 0 {
+		p.MaxMatches = 16
+	}
+	return p
+}
+
+// validate checks the parameters after withDefaults.
+func (p BM3DParams) validate() error {
+	if p.BlockSize < 2 || p.Step < 1 || p.SearchRadius < 0 || p.MaxMatches < 1 {
+		return invalidParam("BM3D needs block size ≥ 2, step ≥ 1, search radius ≥ 0 and ≥ 1 match, got %d, %d, %d, %d",
+			p.BlockSize, p.Step, p.SearchRadius, p.MaxMatches)
+	}
+	if !(p.Sigma >= 0) || math.IsInf(float64(p.Sigma), 1) {
+		return invalidParam("BM3D sigma must be non-negative and finite, got %g", p.Sigma)
+	}
+	return nil
+}
+
+const (
+	// bm3dLambda is the hard threshold of the first stage,
+	// in units of sigma.
+	bm3dLambda = 2.7
+	// bm3dKaiserBeta shapes the aggregation window.
+	bm3dKaiserBeta = 2
+	// bm3dMatchHard and bm3dMatchWiener are the largest mean
+	// squared block distances, in units of σ², accepted when
+	// matching on the noisy image and on the basic estimate.
+	bm3dMatchHard   = 6
+	bm3dMatchWiener = 1
+)
+
+// BM3DPlane denoises src with block-matching and 3D
+// collaborative filtering (Dabov et al. 2007): similar blocks
+// are stacked into groups, filtered jointly in a 3D
+// transform domain (2D DCT and a Walsh-Hadamard transform
+// across the group), and the overlapping estimates averaged.
+// A first pass hard-thresholds the groups; a second matches
+// on that basic estimate and applies an empirical Wiener
+// filter.
+//
+// Blocks lie inside the image, which must be at least
+// BlockSize pixels in both directions.
+func BM3DPlane(src *Plane, params BM3DParams) *Plane {
+	out, err := BM3DPlaneCtx(context.Background(), src, params, nil)
+	panicOnError(err)
+	return out
+}
+
+// BM3DPlaneCtx is BM3DPlane with cancellation. It reports one
+// progress step per stage.
+func BM3DPlaneCtx(ctx context.Context, src *Plane, params BM3DParams, progress ProgressFunc) (*Plane, error) {
+	if err := validateSameSize(src); err != nil {
+		return nil, err
+	}
+	p := params.withDefaults()
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	if src.W < p.BlockSize || src.H < p.BlockSize {
+		return nil, invalidParam("BM3D needs an image of at least %dx%d, got %dx%d", p.BlockSize, p.BlockSize, src.W, src.H)
+	}
+
+	sigma := p.Sigma
+	if sigma == 0 {
+		s, err := estimateNoiseSigma(ctx, src, Edge{})
+		if err != nil {
+			return nil, err
+		}
+		sigma = s
+	}
+	if sigma == 0 {
+		progress.report(2, 2)
+		return src.Clone(), nil
+	}
+
+	b := newBM3D(src, p, sigma)
+	basic, err := b.stage(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	progress.report(1, 2)
+	out, err := b.stage(ctx, basic)
+	if err != nil {
+		return nil, err
+	}
+	progress.report(2, 2)
+	return out, nil
+}
+
+// BM3D is the [][]float32 adapter for BM3DPlane.
+func BM3D(src [][]float32, params BM3DParams) [][]float32 {
+	return BM3DPlane(PlaneFromRows(src), params).Rows()
+}
+
+// BM3DLab denoises only the L* channel of img with BM3DPlane,
+// leaving chroma untouched.
+func BM3DLab(img RGBImage, params BM3DParams) RGBImage {
+	out, err := BM3DLabCtx(context.Background(), img, params, nil)
+	panicOnError(err)
+	return out
+}
+
+// BM3DLabCtx is BM3DLab with cancellation. It reports
+// progress like BM3DPlaneCtx.
+func BM3DLabCtx(ctx context.Context, img RGBImage, params BM3DParams, progress ProgressFunc) (RGBImage, error) {
+	if err := img.Validate(); err != nil {
+		return RGBImage{}, err
+	}
+	r, g, b := img.Planes()
+
+	// RGB → Lab
+	L, A, B := RGBToLabPlane(r, g, b)
+
+	// Denoise luminance only
+	Ld, err := BM3DPlaneCtx(ctx, L, params, progress)
+	if err != nil {
+		return RGBImage{}, err
+	}
+
+	// Lab → RGB
+	return RGBImageFromPlanes(LabToRGBPlane(Ld, A, B)), nil
+}
+
+// bm3d holds what both stages share.
+type bm3d struct {
+	src    *Plane
+	p      BM3DParams
+	sigma  float32
+	dct    []float32 // orthonormal DCT-II matrix, row k = basis k
+	window []float32 // Kaiser window, row-major
+	xs, ys []int     // reference block positions
+}
+
+func newBM3D(src *Plane, p BM3DParams, sigma float32) *bm3d {
+	n := p.BlockSize
+	b := &bm3d{src: src, p: p, sigma: sigma}
+
+	b.dct = make([]float32, n*n)
+	for k := 0; k < n; k++ {
+		a := math.Sqrt(2 / float64(n))
+		if k == 0 {
+			a = math.Sqrt(1 / float64(n))
+		}
+		for i := 0; i < n; i++ {
+			b.dct[k*n+i] = float32(a * math.Cos(math.Pi*float64((2*i+1)*k)/float64(2*n)))
+		}
+	}
+
+	kaiser := make([]float64, n)
+	for i := range kaiser {
+		t := 2*float64(i)/float64(n-1) - 1
+		kaiser[i] = besselI0(bm3dKaiserBeta*math.Sqrt(1-t*t)) / besselI0(bm3dKaiserBeta)
+	}
+	b.window = make([]float32, n*n)
+	for j := 0; j < n; j++ {
+		for i := 0; i < n; i++ {
+			b.window[j*n+i] = float32(kaiser[j] * kaiser[i])
+		}
+	}
+
+	b.xs = blockPositions(src.W, n, p.Step)
+	b.ys = blockPositions(src.H, n, p.Step)
+	return b
+}
+
+// blockPositions returns block origins every step along an
+// axis of length size, always including the last one.
+func blockPositions(size, n, step int) []int {
+	var pos []int
+	for i := 0; i+n <= size; i += step {
+		pos = append(pos, i)
+	}
+	if last := size - n; pos[len(pos)-1] != last {
+		pos = append(pos, last)
+	}
+	return pos
+}
+
+// stage runs the hard-thresholding stage when basic is nil
+// and the Wiener stage otherwise.
+//
+// Reference rows are split into bands at least as tall as
+// the area one reference block can write to; even bands run
+// in parallel, then odd ones, so no two goroutines ever
+// aggregate into the same pixel.
+func (b *bm3d) stage(ctx context.Context, basic *Plane) (*Plane, error) {
+	w, h := b.src.W, b.src.H
+	n := b.p.BlockSize
+	num := make([]float64, w*h)
+	den := make([]float64, w*h)
+
+	reach := 2*b.p.SearchRadius + n
+	var bands [][2]int // ranges of indices into ys
+	for i := 0; i < len(b.ys); {
+		j := i
+		for j < len(b.ys) && b.ys[j]-b.ys[i] < reach {
+			j++
+		}
+		bands = append(bands, [2]int{i, j})
+		i = j
+	}
+
+	done := ctx.Done()
+	for parity := 0; parity < 2; parity++ {
+		var mine [][2]int
+		for i := parity; i < len(bands); i += 2 {
+			mine = append(mine, bands[i])
+		}
+		parallelRows(len(mine), func(k int) {
+			g := b.newGroupBuffers()
+			for i := mine[k][0]; i < mine[k][1] && !isDone(done); i++ {
+				for _, x := range b.xs {
+					b.filterGroup(g, x, b.ys[i], basic, num, den)
+				}
+			}
+		})
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	out := NewPlane(w, h)
+	parallelRows(h, func(y int) {
+		row, dst := b.src.Row(y), out.Row(y)
+		for x := range dst {
+			if d := den[y*w+x]; d > 0 {
+				dst[x] = float32(num[y*w+x] / d)
+			} else {
+				dst[x] = row[x]
+			}
+		}
+	})
+	return out, nil
+}
+
+// groupBuffers is per-goroutine scratch space.
+type groupBuffers struct {
+	matches []blockMatch
+	noisy   []float32 // group blocks, block-major
+	guide   []float32 // same blocks of the basic estimate
+	tmp     []float32
+	col     []float32
+	gcol    []float32
+}
+
+// blockMatch is a candidate block and its distance to the
+// reference.
+type blockMatch struct {
+	x, y int
+	dist float32
+}
+
+func (b *bm3d) newGroupBuffers() *groupBuffers {
+	n2 := b.p.BlockSize * b.p.BlockSize
+	return &groupBuffers{
+		matches: make([]blockMatch, 0, b.p.MaxMatches),
+		noisy:   make([]float32, b.p.MaxMatches*n2),
+		guide:   make([]float32, b.p.MaxMatches*n2),
+		tmp:     make([]float32, n2),
+		col:     make([]float32, b.p.MaxMatches),
+		gcol:    make([]float32, b.p.MaxMatches),
+	}
+}
+
+// filterGroup matches, filters and aggregates the group of
+// the reference block at (rx, ry).
+func (b *bm3d) filterGroup(g *groupBuffers, rx, ry int, basic *Plane, num, den []float64) {
+	n := b.p.BlockSize
+	n2 := n * n
+	sigma := b.sigma
+	s2 := sigma * sigma
+
+	// Block matching, on the basic estimate in stage 2.
+	match, tau := b.src, float32(bm3dMatchHard)*s2
+	if basic != nil {
+		match, tau = basic, float32(bm3dMatchWiener)*s2
+	}
+	b.matchBlocks(g, match, rx, ry, tau*float32(n2))
+
+	count := 1
+	for count*2 <= len(g.matches) {
+		count *= 2
+	}
+	matches := g.matches[:count]
+
+	// 2D transform of every block.
+	for i, m := range matches {
+		blk := g.noisy[i*n2 : (i+1)*n2]
+		b.readBlock(blk, b.src, m.x, m.y)
+		b.dct2(blk, g.tmp, false)
+		if basic != nil {
+			blk := g.guide[i*n2 : (i+1)*n2]
+			b.readBlock(blk, basic, m.x, m.y)
+			b.dct2(blk, g.tmp, false)
+		}
+	}
+
+	// Transform across the group, filter each 3D
+	// coefficient, and transform back.
+	col, gcol := g.col[:count], g.gcol[:count]
+	thr := float32(bm3dLambda) * sigma
+	var weight float64 // Σ of the filter's squared gains
+	for c := 0; c < n2; c++ {
+		for i := range col {
+			col[i] = g.noisy[i*n2+c]
+		}
+		walshHadamard(col)
+		if basic == nil {
+			for i, v := range col {
+				if v > -thr && v < thr {
+					col[i] = 0
+				} else {
+					weight++
+				}
+			}
+		} else {
+			for i := range gcol {
+				gcol[i] = g.guide[i*n2+c]
+			}
+			walshHadamard(gcol)
+			for i, v := range gcol {
+				a := v * v / (v*v + s2)
+				col[i] *= a
+				weight += float64(a * a)
+			}
+		}
+		walshHadamard(col)
+		for i, v := range col {
+			g.noisy[i*n2+c] = v
+		}
+	}
+	// Groups with less residual noise count more.
+	if weight < 1 {
+		weight = 1
+	}
+	weight = 1 / (float64(s2) * weight)
+
+	w := b.src.W
+	for i, m := range matches {
+		blk := g.noisy[i*n2 : (i+1)*n2]
+		b.dct2(blk, g.tmp, true)
+		for j := 0; j < n; j++ {
+			off := (m.y+j)*w + m.x
+			for k := 0; k < n; k++ {
+				wk := weight * float64(b.window[j*n+k])
+				num[off+k] += wk * float64(blk[j*n+k])
+				den[off+k] += wk
+			}
+		}
+	}
+}
+
+// matchBlocks fills g.matches with up to MaxMatches blocks of
+// p within the search window of (rx, ry) whose squared
+// distance to the reference is at most maxDist, closest
+// first. The reference itself always comes first.
+func (b *bm3d) matchBlocks(g *groupBuffers, p *Plane, rx, ry int, maxDist float32) {
+	n := b.p.BlockSize
+	r := b.p.SearchRadius
+	g.matches = append(g.matches[:0], blockMatch{rx, ry, 0})
+
+	x0, x1 := max(rx-r, 0), min(rx+r, p.W-n)
+	y0, y1 := max(ry-r, 0), min(ry+r, p.H-n)
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			if x == rx && y == ry {
+				continue
+			}
+			bound := maxDist
+			full := len(g.matches) == cap(g.matches)
+			if full {
+				bound = g.matches[len(g.matches)-1].dist
+			}
+
+			// Squared distance, abandoned once over bound.
+			var d float32
+			for j := 0; j < n && d <= bound; j++ {
+				a := p.Row(ry + j)[rx : rx+n]
+				c := p.Row(y + j)[x : x+n]
+				for i, v := range a {
+					e := v - c[i]
+					d += e * e
+				}
+			}
+			if d > bound || (full && d == bound) {
+				continue
+			}
+
+			// Insert in order, dropping the worst if full.
+			if !full {
+				g.matches = append(g.matches, blockMatch{})
+			}
+			k := len(g.matches) - 1
+			for k > 1 && g.matches[k-1].dist > d {
+				g.matches[k] = g.matches[k-1]
+				k--
+			}
+			g.matches[k] = blockMatch{x, y, d}
+		}
+	}
+}
+
+// readBlock copies the block of p at (x, y) into dst.
+func (b *bm3d) readBlock(dst []float32, p *Plane, x, y int) {
+	n := b.p.BlockSize
+	for j := 0; j < n; j++ {
+		copy(dst[j*n:(j+1)*n], p.Row(y + j)[x:x+n])
+	}
+}
+
+// dct2 applies the orthonormal 2D DCT to blk in place, or
+// its inverse; tmp must hold a block.
+func (b *bm3d) dct2(blk, tmp []float32, inverse bool) {
+	n := b.p.BlockSize
+	c := b.dct
+	// tmp = C·B (forward) or Cᵀ·B (inverse), then
+	// blk = tmp·Cᵀ or tmp·C.
+	for k := 0; k < n; k++ {
+		t := tmp[k*n : (k+1)*n]
+		for i := range t {
+			t[i] = 0
+		}
+		for j := 0; j < n; j++ {
+			ckj := c[k*n+j]
+			if inverse {
+				ckj = c[j*n+k]
+			}
+			row := blk[j*n : (j+1)*n]
+			for i, v := range row {
+				t[i] += ckj * v
+			}
+		}
+	}
+	for k := 0; k < n; k++ {
+		t := tmp[k*n : (k+1)*n]
+		for l := 0; l < n; l++ {
+			var s float32
+			for i, v := range t {
+				if inverse {
+					s += v * c[i*n+l]
+				} else {
+					s += v * c[l*n+i]
+				}
+			}
+			blk[k*n+l] = s
+		}
+	}
+}
+
+// walshHadamard applies the orthonormal Walsh-Hadamard
+// transform to v in place (len(v) a power of 2). It is its
+// own inverse.
+func walshHadamard(v []float32) {
+	n := len(v)
+	for h := 1; h < n; h *= 2 {
+		for i := 0; i < n; i += 2 * h {
+			for j := i; j < i+h; j++ {
+				a, b := v[j], v[j+h]
+				v[j], v[j+h] = a+b, a-b
+			}
+		}
+	}
+	if n > 1 {
+		s := float32(1 / math.Sqrt(float64(n)))
+		for i := range v {
+			v[i] *= s
+		}
+	}
+}
+
+// besselI0 is the modified Bessel function of the first
+// kind, order 0, by its power series.
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; k < 50; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+		if term < 1e-17*sum {
+			break
+		}
+	}
+	return sum
+}
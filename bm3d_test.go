@@ -0,0 +1,100 @@
+package goimagefreq
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// noisyRGB returns a smooth colour gradient with Gaussian
+// noise of the given sigma added to every channel.
+func noisyRGB(w, h int, sigma float32) (clean, noisy RGBImage) {
+	r := rand.New(rand.NewSource(8))
+	planes := [2][3]*Plane{}
+	for c := 0; c < 3; c++ {
+		p, n := NewPlane(w, h), NewPlane(w, h)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				v := 0.2 + 0.6*float32(x+c*y)/float32(w+2*h)
+				p.Set(x, y, v)
+				n.Set(x, y, v+sigma*float32(r.NormFloat64()))
+			}
+		}
+		planes[0][c], planes[1][c] = p, n
+	}
+	return RGBImageFromPlanes(planes[0][0], planes[0][1], planes[0][2]),
+		RGBImageFromPlanes(planes[1][0], planes[1][1], planes[1][2])
+}
+
+func rgbMaxError(a, b RGBImage) float32 {
+	r, g, bl := MaxAbsErrorRGB(a.R, a.G, a.B, b.R, b.G, b.B)
+	return max(r, g, bl)
+}
+
+func rmsError(a, b *Plane) float64 {
+	var ss float64
+	for i, v := range a.Data {
+		d := float64(v - b.Data[i])
+		ss += d * d
+	}
+	return math.Sqrt(ss / float64(len(a.Data)))
+}
+
+func labPlanes(img RGBImage) (L, A, B *Plane) {
+	r, g, b := img.Planes()
+	return RGBToLabPlane(r, g, b)
+}
+
+// checkLuminanceDenoised checks that out has the same a*, b*
+// as noisy and an L* RMS error below ratio times noisy's.
+func checkLuminanceDenoised(t *testing.T, name string, clean, noisy, out RGBImage, ratio float64) {
+	t.Helper()
+	cL, _, _ := labPlanes(clean)
+	nL, nA, nB := labPlanes(noisy)
+	oL, oA, oB := labPlanes(out)
+	if before, after := rmsError(nL, cL), rmsError(oL, cL); after >= ratio*before {
+		t.Errorf("%s: L* RMS error went from %g to %g", name, before, after)
+	}
+	if e := max(MaxAbsErrorPlane(oA, nA), MaxAbsErrorPlane(oB, nB)); e > 0.05 {
+		t.Errorf("%s: chroma changed by %g", name, e)
+	}
+}
+
+func TestBM3DLabCtx(t *testing.T) {
+	clean, noisy := noisyRGB(24, 20, 0.02)
+	params := BM3DParams{SearchRadius: 4, MaxMatches: 4}
+	out, err := BM3DLabCtx(context.Background(), noisy, params, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.W != 24 || out.H != 20 {
+		t.Fatalf("output is %dx%d", out.W, out.H)
+	}
+	checkLuminanceDenoised(t, "BM3DLabCtx", clean, noisy, out, 0.5)
+	if e := rgbMaxError(BM3DLab(noisy, params), out); e != 0 {
+		t.Errorf("BM3DLab differs from BM3DLabCtx by %g", e)
+	}
+}
+
+func TestBM3DLabCtxErrors(t *testing.T) {
+	_, noisy := noisyRGB(16, 16, 0.02)
+	ragged := noisy
+	ragged.G = append([][]float32(nil), noisy.G...)
+	ragged.G[5] = ragged.G[5][:7]
+	if _, err := BM3DLabCtx(context.Background(), ragged, BM3DParams{}, nil); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("ragged image: got %v", err)
+	}
+	if _, err := BM3DLabCtx(context.Background(), RGBImage{}, BM3DParams{}, nil); !errors.Is(err, ErrEmptyImage) {
+		t.Errorf("empty image: got %v", err)
+	}
+	if _, err := BM3DLabCtx(context.Background(), noisy, BM3DParams{BlockSize: 1}, nil); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("block size 1: got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := BM3DLabCtx(ctx, noisy, BM3DParams{}, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled: got %v", err)
+	}
+}
@@ -0,0 +1,256 @@
+// Chrominance denoising
+package goimagefreq
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// ChromaDenoiseParams controls chroma-only denoising. Zero
+// fields take the defaults noted.
+type ChromaDenoiseParams struct {
+	// Levels is the number of detail layers smoothed away,
+	// i.e. mottle up to about 2^Levels pixels; 0 means 4.
+	Levels int
+
+	// Amount is the fraction of the chroma detail removed on
+	// those layers, in (0, 1]; 0 means 1.
+	Amount float32
+
+	// Transform decomposes the planes; nil means à trous.
+	// MMTPlaneCtx does not spread star colors into a halo.
+	Transform Transform
+
+	// EdgeGuided protects chroma detail wherever the
+	// luminance layer of the same scale has structure, so
+	// colors do not bleed across star and nebula edges.
+	EdgeGuided bool
+
+	// EdgeK is the luminance detail, as a multiple of that
+	// layer's noise sigma, above which chroma is fully
+	// protected; 0 means 3.
+	EdgeK float32
+}
+
+// withDefaults fills in the zero fields.
+func (p ChromaDenoiseParams) withDefaults() ChromaDenoiseParams {
+	if p.Levels == 0 {
+		p.Levels = 4
+	}
+	if p.Amount == 0 {
+		p.Amount = 1
+	}
+	if p.Transform == nil {
+		p.Transform = AtrousWaveletPlaneCtx
+	}
+	if p.EdgeK == 0 {
+		p.EdgeK = 3
+	}
+	return p
+}
+
+// validate checks the parameters after withDefaults.
+func (p ChromaDenoiseParams) validate() error {
+	if p.Levels < 1 {
+		return invalidParam("chroma denoising needs at least 1 level, got %d", p.Levels)
+	}
+	if !(p.Amount > 0 && p.Amount <= 1) {
+		return invalidParam("chroma denoising amount must be in (0, 1], got %g", p.Amount)
+	}
+	if !(p.EdgeK > 0) || math.IsInf(float64(p.EdgeK), 1) {
+		return invalidParam("chroma denoising edge k must be positive and finite, got %g", p.EdgeK)
+	}
+	return nil
+}
+
+// ChromaDenoisePlane smooths two chrominance planes (a*/b*
+// or Cb/Cr) by attenuating their first params.Levels detail
+// layers, leaving larger-scale color intact. If
+// params.EdgeGuided is set, chroma detail is kept where guide
+// (L* or Y, then required) has detail on the same layer;
+// otherwise guide is ignored and may be nil.
+//
+// Samples outside the image are read according to edge.
+func ChromaDenoisePlane(guide, c1, c2 *Plane, params ChromaDenoiseParams, edge Edge) (*Plane, *Plane) {
+	o1, o2, err := ChromaDenoisePlaneCtx(context.Background(), guide, c1, c2, params, edge, nil)
+	panicOnError(err)
+	return o1, o2
+}
+
+// ChromaDenoisePlaneCtx is ChromaDenoisePlane with
+// cancellation. It reports one progress step per plane
+// decomposed plus a final step for reconstruction.
+func ChromaDenoisePlaneCtx(ctx context.Context, guide, c1, c2 *Plane, params ChromaDenoiseParams, edge Edge, progress ProgressFunc) (*Plane, *Plane, error) {
+	if err := validateSameSize(c1, c2); err != nil {
+		return nil, nil, err
+	}
+	p := params.withDefaults()
+	if err := p.validate(); err != nil {
+		return nil, nil, err
+	}
+	planes := []*Plane{c1, c2}
+	if p.EdgeGuided {
+		if guide == nil {
+			return nil, nil, invalidParam("edge-guided chroma denoising needs a guide plane")
+		}
+		if err := validateSameSize(c1, guide); err != nil {
+			return nil, nil, err
+		}
+		planes = append(planes, guide)
+	}
+
+	// The planes are decomposed concurrently; each one that
+	// finishes is reported here, on the calling goroutine.
+	total := len(planes) + 1
+	type decomposition struct {
+		details  []*Plane
+		residual *Plane
+		err      error
+	}
+	dec := make([]decomposition, len(planes))
+	finished := make(chan int)
+	for c, src := range planes {
+		go func() {
+			d, r, err := p.Transform(ctx, src, p.Levels, edge, nil)
+			dec[c] = decomposition{d, r, err}
+			finished <- c
+		}()
+	}
+	decomposed := 0
+	for range planes {
+		if c := <-finished; dec[c].err == nil {
+			decomposed++
+			progress.report(decomposed, total)
+		}
+	}
+	for c := range dec {
+		if err := dec[c].err; err != nil {
+			return nil, nil, fmt.Errorf("channel %d: %w", c, err)
+		}
+	}
+
+	var guideDetails []*Plane
+	if len(dec) == 3 {
+		guideDetails = dec[2].details
+	}
+	dispatch(p.Levels, func(i int) struct{} {
+		var g *Plane
+		var t float32
+		if guideDetails != nil {
+			g = guideDetails[i]
+			t = p.EdgeK * EstimateNoiseMADPlane(g)
+		}
+		d1, d2 := dec[0].details[i], dec[1].details[i]
+		for y := 0; y < d1.H; y++ {
+			r1, r2 := d1.Row(y), d2.Row(y)
+			var gr []float32
+			if g != nil {
+				gr = g.Row(y)
+			}
+			for x := range r1 {
+				keep := 1 - p.Amount
+				if gr != nil {
+					keep += p.Amount * edgeProtection(gr[x], t)
+				}
+				r1[x] *= keep
+				r2[x] *= keep
+			}
+		}
+		return struct{}{}
+	})
+
+	o1 := AtrousReconstructPlane(dec[0].details, dec[0].residual)
+	o2 := AtrousReconstructPlane(dec[1].details, dec[1].residual)
+	progress.report(total, total)
+	return o1, o2, nil
+}
+
+// ChromaDenoise is the [][]float32 adapter for
+// ChromaDenoisePlane (clamp-to-edge); guide may be nil
+// unless params.EdgeGuided is set.
+func ChromaDenoise(guide, c1, c2 [][]float32, params ChromaDenoiseParams) ([][]float32, [][]float32) {
+	var g *Plane
+	if guide != nil {
+		g = PlaneFromRows(guide)
+	}
+	o1, o2 := ChromaDenoisePlane(g, PlaneFromRows(c1), PlaneFromRows(c2), params, Edge{})
+	return o1.Rows(), o2.Rows()
+}
+
+// ChromaDenoiseLab denoises only the a* and b* channels of
+// img with ChromaDenoisePlane, guided by L* if
+// params.EdgeGuided is set, leaving luminance untouched.
+func ChromaDenoiseLab(img RGBImage, params ChromaDenoiseParams) RGBImage {
+	out, err := ChromaDenoiseLabCtx(context.Background(), img, params, nil)
+	panicOnError(err)
+	return out
+}
+
+// ChromaDenoiseLabCtx is ChromaDenoiseLab with cancellation.
+// It reports progress like ChromaDenoisePlaneCtx.
+func ChromaDenoiseLabCtx(ctx context.Context, img RGBImage, params ChromaDenoiseParams, progress ProgressFunc) (RGBImage, error) {
+	if err := img.Validate(); err != nil {
+		return RGBImage{}, err
+	}
+	r, g, b := img.Planes()
+
+	// RGB → Lab
+	L, A, B := RGBToLabPlane(r, g, b)
+
+	// Denoise chroma only
+	Ad, Bd, err := ChromaDenoisePlaneCtx(ctx, L, A, B, params, Edge{}, progress)
+	if err != nil {
+		return RGBImage{}, err
+	}
+
+	// Lab → RGB
+	return RGBImageFromPlanes(LabToRGBPlane(L, Ad, Bd)), nil
+}
+
+// ChromaDenoiseYCbCr is ChromaDenoiseLab in YCbCr: faster,
+// denoising Cb and Cr guided by Y.
+func ChromaDenoiseYCbCr(img RGBImage, params ChromaDenoiseParams) RGBImage {
+	out, err := ChromaDenoiseYCbCrCtx(context.Background(), img, params, nil)
+	panicOnError(err)
+	return out
+}
+
+// ChromaDenoiseYCbCrCtx is ChromaDenoiseYCbCr with
+// cancellation. It reports progress like
+// ChromaDenoisePlaneCtx.
+func ChromaDenoiseYCbCrCtx(ctx context.Context, img RGBImage, params ChromaDenoiseParams, progress ProgressFunc) (RGBImage, error) {
+	if err := img.Validate(); err != nil {
+		return RGBImage{}, err
+	}
+	r, g, b := img.Planes()
+
+	// RGB → YCbCr
+	Y, Cb, Cr := RGBToYCbCrPlane(r, g, b)
+
+	// Denoise chroma only
+	Cbd, Crd, err := ChromaDenoisePlaneCtx(ctx, Y, Cb, Cr, params, Edge{}, progress)
+	if err != nil {
+		return RGBImage{}, err
+	}
+
+	// Recombine
+	return RGBImageFromPlanes(YCbCrToRGBPlane(Y, Cbd, Crd)), nil
+}
+
+// edgeProtection maps a luminance detail coefficient to the
+// fraction of chroma detail kept: 0 in flat areas, rising
+// as (v/t)² to 1 at |v| = t, so luminance noise alone
+// protects little.
+func edgeProtection(v, t float32) float32 {
+	if v < 0 {
+		v = -v
+	}
+	if v >= t {
+		if v == 0 {
+			return 0
+		}
+		return 1
+	}
+	return (v / t) * (v / t)
+}
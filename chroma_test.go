@@ -0,0 +1,120 @@
+package goimagefreq
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestChromaDenoiseGuide(t *testing.T) {
+	r := rand.New(rand.NewSource(11))
+	c1, c2 := randomPlane(r, 20, 16), randomPlane(r, 20, 16)
+	ctx := context.Background()
+
+	if _, _, err := ChromaDenoisePlaneCtx(ctx, nil, c1, c2, ChromaDenoiseParams{EdgeGuided: true}, Edge{}, nil); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("edge-guided without guide: got %v, want %v", err, ErrInvalidParameter)
+	}
+	if _, _, err := ChromaDenoisePlaneCtx(ctx, NewPlane(20, 15), c1, c2, ChromaDenoiseParams{EdgeGuided: true}, Edge{}, nil); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("edge-guided with mismatched guide: got %v, want %v", err, ErrDimensionMismatch)
+	}
+
+	// Without EdgeGuided the guide is ignored.
+	o1, o2, err := ChromaDenoisePlaneCtx(ctx, nil, c1, c2, ChromaDenoiseParams{}, Edge{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g1, g2, err := ChromaDenoisePlaneCtx(ctx, randomPlane(r, 20, 16), c1, c2, ChromaDenoiseParams{}, Edge{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := max(MaxAbsErrorPlane(o1, g1), MaxAbsErrorPlane(o2, g2)); e != 0 {
+		t.Errorf("unguided result depends on the guide by %g", e)
+	}
+}
+
+// A luminance edge keeps the chroma step across it sharp.
+func TestChromaDenoiseEdgeGuided(t *testing.T) {
+	const w, h = 32, 16
+	guide, c1 := NewPlane(w, h), NewPlane(w, h)
+	for y := 0; y < h; y++ {
+		for x := w / 2; x < w; x++ {
+			guide.Set(x, y, 1)
+			c1.Set(x, y, 0.5)
+		}
+	}
+	c2 := c1.Clone()
+	r := rand.New(rand.NewSource(12))
+	for i := range guide.Data {
+		guide.Data[i] += 0.01 * float32(r.NormFloat64())
+	}
+	step := func(p *Plane) float32 { return p.At(w/2, h/2) - p.At(w/2-1, h/2) }
+
+	plain, _ := ChromaDenoisePlane(guide, c1, c2, ChromaDenoiseParams{}, Edge{})
+	guided, _ := ChromaDenoisePlane(guide, c1, c2, ChromaDenoiseParams{EdgeGuided: true}, Edge{})
+	if step(guided) <= step(plain) || step(guided) < 0.4 {
+		t.Errorf("chroma step: %g unguided, %g guided, 0.5 before", step(plain), step(guided))
+	}
+}
+
+// With edge guidance off, the output is the input minus
+// Amount of its first Levels detail layers, so Amount 1
+// leaves the transform's residual.
+func TestChromaDenoiseAmountAndTransform(t *testing.T) {
+	r := rand.New(rand.NewSource(13))
+	c1, c2 := randomPlane(r, 24, 20), randomPlane(r, 24, 20)
+	const levels = 3
+	for _, tr := range []struct {
+		name string
+		fn   Transform
+	}{{"à trous", AtrousWaveletPlaneCtx}, {"MMT", MMTPlaneCtx}} {
+		full, _ := ChromaDenoisePlane(nil, c1, c2, ChromaDenoiseParams{Levels: levels, Transform: tr.fn}, Edge{})
+		_, residual, err := tr.fn(context.Background(), c1, levels, Edge{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e := MaxAbsErrorPlane(full, residual); e > 1e-5 {
+			t.Errorf("%s: amount 1 differs from the residual by %g", tr.name, e)
+		}
+
+		for _, amount := range []float32{0.25, 0.5} {
+			part, _ := ChromaDenoisePlane(nil, c1, c2, ChromaDenoiseParams{Levels: levels, Amount: amount, Transform: tr.fn}, Edge{})
+			for i, v := range part.Data {
+				want := c1.Data[i] + amount*(full.Data[i]-c1.Data[i])
+				if d := v - want; d > 1e-5 || d < -1e-5 {
+					t.Errorf("%s amount %g: sample %d = %g, want %g", tr.name, amount, i, v, want)
+					break
+				}
+			}
+		}
+	}
+	if _, _, err := ChromaDenoisePlaneCtx(context.Background(), nil, c1, c2, ChromaDenoiseParams{Amount: 1.5}, Edge{}, nil); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("amount 1.5: got %v", err)
+	}
+}
+
+func TestChromaDenoiseProgress(t *testing.T) {
+	r := rand.New(rand.NewSource(14))
+	guide, c1, c2 := randomPlane(r, 16, 16), randomPlane(r, 16, 16), randomPlane(r, 16, 16)
+	for _, guided := range []bool{false, true} {
+		var calls [][2]int
+		record := func(done, total int) { calls = append(calls, [2]int{done, total}) }
+		params := ChromaDenoiseParams{Levels: 2, EdgeGuided: guided}
+		if _, _, err := ChromaDenoisePlaneCtx(context.Background(), guide, c1, c2, params, Edge{}, record); err != nil {
+			t.Fatal(err)
+		}
+		total := 3
+		if guided {
+			total = 4
+		}
+		if len(calls) != total {
+			t.Fatalf("guided %v: progress calls %v, want one per plane plus one", guided, calls)
+		}
+		for i, c := range calls {
+			if c != [2]int{i + 1, total} {
+				t.Errorf("guided %v: progress calls %v", guided, calls)
+				break
+			}
+		}
+	}
+}
@@ -1,10 +1,7 @@
 // Color space conversions
 package goimagefreq
 
-import (
-	"math"
-	"sync"
-)
+import "math"
 
 // BT.709 coefficients (same as sRGB luminance)
 func RGBToYCbCr(r, g, b float32) (y, cb, cr float32) {
@@ -129,138 +126,126 @@ func LabToRGB(L, a, bb float32) (r, g, b float32) {
 // 	return
 // }
 
+// RGBToLabPlane converts linear RGB planes to CIELAB (D65).
+func RGBToLabPlane(
+	r, g, b *Plane,
+) (L, a, b2 *Plane) {
+
+	h := r.H
+	w := r.W
+
+	L = NewPlane(w, h)
+	a = NewPlane(w, h)
+	b2 = NewPlane(w, h)
+
+	parallelRows(h, func(y int) {
+		rr, gg, bb := r.Row(y), g.Row(y), b.Row(y)
+		lr, ar, br := L.Row(y), a.Row(y), b2.Row(y)
+		for x := 0; x < w; x++ {
+			lr[x], ar[x], br[x] = RGBToLab(rr[x], gg[x], bb[x])
+		}
+	})
+	return
+}
+
+// RGBToLabImage is the [][]float32 adapter for RGBToLabPlane.
 func RGBToLabImage(
 	r, g, b [][]float32,
 ) (L, a, b2 [][]float32) {
 
-	h := len(r)
-	w := len(r[0])
-
-	L = make([][]float32, h)
-	a = make([][]float32, h)
-	b2 = make([][]float32, h)
-
-	var wg sync.WaitGroup
-	wg.Add(h)
-
-	for y := 0; y < h; y++ {
-		y := y
-		go func() {
-			defer wg.Done()
-
-			L[y] = make([]float32, w)
-			a[y] = make([]float32, w)
-			b2[y] = make([]float32, w)
-
-			for x := 0; x < w; x++ {
-				L[y][x], a[y][x], b2[y][x] =
-					RGBToLab(r[y][x], g[y][x], b[y][x])
-			}
-		}()
-	}
+	Lp, ap, bp := RGBToLabPlane(PlaneFromRows(r), PlaneFromRows(g), PlaneFromRows(b))
+	return Lp.Rows(), ap.Rows(), bp.Rows()
+}
 
-	wg.Wait()
+// LabToRGBPlane converts CIELAB (D65) planes back to linear RGB.
+func LabToRGBPlane(
+	L, a, b2 *Plane,
+) (r, g, b *Plane) {
+
+	h := L.H
+	w := L.W
+
+	r = NewPlane(w, h)
+	g = NewPlane(w, h)
+	b = NewPlane(w, h)
+
+	parallelRows(h, func(y int) {
+		lr, ar, br := L.Row(y), a.Row(y), b2.Row(y)
+		rr, gg, bb := r.Row(y), g.Row(y), b.Row(y)
+		for x := 0; x < w; x++ {
+			rr[x], gg[x], bb[x] = LabToRGB(lr[x], ar[x], br[x])
+		}
+	})
 	return
 }
 
+// LabToRGBImage is the [][]float32 adapter for LabToRGBPlane.
 func LabToRGBImage(
 	L, a, b2 [][]float32,
 ) (r, g, b [][]float32) {
 
-	h := len(L)
-	w := len(L[0])
-
-	r = make([][]float32, h)
-	g = make([][]float32, h)
-	b = make([][]float32, h)
-
-	var wg sync.WaitGroup
-	wg.Add(h)
-
-	for y := 0; y < h; y++ {
-		y := y
-		go func() {
-			defer wg.Done()
-
-			r[y] = make([]float32, w)
-			g[y] = make([]float32, w)
-			b[y] = make([]float32, w)
-
-			for x := 0; x < w; x++ {
-				r[y][x], g[y][x], b[y][x] =
-					LabToRGB(L[y][x], a[y][x], b2[y][x])
-			}
-		}()
-	}
+	rp, gp, bp := LabToRGBPlane(PlaneFromRows(L), PlaneFromRows(a), PlaneFromRows(b2))
+	return rp.Rows(), gp.Rows(), bp.Rows()
+}
 
-	wg.Wait()
+// RGBToYCbCrPlane converts linear RGB planes to BT.709 YCbCr.
+func RGBToYCbCrPlane(
+	r, g, b *Plane,
+) (y, cb, cr *Plane) {
+
+	h := r.H
+	w := r.W
+
+	y = NewPlane(w, h)
+	cb = NewPlane(w, h)
+	cr = NewPlane(w, h)
+
+	parallelRows(h, func(i int) {
+		rr, gg, bb := r.Row(i), g.Row(i), b.Row(i)
+		yr, cbr, crr := y.Row(i), cb.Row(i), cr.Row(i)
+		for x := 0; x < w; x++ {
+			yr[x], cbr[x], crr[x] = RGBToYCbCr(rr[x], gg[x], bb[x])
+		}
+	})
 	return
 }
 
+// RGBToYCbCrImage is the [][]float32 adapter for RGBToYCbCrPlane.
 func RGBToYCbCrImage(
 	r, g, b [][]float32,
 ) (y, cb, cr [][]float32) {
 
-	h := len(r)
-	w := len(r[0])
-
-	y = make([][]float32, h)
-	cb = make([][]float32, h)
-	cr = make([][]float32, h)
-
-	var wg sync.WaitGroup
-	wg.Add(h)
-
-	for i := 0; i < h; i++ {
-		i := i
-		go func() {
-			defer wg.Done()
-
-			y[i] = make([]float32, w)
-			cb[i] = make([]float32, w)
-			cr[i] = make([]float32, w)
-
-			for x := 0; x < w; x++ {
-				y[i][x], cb[i][x], cr[i][x] =
-					RGBToYCbCr(r[i][x], g[i][x], b[i][x])
-			}
-		}()
-	}
+	yp, cbp, crp := RGBToYCbCrPlane(PlaneFromRows(r), PlaneFromRows(g), PlaneFromRows(b))
+	return yp.Rows(), cbp.Rows(), crp.Rows()
+}
 
-	wg.Wait()
+// YCbCrToRGBPlane converts BT.709 YCbCr planes back to linear RGB.
+func YCbCrToRGBPlane(
+	y, cb, cr *Plane,
+) (r, g, b *Plane) {
+
+	h := y.H
+	w := y.W
+
+	r = NewPlane(w, h)
+	g = NewPlane(w, h)
+	b = NewPlane(w, h)
+
+	parallelRows(h, func(i int) {
+		yr, cbr, crr := y.Row(i), cb.Row(i), cr.Row(i)
+		rr, gg, bb := r.Row(i), g.Row(i), b.Row(i)
+		for x := 0; x < w; x++ {
+			rr[x], gg[x], bb[x] = YCbCrToRGB(yr[x], cbr[x], crr[x])
+		}
+	})
 	return
 }
 
+// YCbCrToRGBImage is the [][]float32 adapter for YCbCrToRGBPlane.
 func YCbCrToRGBImage(
 	y, cb, cr [][]float32,
 ) (r, g, b [][]float32) {
 
-	h := len(y)
-	w := len(y[0])
-
-	r = make([][]float32, h)
-	g = make([][]float32, h)
-	b = make([][]float32, h)
-
-	var wg sync.WaitGroup
-	wg.Add(h)
-
-	for i := 0; i < h; i++ {
-		i := i
-		go func() {
-			defer wg.Done()
-
-			r[i] = make([]float32, w)
-			g[i] = make([]float32, w)
-			b[i] = make([]float32, w)
-
-			for x := 0; x < w; x++ {
-				r[i][x], g[i][x], b[i][x] =
-					YCbCrToRGB(y[i][x], cb[i][x], cr[i][x])
-			}
-		}()
-	}
-
-	wg.Wait()
-	return
+	rp, gp, bp := YCbCrToRGBPlane(PlaneFromRows(y), PlaneFromRows(cb), PlaneFromRows(cr))
+	return rp.Rows(), gp.Rows(), bp.Rows()
 }
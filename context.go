@@ -0,0 +1,74 @@
+// Cancellation and progress reporting
+package goimagefreq
+
+import "context"
+
+// ProgressFunc is called by the Ctx variants of long-running
+// operations after each completed step, with the number of
+// steps done so far and the total. What a step is (an
+// iteration, a wavelet level, a convolution pass) is listed
+// in each function's documentation.
+//
+// It runs on the calling goroutine and should return quickly.
+type ProgressFunc func(done, total int)
+
+// report calls p if it is set.
+func (p ProgressFunc) report(done, total int) {
+	if p != nil {
+		p(done, total)
+	}
+}
+
+// withTotal forwards p's progress with a different total,
+// so a sub-operation can report the first steps of a larger
+// one.
+func (p ProgressFunc) withTotal(total int) ProgressFunc {
+	if p == nil {
+		return nil
+	}
+	return func(done, _ int) { p(done, total) }
+}
+
+// ctxRowBlock is the number of rows a worker processes
+// between cancellation checks in parallelChunksCtx.
+const ctxRowBlock = 16
+
+// isDone reports, without blocking, whether done is closed.
+// A nil channel (context.Background) is never done.
+func isDone(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+// parallelRowsCtx is parallelRows that stops handing out rows
+// once ctx is canceled and returns ctx.Err().
+func parallelRowsCtx(ctx context.Context, h int, fn func(y int)) error {
+	done := ctx.Done()
+	parallelRows(h, func(y int) {
+		if !isDone(done) {
+			fn(y)
+		}
+	})
+	return ctx.Err()
+}
+
+// parallelChunksCtx is parallelChunks that splits each
+// worker's range into blocks of ctxRowBlock rows and stops
+// between blocks once ctx is canceled.
+func parallelChunksCtx(ctx context.Context, n int, fn func(lo, hi int)) error {
+	done := ctx.Done()
+	if done == nil {
+		parallelChunks(n, fn)
+		return nil
+	}
+	parallelChunks(n, func(lo, hi int) {
+		for b := lo; b < hi && !isDone(done); b += ctxRowBlock {
+			fn(b, min(b+ctxRowBlock, hi))
+		}
+	})
+	return ctx.Err()
+}
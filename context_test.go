@@ -0,0 +1,117 @@
+package goimagefreq
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// ctxOperations runs the long-running Ctx entry points on src.
+func ctxOperations(src *Plane) []struct {
+	name string
+	run  func(ctx context.Context, progress ProgressFunc) error
+} {
+	k := GaussianKernel(1.5)
+	kernel := separableKernelPlane(k, k)
+	return []struct {
+		name string
+		run  func(ctx context.Context, progress ProgressFunc) error
+	}{
+		{"RichardsonLucyPlaneCtx", func(ctx context.Context, p ProgressFunc) error {
+			_, err := RichardsonLucyPlaneCtx(ctx, src, k, k, 5, Edge{}, p)
+			return err
+		}},
+		{"AtrousWaveletPlaneCtx", func(ctx context.Context, p ProgressFunc) error {
+			_, _, err := AtrousWaveletPlaneCtx(ctx, src, 4, Edge{}, p)
+			return err
+		}},
+		{"MultiBandPlaneCtx", func(ctx context.Context, p ProgressFunc) error {
+			_, _, err := MultiBandPlaneCtx(ctx, src, 3, 1, Edge{}, p)
+			return err
+		}},
+		{"SWTDenoisePlaneCtx", func(ctx context.Context, p ProgressFunc) error {
+			_, err := SWTDenoisePlaneCtx(ctx, src, []float32{3, 2, 1}, true, Edge{}, p)
+			return err
+		}},
+		{"DWTPlaneCtx", func(ctx context.Context, p ProgressFunc) error {
+			_, err := DWTPlaneCtx(ctx, src, Haar(), 3, p)
+			return err
+		}},
+		{"GaussianBlurPlaneCtx", func(ctx context.Context, p ProgressFunc) error {
+			_, err := GaussianBlurPlaneCtx(ctx, src, 2, Edge{}, p)
+			return err
+		}},
+		{"Convolve2DSeparablePlaneCtx", func(ctx context.Context, p ProgressFunc) error {
+			_, err := Convolve2DSeparablePlaneCtx(ctx, src, k, k, Edge{}, p)
+			return err
+		}},
+		{"ConvolveFFTPlaneCtx", func(ctx context.Context, p ProgressFunc) error {
+			_, err := ConvolveFFTPlaneCtx(ctx, src, kernel, Edge{}, p)
+			return err
+		}},
+		{"NonLocalMeansFastPlaneCtx", func(ctx context.Context, p ProgressFunc) error {
+			_, err := NonLocalMeansFastPlaneCtx(ctx, src, NLMParams{SearchRadius: 3}, Edge{}, p)
+			return err
+		}},
+		{"BM3DPlaneCtx", func(ctx context.Context, p ProgressFunc) error {
+			_, err := BM3DPlaneCtx(ctx, src, BM3DParams{SearchRadius: 4, MaxMatches: 4}, p)
+			return err
+		}},
+	}
+}
+
+func TestCtxProgressReachesTotal(t *testing.T) {
+	src := randomPlane(rand.New(rand.NewSource(24)), 40, 32)
+	for _, op := range ctxOperations(src) {
+		var calls [][2]int
+		err := op.run(context.Background(), func(done, total int) {
+			calls = append(calls, [2]int{done, total})
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", op.name, err)
+		}
+		if len(calls) == 0 {
+			t.Errorf("%s: no progress reported", op.name)
+			continue
+		}
+		total := calls[0][1]
+		for i, c := range calls {
+			if c[1] != total || c[0] < 1 || c[0] > total || (i > 0 && c[0] <= calls[i-1][0]) {
+				t.Errorf("%s: progress calls %v", op.name, calls)
+				break
+			}
+		}
+		if last := calls[len(calls)-1]; last[0] != total {
+			t.Errorf("%s: progress ends at %d/%d", op.name, last[0], last[1])
+		}
+	}
+}
+
+func TestCtxCanceled(t *testing.T) {
+	src := randomPlane(rand.New(rand.NewSource(25)), 40, 32)
+	for _, op := range ctxOperations(src) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := op.run(ctx, nil); !errors.Is(err, context.Canceled) {
+			t.Errorf("%s canceled before the start: got %v", op.name, err)
+		}
+
+		// Canceled after the first step: nothing more is
+		// reported and the error is returned.
+		ctx, cancel = context.WithCancel(context.Background())
+		steps, total := 0, 0
+		err := op.run(ctx, func(done, n int) {
+			steps, total = steps+1, n
+			cancel()
+		})
+		cancel()
+		if total == 1 && err == nil {
+			// a single-step operation is done at its first step
+			continue
+		}
+		if !errors.Is(err, context.Canceled) || steps != 1 {
+			t.Errorf("%s canceled after the first step: got %v after %d steps", op.name, err, steps)
+		}
+	}
+}
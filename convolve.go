@@ -1,142 +1,185 @@
 // Parallel separable convolution
 package goimagefreq
 
-import (
-	"runtime"
-	"sync"
-)
+import "context"
 
-// Convolve1D performs separable 1D convolution
+// Convolve1DPlane performs separable 1D convolution
 // either horizontally or vertically.
 //
-// Edge handling: clamp-to-edge (replication).
+// Samples outside the image are read according to edge.
 //
 // This is the building block for Gaussian blur,
 // wavelets, and multiband decomposition.
-func Convolve1D(src [][]float32, kernel []float64, horizontal bool) [][]float32 {
-	h := len(src)
-	w := len(src[0])
-	r := len(kernel) / 2
+func Convolve1DPlane(src *Plane, kernel []float64, horizontal bool, edge Edge) *Plane {
+	out, err := Convolve1DPlaneCtx(context.Background(), src, kernel, horizontal, edge, nil)
+	panicOnError(err)
+	return out
+}
 
-	out := make([][]float32, h)
-	for y := range out {
-		out[y] = make([]float32, w)
+// Convolve1DPlaneCtx is Convolve1DPlane with cancellation and
+// input validation; a nil or empty kernel is rejected. It
+// reports one progress step.
+func Convolve1DPlaneCtx(ctx context.Context, src *Plane, kernel []float64, horizontal bool, edge Edge, progress ProgressFunc) (*Plane, error) {
+	if err := validateSameSize(src); err != nil {
+		return nil, err
 	}
+	if err := validateKernel("1D", kernel); err != nil {
+		return nil, err
+	}
+	if err := edge.validate(); err != nil {
+		return nil, err
+	}
+	out, err := convolve1D(ctx, src, kernel, horizontal, edge)
+	if err != nil {
+		return nil, err
+	}
+	progress.report(1, 1)
+	return out, nil
+}
 
-	workers := runtime.GOMAXPROCS(0)
-	jobs := make(chan int, h)
-	wg := sync.WaitGroup{}
-
-	for i := 0; i < workers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for y := range jobs {
-				if horizontal {
-					for x := 0; x < w; x++ {
-						acc := float64(0)
-						for k := -r; k <= r; k++ {
-							xx := x + k
-							if xx < 0 {
-								xx = 0
-							}
-							if xx >= w {
-								xx = w - 1
-							}
-							acc += float64(src[y][xx]) * kernel[k+r]
-						}
-						out[y][x] = float32(acc)
-					}
-				} else {
-					for x := 0; x < w; x++ {
-						acc := float64(0)
-						for k := -r; k <= r; k++ {
-							yy := y + k
-							if yy < 0 {
-								yy = 0
-							}
-							if yy >= h {
-								yy = h - 1
-							}
-							acc += float64(src[yy][x]) * kernel[k+r]
-						}
-						out[y][x] = float32(acc)
+// convolve1D is Convolve1DPlane stopping early once ctx is
+// canceled.
+func convolve1D(ctx context.Context, src *Plane, kernel []float64, horizontal bool, edge Edge) (*Plane, error) {
+	h := src.H
+	w := src.W
+	r := len(kernel) / 2
+
+	out := NewPlane(w, h)
+
+	if horizontal {
+		err := parallelChunksCtx(ctx, h, func(lo, hi int) {
+			ext := make([]float32, w+2*r)
+			for y := lo; y < hi; y++ {
+				edge.extendRow(ext, src.Row(y), r)
+				dst := out.Row(y)
+				for x := 0; x < w; x++ {
+					acc := float64(0)
+					win := ext[x:]
+					for k, kv := range kernel {
+						acc += float64(win[k]) * kv
 					}
+					dst[x] = float32(acc)
 				}
 			}
-		}()
+		})
+		if err != nil {
+			return nil, err
+		}
+		return out, nil
 	}
 
-	for y := 0; y < h; y++ {
-		jobs <- y
+	err := parallelChunksCtx(ctx, h, func(lo, hi int) {
+		acc := make([]float64, w)
+		for y := lo; y < hi; y++ {
+			for x := range acc {
+				acc[x] = 0
+			}
+			for k, kv := range kernel {
+				yy, ok := edge.index(y+k-r, h)
+				if !ok {
+					c := float64(edge.fill()) * kv
+					for x := range acc {
+						acc[x] += c
+					}
+					continue
+				}
+				for x, v := range src.Row(yy) {
+					acc[x] += float64(v) * kv
+				}
+			}
+			dst := out.Row(y)
+			for x := range dst {
+				dst[x] = float32(acc[x])
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
 	}
-	close(jobs)
-	wg.Wait()
+	return out, nil
+}
 
-	return out
+// Convolve1D is the [][]float32 adapter for Convolve1DPlane
+// (clamp-to-edge).
+func Convolve1D(src [][]float32, kernel []float64, horizontal bool) [][]float32 {
+	return Convolve1DPlane(PlaneFromRows(src), kernel, horizontal, Edge{}).Rows()
 }
 
-func Convolve2DGeneric(src [][]float32, kernel [][]float32) [][]float32 {
-	h := len(src)
-	w := len(src[0])
-	kh := len(kernel)
-	kw := len(kernel[0])
+// Convolve2DGenericPlane convolves src with an arbitrary
+// (non-separable) 2D kernel. Cost is O(W·H·kw·kh).
+//
+// Kernels larger than FFTConvolveThreshold taps are
+// convolved with ConvolveFFTPlane instead.
+//
+// Samples outside the image are read according to edge.
+func Convolve2DGenericPlane(src *Plane, kernel *Plane, edge Edge) *Plane {
+	out, err := Convolve2DGenericPlaneCtx(context.Background(), src, kernel, edge, nil)
+	panicOnError(err)
+	return out
+}
 
-	ry := kh / 2
-	rx := kw / 2
+// Convolve2DGenericPlaneCtx is Convolve2DGenericPlane with
+// cancellation. The direct path is one progress step; the
+// FFT path reports one step per tile.
+func Convolve2DGenericPlaneCtx(ctx context.Context, src *Plane, kernel *Plane, edge Edge, progress ProgressFunc) (*Plane, error) {
+	if err := validateConv2D(src, kernel, edge); err != nil {
+		return nil, err
+	}
 
-	out := make([][]float32, h)
-	for y := range out {
-		out[y] = make([]float32, w)
+	if kernel.W*kernel.H > FFTConvolveThreshold {
+		return ConvolveFFTPlaneCtx(ctx, src, kernel, edge, progress)
 	}
 
-	workers := runtime.GOMAXPROCS(0)
-	jobs := make(chan int, h)
-	wg := sync.WaitGroup{}
+	h := src.H
+	w := src.W
+	kh := kernel.H
+	kw := kernel.W
 
-	for i := 0; i < workers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for y := range jobs {
+	ry := kh / 2
+	rx := kw / 2
+
+	out := NewPlane(w, h)
+
+	err := parallelChunksCtx(ctx, h, func(lo, hi int) {
+		ext := make([]float32, w+2*rx)
+		fill := make([]float32, w)
+		for x := range fill {
+			fill[x] = edge.fill()
+		}
+		for y := lo; y < hi; y++ {
+			dst := out.Row(y)
+			for ky := 0; ky < kh; ky++ {
+				row := fill
+				if yy, ok := edge.index(y+ky-ry, h); ok {
+					row = src.Row(yy)
+				}
+				edge.extendRow(ext, row, rx)
+				krow := kernel.Row(ky)
 				for x := 0; x < w; x++ {
-					acc := float32(0)
-					for ky := -ry; ky <= ry; ky++ {
-						yy := y + ky
-						if yy < 0 {
-							yy = 0
-						}
-						if yy >= h {
-							yy = h - 1
-						}
-						for kx := -rx; kx <= rx; kx++ {
-							xx := x + kx
-							if xx < 0 {
-								xx = 0
-							}
-							if xx >= w {
-								xx = w - 1
-							}
-							acc += src[yy][xx] *
-								kernel[ky+ry][kx+rx]
-						}
+					acc := dst[x]
+					win := ext[x:]
+					for kx, kv := range krow {
+						acc += win[kx] * kv
 					}
-					out[y][x] = acc
+					dst[x] = acc
 				}
 			}
-		}()
+		}
+	})
+	if err != nil {
+		return nil, err
 	}
+	progress.report(1, 1)
+	return out, nil
+}
 
-	for y := 0; y < h; y++ {
-		jobs <- y
-	}
-	close(jobs)
-	wg.Wait()
-
-	return out
+// Convolve2DGeneric is the [][]float32 adapter for Convolve2DGenericPlane
+// (clamp-to-edge).
+func Convolve2DGeneric(src [][]float32, kernel [][]float32) [][]float32 {
+	return Convolve2DGenericPlane(PlaneFromRows(src), PlaneFromRows(kernel), Edge{}).Rows()
 }
 
-// Convolve2DSeparable performs a full 2D convolution using
+// Convolve2DSeparablePlane performs a full 2D convolution using
 // two 1D convolutions (horizontal then vertical).
 //
 // This is mathematically equivalent to 2D convolution
@@ -145,15 +188,61 @@ func Convolve2DGeneric(src [][]float32, kernel [][]float32) [][]float32 {
 //	K(x, y) = ky(y) * kx(x)
 //
 // This is the preferred method for Gaussian / PSF convolution.
-func Convolve2DSeparable(
-	src [][]float32,
+// Very long kernels (len(kx)+len(ky) > FFTSeparableThreshold)
+// are convolved in the frequency domain.
+func Convolve2DSeparablePlane(
+	src *Plane,
 	kx []float64,
 	ky []float64,
-) [][]float32 {
+	edge Edge,
+) *Plane {
+	out, err := Convolve2DSeparablePlaneCtx(context.Background(), src, kx, ky, edge, nil)
+	panicOnError(err)
+	return out
+}
+
+// Convolve2DSeparablePlaneCtx is Convolve2DSeparablePlane with
+// cancellation. It reports two progress steps (horizontal and
+// vertical pass), or one per tile on the FFT path.
+func Convolve2DSeparablePlaneCtx(
+	ctx context.Context,
+	src *Plane,
+	kx []float64,
+	ky []float64,
+	edge Edge,
+	progress ProgressFunc,
+) (*Plane, error) {
+
+	if err := validateSeparable(src, kx, ky, edge); err != nil {
+		return nil, err
+	}
+
+	if len(kx)+len(ky) > FFTSeparableThreshold {
+		return ConvolveFFTPlaneCtx(ctx, src, separableKernelPlane(kx, ky), edge, progress)
+	}
 
 	// Horizontal pass
-	tmp := Convolve1D(src, kx, true)
+	tmp, err := convolve1D(ctx, src, kx, true, edge)
+	if err != nil {
+		return nil, err
+	}
+	progress.report(1, 2)
 
 	// Vertical pass
-	return Convolve1D(tmp, ky, false)
+	out, err := convolve1D(ctx, tmp, ky, false, edge)
+	if err != nil {
+		return nil, err
+	}
+	progress.report(2, 2)
+	return out, nil
+}
+
+// Convolve2DSeparable is the [][]float32 adapter for Convolve2DSeparablePlane
+// (clamp-to-edge).
+func Convolve2DSeparable(
+	src [][]float32,
+	kx []float64,
+	ky []float64,
+) [][]float32 {
+	return Convolve2DSeparablePlane(PlaneFromRows(src), kx, ky, Edge{}).Rows()
 }
@@ -0,0 +1,155 @@
+// FFT convolution for large kernels
+package goimagefreq
+
+import "context"
+
+// FFTConvolveThreshold is the kernel area (kw·kh) above which
+// Convolve2DGenericPlane switches to the FFT path.
+//
+// Set it very high to force direct convolution.
+var FFTConvolveThreshold = 7 * 7
+
+// FFTSeparableThreshold is the combined tap count (len(kx)+len(ky))
+// above which Convolve2DSeparablePlane switches to the FFT path.
+var FFTSeparableThreshold = 128
+
+// fftTileSize is the FFT size used for overlap-add tiling once
+// the padded image no longer fits in a single transform.
+const fftTileSize = 512
+
+// ConvolveFFTPlane convolves src with an arbitrary 2D kernel in
+// the frequency domain.
+//
+// The result matches Convolve2DGenericPlane (same kernel
+// orientation and edge handling) within float32 rounding,
+// at a cost independent of the kernel size.
+//
+// Large images are processed by overlap-add: the edge-extended
+// image is cut into tiles, each tile is convolved with one FFT
+// and the overlapping tails are summed into the output.
+func ConvolveFFTPlane(src *Plane, kernel *Plane, edge Edge) *Plane {
+	out, err := ConvolveFFTPlaneCtx(context.Background(), src, kernel, edge, nil)
+	panicOnError(err)
+	return out
+}
+
+// ConvolveFFTPlaneCtx is ConvolveFFTPlane with cancellation,
+// checked between tiles. It reports one progress step per
+// tile.
+func ConvolveFFTPlaneCtx(ctx context.Context, src *Plane, kernel *Plane, edge Edge, progress ProgressFunc) (*Plane, error) {
+	if err := validateConv2D(src, kernel, edge); err != nil {
+		return nil, err
+	}
+
+	h, w := src.H, src.W
+	kh, kw := kernel.H, kernel.W
+	out := NewPlane(w, h)
+
+	ry := kh / 2
+	rx := kw / 2
+
+	// Edge-extended image E has size (H+kh-1)×(W+kw-1);
+	// E(Y, X) = src(Y-ry, X-rx) read through the edge mode.
+	he := h + kh - 1
+	we := w + kw - 1
+
+	nx := fftConvSize(we, kw)
+	ny := fftConvSize(he, kh)
+	bx := nx - (kw - 1) // tile size in E
+	by := ny - (kh - 1)
+
+	// Flipped kernel: the direct path correlates, so the FFT
+	// path convolves with K(kh-1-j, kw-1-i).
+	kp := NewPlane(nx, ny)
+	for j := 0; j < kh; j++ {
+		krow := kernel.Row(kh - 1 - j)
+		dst := kp.Row(j)
+		for i := 0; i < kw; i++ {
+			dst[i] = krow[kw-1-i]
+		}
+	}
+	kspec := FFT2D(kp)
+
+	tiles := ((he + by - 1) / by) * ((we + bx - 1) / bx)
+	done := 0
+	tile := NewPlane(nx, ny)
+	for ty := 0; ty < he; ty += by {
+		for tx := 0; tx < we; tx += bx {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			tile.Fill(0)
+			th := min(by, he-ty)
+			tw := min(bx, we-tx)
+			parallelRows(th, func(j int) {
+				dst := tile.Row(j)
+				sy, ok := edge.index(ty+j-ry, h)
+				if !ok {
+					for i := 0; i < tw; i++ {
+						dst[i] = edge.fill()
+					}
+					return
+				}
+				srow := src.Row(sy)
+				for i := 0; i < tw; i++ {
+					dst[i] = edge.sample(srow, tx+i-rx)
+				}
+			})
+
+			spec := FFT2D(tile)
+			spec.Mul(kspec)
+			conv := IFFT2D(spec)
+
+			// Full-convolution sample (Y, X) of the tile lands at
+			// E-position (ty+Y, tx+X); the output keeps
+			// E-positions shifted by (kh-1, kw-1).
+			y0 := max(0, ty-(kh-1))
+			y1 := min(h, ty+th)
+			x0 := max(0, tx-(kw-1))
+			x1 := min(w, tx+tw)
+			parallelRows(y1-y0, func(j int) {
+				y := y0 + j
+				crow := conv.Row(y + kh - 1 - ty)
+				orow := out.Row(y)
+				for x := x0; x < x1; x++ {
+					orow[x] += crow[x+kw-1-tx]
+				}
+			})
+			done++
+			progress.report(done, tiles)
+		}
+	}
+
+	return out, nil
+}
+
+// ConvolveFFT is the [][]float32 adapter for ConvolveFFTPlane
+// (clamp-to-edge).
+func ConvolveFFT(src [][]float32, kernel [][]float32) [][]float32 {
+	return ConvolveFFTPlane(PlaneFromRows(src), PlaneFromRows(kernel), Edge{}).Rows()
+}
+
+// fftConvSize picks the FFT length along one axis for an
+// extended length n and kernel length k: a single transform
+// when it is small enough, fftTileSize-sized tiles otherwise.
+func fftConvSize(n, k int) int {
+	single := NextFastFFTSize(n + k - 1)
+	if single <= fftTileSize {
+		return single
+	}
+	// Keep tiles at least as large as the kernel tail so
+	// overlap-add does useful work per transform.
+	return NextFastFFTSize(max(fftTileSize, 4*(k-1)))
+}
+
+// separableKernelPlane builds the 2D kernel ky ⊗ kx.
+func separableKernelPlane(kx, ky []float64) *Plane {
+	k := NewPlane(len(kx), len(ky))
+	for j, vy := range ky {
+		row := k.Row(j)
+		for i, vx := range kx {
+			row[i] = float32(vy * vx)
+		}
+	}
+	return k
+}
@@ -0,0 +1,82 @@
+package goimagefreq
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestConvolveFFTMatchesDirect(t *testing.T) {
+	r := rand.New(rand.NewSource(5))
+	tests := []struct {
+		name       string
+		w, h       int
+		kw, kh     int
+		wantTiling bool
+	}{
+		{"single transform", 37, 29, 9, 9, false},
+		{"even kernel", 40, 31, 8, 6, false},
+		{"kernel larger than image", 6, 5, 11, 9, false},
+		{"tiled horizontally", 560, 24, 9, 7, true},
+		{"tiled vertically", 20, 530, 5, 11, true},
+		{"tiled both ways", 530, 520, 7, 7, true},
+	}
+	for _, tt := range tests {
+		tiled := fftConvSize(tt.w+tt.kw-1, tt.kw) < tt.w+2*(tt.kw-1) ||
+			fftConvSize(tt.h+tt.kh-1, tt.kh) < tt.h+2*(tt.kh-1)
+		if tiled != tt.wantTiling {
+			t.Fatalf("%s: tiling = %v, test expects %v", tt.name, tiled, tt.wantTiling)
+		}
+		src := randomPlane(r, tt.w, tt.h)
+		kernel := randomPlane(r, tt.kw, tt.kh)
+		for _, e := range testEdges {
+			name := fmt.Sprintf("%s %s", tt.name, edgeName(e))
+			var want *Plane
+			withThresholds(1<<30, 1<<30, func() {
+				want = Convolve2DGenericPlane(src, kernel, e)
+			})
+			got := ConvolveFFTPlane(src, kernel, e)
+			// Kernel sums reach ~kw·kh/2; allow float32 FFT
+			// rounding relative to that.
+			tol := 1e-5 * float32(tt.kw*tt.kh)
+			if err := MaxAbsErrorPlane(got, want); err > tol {
+				t.Errorf("%s: FFT differs from direct by %g", name, err)
+			}
+		}
+	}
+}
+
+func TestConvolveGenericSwitchesToFFT(t *testing.T) {
+	r := rand.New(rand.NewSource(6))
+	src := randomPlane(r, 33, 21)
+	kernel := randomPlane(r, 9, 9)
+	for _, e := range testEdges {
+		want := refConvolve(src, kernel, e)
+		var got *Plane
+		withThresholds(1, 1<<30, func() {
+			got = Convolve2DGenericPlane(src, kernel, e)
+		})
+		if err := MaxAbsErrorPlane(got, want); err > 1e-3 {
+			t.Errorf("%s: FFT path of Convolve2DGenericPlane differs by %g", edgeName(e), err)
+		}
+	}
+}
+
+func TestConvolveSeparableFFTMatchesDirect(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	src := randomPlane(r, 70, 45)
+	kx := GaussianKernel(9)  // 55 taps
+	ky := GaussianKernel(12) // 73 taps
+	for _, e := range testEdges {
+		var want, got *Plane
+		withThresholds(1<<30, 1<<30, func() {
+			want = Convolve2DSeparablePlane(src, kx, ky, e)
+		})
+		withThresholds(1<<30, 1, func() {
+			got = Convolve2DSeparablePlane(src, kx, ky, e)
+		})
+		if err := MaxAbsErrorPlane(got, want); err > 1e-5 {
+			t.Errorf("%s: separable FFT path differs by %g", edgeName(e), err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package goimagefreq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// testEdges lists every edge mode.
+var testEdges = []Edge{
+	{Mode: EdgeClamp},
+	{Mode: EdgeMirror},
+	{Mode: EdgeWrap},
+	{Mode: EdgeZero},
+	ConstantEdge(0.75),
+}
+
+func edgeName(e Edge) string {
+	return [...]string{"clamp", "mirror", "wrap", "zero", "constant"}[e.Mode]
+}
+
+// refSample reads src(x, y) outside the image as documented
+// for each edge mode, independently of Edge.index.
+func refSample(src *Plane, x, y int, e Edge) float32 {
+	axis := func(i, n int) (int, bool) {
+		switch e.Mode {
+		case EdgeClamp:
+			return max(0, min(i, n-1)), true
+		case EdgeMirror:
+			// dcb|abcd|cba, repeated.
+			for i < 0 || i >= n {
+				if n == 1 {
+					return 0, true
+				}
+				if i < 0 {
+					i = -i
+				} else {
+					i = 2*(n-1) - i
+				}
+			}
+			return i, true
+		case EdgeWrap:
+			return ((i % n) + n) % n, true
+		}
+		return i, i >= 0 && i < n
+	}
+	xx, okx := axis(x, src.W)
+	yy, oky := axis(y, src.H)
+	if !okx || !oky {
+		if e.Mode == EdgeConstant {
+			return e.Value
+		}
+		return 0
+	}
+	return src.At(xx, yy)
+}
+
+// refConvolve is the direct definition used by the package:
+// out(x, y) = Σ K(j, i)·src(x+i−kw/2, y+j−kh/2).
+func refConvolve(src, kernel *Plane, e Edge) *Plane {
+	out := NewPlane(src.W, src.H)
+	for y := 0; y < src.H; y++ {
+		for x := 0; x < src.W; x++ {
+			var s float64
+			for j := 0; j < kernel.H; j++ {
+				for i := 0; i < kernel.W; i++ {
+					v := refSample(src, x+i-kernel.W/2, y+j-kernel.H/2, e)
+					s += float64(kernel.At(i, j)) * float64(v)
+				}
+			}
+			out.Set(x, y, float32(s))
+		}
+	}
+	return out
+}
+
+func randomPlane(r *rand.Rand, w, h int) *Plane {
+	p := NewPlane(w, h)
+	for i := range p.Data {
+		p.Data[i] = r.Float32()
+	}
+	return p
+}
+
+// withThresholds runs fn with the FFT switch-over
+// thresholds temporarily replaced.
+func withThresholds(conv2D, separable int, fn func()) {
+	old2D, oldSep := FFTConvolveThreshold, FFTSeparableThreshold
+	FFTConvolveThreshold, FFTSeparableThreshold = conv2D, separable
+	defer func() { FFTConvolveThreshold, FFTSeparableThreshold = old2D, oldSep }()
+	fn()
+}
+
+func TestConvolveDirectEdgeModes(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	sizes := []struct{ w, h, kw, kh int }{
+		{9, 7, 3, 3},
+		{6, 5, 5, 3},
+		{4, 4, 7, 7}, // kernel wider than the image: mirror and wrap fold repeatedly
+		{1, 6, 3, 5},
+		{8, 3, 4, 2}, // even kernel
+	}
+	withThresholds(1<<30, 1<<30, func() {
+		for _, sz := range sizes {
+			src := randomPlane(r, sz.w, sz.h)
+			kernel := randomPlane(r, sz.kw, sz.kh)
+			for _, e := range testEdges {
+				name := fmt.Sprintf("%dx%d kernel %dx%d %s", sz.w, sz.h, sz.kw, sz.kh, edgeName(e))
+				want := refConvolve(src, kernel, e)
+				if err := MaxAbsErrorPlane(Convolve2DGenericPlane(src, kernel, e), want); err > 1e-5 {
+					t.Errorf("%s: Convolve2DGenericPlane error %g", name, err)
+				}
+			}
+		}
+	})
+}
+
+func TestConvolveSeparableEdgeModes(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	src := randomPlane(r, 11, 8)
+	kx := []float64{0.1, 0.2, 0.4, 0.2, 0.1}
+	ky := []float64{0.25, 0.5, 0.25}
+	withThresholds(1<<30, 1<<30, func() {
+		for _, e := range testEdges {
+			want := refConvolve(src, separableKernelPlane(kx, ky), e)
+			got := Convolve2DSeparablePlane(src, kx, ky, e)
+			if err := MaxAbsErrorPlane(got, want); err > 1e-5 {
+				t.Errorf("%s: Convolve2DSeparablePlane error %g", edgeName(e), err)
+			}
+		}
+	})
+}
+
+func TestConvolve1DPlaneCtx(t *testing.T) {
+	src := randomPlane(rand.New(rand.NewSource(13)), 10, 7)
+	k := []float64{0.1, 0.3, 0.4, 0.2}
+	for _, e := range testEdges {
+		for _, horizontal := range []bool{true, false} {
+			kernel := separableKernelPlane(k, []float64{1})
+			if !horizontal {
+				kernel = separableKernelPlane([]float64{1}, k)
+			}
+			got, err := Convolve1DPlaneCtx(context.Background(), src, k, horizontal, e, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := MaxAbsErrorPlane(got, refConvolve(src, kernel, e)); err > 1e-6 {
+				t.Errorf("%s horizontal %v: error %g", edgeName(e), horizontal, err)
+			}
+		}
+	}
+
+	for _, k := range [][]float64{nil, {}} {
+		if _, err := Convolve1DPlaneCtx(context.Background(), src, k, true, Edge{}, nil); !errors.Is(err, ErrInvalidParameter) {
+			t.Errorf("kernel %v: got %v, want ErrInvalidParameter", k, err)
+		}
+	}
+	if _, err := Convolve1DPlaneCtx(context.Background(), &Plane{}, k, true, Edge{}, nil); !errors.Is(err, ErrEmptyImage) {
+		t.Errorf("empty image: got %v", err)
+	}
+}
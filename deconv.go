@@ -1,21 +1,136 @@
 // Deconvolution
 package goimagefreq
 
-func RichardsonLucy(
-	L [][]float32,
+import (
+	"context"
+	"math"
+)
+
+// RichardsonLucyPlane deconvolves L with the separable
+// PSF kx ⊗ ky using the Richardson–Lucy iteration.
+//
+// edge is used by both the forward blur and the
+// back-projection, so the border model stays consistent.
+func RichardsonLucyPlane(
+	L *Plane,
 	kx []float64,
 	ky []float64,
 	iterations int,
-) [][]float32 {
+	edge Edge,
+) *Plane {
+	out, err := RichardsonLucyPlaneCtx(context.Background(), L, kx, ky, iterations, edge, nil)
+	panicOnError(err)
+	return out
+}
+
+// RichardsonLucyPlaneCtx is RichardsonLucyPlane with
+// cancellation, checked inside every convolution. It reports
+// one progress step per iteration.
+func RichardsonLucyPlaneCtx(
+	ctx context.Context,
+	L *Plane,
+	kx []float64,
+	ky []float64,
+	iterations int,
+	edge Edge,
+	progress ProgressFunc,
+) (*Plane, error) {
+	out, _, err := richardsonLucy(ctx, L, kx, ky, iterations, edge, RLOptions{}, progress, false)
+	return out, err
+}
+
+// RichardsonLucyOptsPlane is RichardsonLucyPlane regularized
+// as opts selects, so that more iterations sharpen further
+// instead of amplifying noise, and optionally damped
+// (opts.Damping) and deringed (opts.Dering).
+//
+// iterations is the cap: the iteration stops earlier once
+// the estimate changes less than opts.Tolerance or the
+// residual reaches opts.StopChiSquare. The returned RLStats
+// tell how many iterations ran and how each went.
+func RichardsonLucyOptsPlane(
+	L *Plane,
+	kx []float64,
+	ky []float64,
+	iterations int,
+	edge Edge,
+	opts RLOptions,
+) (*Plane, RLStats) {
+	out, stats, err := RichardsonLucyOptsPlaneCtx(context.Background(), L, kx, ky, iterations, edge, opts, nil)
+	panicOnError(err)
+	return out, stats
+}
+
+// RichardsonLucyOptsPlaneCtx is RichardsonLucyOptsPlane with
+// cancellation. It reports one progress step per iteration,
+// and completes the total when it stops early.
+func RichardsonLucyOptsPlaneCtx(
+	ctx context.Context,
+	L *Plane,
+	kx []float64,
+	ky []float64,
+	iterations int,
+	edge Edge,
+	opts RLOptions,
+	progress ProgressFunc,
+) (*Plane, RLStats, error) {
+	return richardsonLucy(ctx, L, kx, ky, iterations, edge, opts, progress, true)
+}
+
+// richardsonLucy runs the iteration. Without withStats the
+// per-iteration residual and change are only computed when a
+// stopping test needs them, and the stats are left empty.
+func richardsonLucy(
+	ctx context.Context,
+	L *Plane,
+	kx []float64,
+	ky []float64,
+	iterations int,
+	edge Edge,
+	opts RLOptions,
+	progress ProgressFunc,
+	withStats bool,
+) (*Plane, RLStats, error) {
+
+	if err := validateSeparable(L, kx, ky, edge); err != nil {
+		return nil, RLStats{}, err
+	}
+	if err := validateCount("iterations", iterations); err != nil {
+		return nil, RLStats{}, err
+	}
+	opts = opts.withDefaults()
+	if err := opts.validate(); err != nil {
+		return nil, RLStats{}, err
+	}
+	if err := opts.Dering.validate(L); err != nil {
+		return nil, RLStats{}, err
+	}
 
-	h := len(L)
-	w := len(L[0])
+	h := L.H
+	w := L.W
+
+	// The noise is only estimated when something uses it;
+	// otherwise χ² is reported as NaN.
+	sigma := opts.Sigma
+	needSigma := opts.Regularization == RLWavelet || opts.Damping > 0 || opts.StopChiSquare > 0
+	if sigma == 0 && needSigma {
+		s, err := estimateNoiseSigma(ctx, L, edge)
+		if err != nil {
+			return nil, RLStats{}, err
+		}
+		sigma = s
+	}
+	haveSigma := opts.Sigma > 0 || needSigma
+	damping := opts.Damping * sigma
+
+	wantResidual := withStats || opts.StopChiSquare > 0
+	wantChange := withStats || opts.Tolerance > 0
 
 	// Initial estimate = observed image
-	estimate := make([][]float32, h)
-	for y := range estimate {
-		estimate[y] = make([]float32, w)
-		copy(estimate[y], L[y])
+	estimate := L.Clone()
+	var prev *Plane
+	if wantChange {
+		prev = NewPlane(w, h)
 	}
 
 	// Flipped PSF (adjoint operator)
@@ -24,36 +139,140 @@ func RichardsonLucy(
 
 	const eps = 1e-6
 
+	ratio := NewPlane(w, h)
+	var stats RLStats
+
 	for it := 0; it < iterations; it++ {
 
 		// Blur current estimate
-		blur := Convolve2DSeparable(estimate, kx, ky)
+		blur, err := Convolve2DSeparablePlaneCtx(ctx, estimate, kx, ky, edge, nil)
+		if err != nil {
+			return nil, RLStats{}, err
+		}
 
-		// Ratio image
-		ratio := make([][]float32, h)
+		// Residual against the noise
+		var rms, chi2 float64
+		if wantResidual {
+			rms, chi2 = rlResidual(L, blur, sigma)
+			if !haveSigma {
+				chi2 = math.NaN()
+			}
+		}
+		if opts.StopChiSquare > 0 && chi2 <= float64(opts.StopChiSquare) {
+			stats.Stopped = RLStoppedChiSquare
+			stats.Residual, stats.ChiSquare = rms, chi2
+			break
+		}
+
+		// Observed image, or its significant part
+		observed := L
+		if opts.Regularization == RLWavelet {
+			res, err := significantResidual(ctx, L, blur, opts, sigma, edge)
+			if err != nil {
+				return nil, RLStats{}, err
+			}
+			observed = res
+			parallelRows(h, func(y int) {
+				o, bl := res.Row(y), blur.Row(y)
+				for x := range o {
+					o[x] += bl[x]
+				}
+			})
+		}
+
+		// Ratio image, damped where the fit is within noise
 		for y := 0; y < h; y++ {
-			ratio[y] = make([]float32, w)
+			obs, bl, rt := observed.Row(y), blur.Row(y), ratio.Row(y)
 			for x := 0; x < w; x++ {
-				if blur[y][x] > eps {
-					ratio[y][x] = L[y][x] / blur[y][x]
+				if bl[x] > eps {
+					rt[x] = obs[x] / bl[x]
+					if damping > 0 {
+						rt[x] = dampedRatio(obs[x], bl[x], damping)
+					}
 				} else {
-					ratio[y][x] = 0
+					rt[x] = 0
 				}
 			}
 		}
 
 		// Back-project correction
-		corr := Convolve2DSeparable(ratio, kxFlip, kyFlip)
+		corr, err := Convolve2DSeparablePlaneCtx(ctx, ratio, kxFlip, kyFlip, edge, nil)
+		if err != nil {
+			return nil, RLStats{}, err
+		}
+
+		// TV penalty of the current estimate
+		if opts.Regularization == RLTotalVariation {
+			div := tvDivergence(estimate)
+			parallelRows(h, func(y int) {
+				c, d := corr.Row(y), div.Row(y)
+				for x := range c {
+					c[x] /= 1 - opts.Lambda*d[x]
+				}
+			})
+		}
 
 		// Update estimate
 		for y := 0; y < h; y++ {
+			est, c := estimate.Row(y), corr.Row(y)
+			if wantChange {
+				copy(prev.Row(y), est)
+			}
 			for x := 0; x < w; x++ {
-				estimate[y][x] *= corr[y][x]
+				est[x] *= c[x]
 			}
 		}
+
+		// Keep rings from digging below the observed image
+		if opts.Dering.enabled() {
+			opts.Dering.apply(estimate, L)
+		}
+
+		var change float64
+		if wantChange {
+			change = relativeChange(prev, estimate)
+		}
+		if withStats {
+			stats.Iterations++
+			stats.Residual, stats.ChiSquare = rms, chi2
+			stats.History = append(stats.History, RLIteration{Change: change, Residual: rms, ChiSquare: chi2})
+		}
+		progress.report(it+1, iterations)
+
+		if opts.Tolerance > 0 && change < float64(opts.Tolerance) {
+			stats.Stopped = RLStoppedTolerance
+			break
+		}
 	}
 
-	return estimate
+	if stats.Stopped != RLStoppedCap {
+		progress.report(iterations, iterations)
+	}
+	return estimate, stats, nil
+}
+
+// RichardsonLucy is the [][]float32 adapter for RichardsonLucyPlane
+// (clamp-to-edge).
+func RichardsonLucy(
+	L [][]float32,
+	kx []float64,
+	ky []float64,
+	iterations int,
+) [][]float32 {
+	return RichardsonLucyPlane(PlaneFromRows(L), kx, ky, iterations, Edge{}).Rows()
+}
+
+// RichardsonLucyOpts is the [][]float32 adapter for
+// RichardsonLucyOptsPlane (clamp-to-edge).
+func RichardsonLucyOpts(
+	L [][]float32,
+	kx []float64,
+	ky []float64,
+	iterations int,
+	opts RLOptions,
+) ([][]float32, RLStats) {
+	out, stats := RichardsonLucyOptsPlane(PlaneFromRows(L), kx, ky, iterations, Edge{}, opts)
+	return out.Rows(), stats
 }
 
 // func flipKernel(k [][]float32) [][]float32 {
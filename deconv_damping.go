@@ -0,0 +1,107 @@
+// Damped Richardson–Lucy and convergence diagnostics
+package goimagefreq
+
+import "math"
+
+// RLStop tells why a Richardson–Lucy iteration stopped.
+type RLStop int
+
+const (
+	// RLStoppedCap means every requested iteration ran.
+	RLStoppedCap RLStop = iota
+	// RLStoppedTolerance means the estimate changed less than
+	// RLOptions.Tolerance.
+	RLStoppedTolerance
+	// RLStoppedChiSquare means the residual reached
+	// RLOptions.StopChiSquare.
+	RLStoppedChiSquare
+)
+
+// RLIteration describes one Richardson–Lucy iteration.
+type RLIteration struct {
+	// Change is the relative change of the estimate,
+	// ‖oₖ₊₁ − oₖ‖ / ‖oₖ‖.
+	Change float64
+	// Residual is the RMS of observed − blurred estimate
+	// before the update, and ChiSquare its reduced χ²
+	// (Residual² / σ²), NaN when σ is neither given nor
+	// estimated (see RLOptions.Sigma).
+	Residual  float64
+	ChiSquare float64
+}
+
+// RLStats reports how a Richardson–Lucy deconvolution went.
+type RLStats struct {
+	Iterations int    // iterations run
+	Stopped    RLStop // why the iteration ended
+
+	// Residual and ChiSquare are the last measured residual:
+	// that of the returned estimate when stopped on χ²,
+	// otherwise that of the estimate before the last update.
+	Residual  float64
+	ChiSquare float64
+
+	History []RLIteration // one entry per iteration run
+}
+
+// rlDampingPower is the exponent N of White's damping
+// function; larger values switch more sharply between
+// damped and undamped pixels.
+const rlDampingPower = 10
+
+// dampedRatio is White's (1994) damped Richardson–Lucy ratio
+// for observed value o, blurred estimate b > 0 and damping
+// threshold t. With U = ((o − b)/t)², the Gaussian-noise
+// form of White's deviance, the ratio is o/b where U ≥ 1 and
+// 1 + U^(N−1)·(N − (N−1)·U)·(o − b)/b below, which goes
+// smoothly to 1 as the fit gets within the noise.
+func dampedRatio(o, b, t float32) float32 {
+	d := float64(o - b)
+	u := d * d / (float64(t) * float64(t))
+	if u >= 1 {
+		return o / b
+	}
+	const n = rlDampingPower
+	return float32(1 + math.Pow(u, n-1)*(n-(n-1)*u)*d/float64(b))
+}
+
+// rlResidual returns the RMS of observed − blur and its
+// reduced χ² for noise sigma.
+func rlResidual(observed, blur *Plane, sigma float32) (rms, chi2 float64) {
+	var ss float64
+	for y := 0; y < observed.H; y++ {
+		o, b := observed.Row(y), blur.Row(y)
+		for x, v := range o {
+			d := float64(v - b[x])
+			ss += d * d
+		}
+	}
+	rms = math.Sqrt(ss / float64(observed.W*observed.H))
+	switch {
+	case sigma > 0:
+		chi2 = rms * rms / (float64(sigma) * float64(sigma))
+	case rms > 0:
+		chi2 = math.Inf(1)
+	}
+	return rms, chi2
+}
+
+// relativeChange returns ‖b − a‖ / ‖a‖.
+func relativeChange(a, b *Plane) float64 {
+	var num, den float64
+	for y := 0; y < a.H; y++ {
+		ar, br := a.Row(y), b.Row(y)
+		for x, v := range ar {
+			d := float64(br[x] - v)
+			num += d * d
+			den += float64(v) * float64(v)
+		}
+	}
+	if den == 0 {
+		if num == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return math.Sqrt(num / den)
+}
@@ -0,0 +1,171 @@
+// Deringing for deconvolution
+package goimagefreq
+
+import (
+	"context"
+	"math"
+)
+
+// Deringing keeps deconvolution from digging dark rings
+// around bright stars by limiting how far below the observed
+// image the estimate may go. The zero value disables it.
+//
+// After every iteration, pixels more than the allowed
+// darkening below the observed image are pulled back toward
+// that floor by Amount of the excess.
+type Deringing struct {
+	// GlobalDark is the ring-dark threshold applied
+	// everywhere, in image units; 0 disables global
+	// deringing.
+	GlobalDark float32
+
+	// Support enables local deringing: a mask in [0, 1],
+	// 1 on stars and their surroundings (see
+	// DeringSupportPlane), where the estimate may go at most
+	// LocalDark below the observed image.
+	Support   *Plane
+	LocalDark float32
+
+	// Amount is the fraction, in (0, 1], of the excess
+	// darkening removed each iteration; 0 means 1.
+	Amount float32
+}
+
+// enabled reports whether any deringing is requested.
+func (d Deringing) enabled() bool {
+	return d.GlobalDark > 0 || d.Support != nil
+}
+
+// validate checks the options for an image like src.
+func (d Deringing) validate(src *Plane) error {
+	if !(d.GlobalDark >= 0) || math.IsInf(float64(d.GlobalDark), 1) {
+		return invalidParam("global dark threshold must be non-negative and finite, got %g", d.GlobalDark)
+	}
+	if !(d.LocalDark >= 0) || math.IsInf(float64(d.LocalDark), 1) {
+		return invalidParam("local dark threshold must be non-negative and finite, got %g", d.LocalDark)
+	}
+	if !(d.Amount >= 0 && d.Amount <= 1) {
+		return invalidParam("deringing amount must be in [0, 1], got %g", d.Amount)
+	}
+	if d.Support != nil {
+		return validateSameSize(src, d.Support)
+	}
+	return nil
+}
+
+// apply deringes estimate in place against the observed
+// image.
+func (d Deringing) apply(estimate, observed *Plane) {
+	amount := d.Amount
+	if amount == 0 {
+		amount = 1
+	}
+	parallelRows(estimate.H, func(y int) {
+		est, obs := estimate.Row(y), observed.Row(y)
+		var sup []float32
+		if d.Support != nil {
+			sup = d.Support.Row(y)
+		}
+		for x, v := range est {
+			if d.GlobalDark > 0 {
+				if floor := obs[x] - d.GlobalDark; v < floor {
+					v += amount * (floor - v)
+				}
+			}
+			if sup != nil && sup[x] > 0 {
+				if floor := obs[x] - d.LocalDark; v < floor {
+					v += amount * float32(math.Min(float64(sup[x]), 1)) * (floor - v)
+				}
+			}
+			est[x] = v
+		}
+	})
+}
+
+// DeringSupportPlane builds a local deringing mask from src:
+// pixels above threshold (stars, bright cores) are grown by
+// radius pixels, far enough to cover their rings, and the
+// mask edge is feathered. The result is in [0, 1].
+func DeringSupportPlane(src *Plane, threshold float32, radius int) *Plane {
+	out, err := DeringSupportPlaneCtx(context.Background(), src, threshold, radius, nil)
+	panicOnError(err)
+	return out
+}
+
+// DeringSupportPlaneCtx is DeringSupportPlane with
+// cancellation and input validation. It reports one progress
+// step.
+func DeringSupportPlaneCtx(ctx context.Context, src *Plane, threshold float32, radius int, progress ProgressFunc) (*Plane, error) {
+	if err := validateSameSize(src); err != nil {
+		return nil, err
+	}
+	if math.IsNaN(float64(threshold)) {
+		return nil, invalidParam("threshold must not be NaN")
+	}
+	if err := validateCount("radius", radius); err != nil {
+		return nil, err
+	}
+
+	mask := NewPlane(src.W, src.H)
+	err := parallelRowsCtx(ctx, src.H, func(y int) {
+		s, m := src.Row(y), mask.Row(y)
+		for x, v := range s {
+			if v > threshold {
+				m[x] = 1
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if radius > 0 {
+		// Square dilation, then a feather of radius/3.
+		if mask, err = maxFilter1D(ctx, mask, radius, true); err != nil {
+			return nil, err
+		}
+		if mask, err = maxFilter1D(ctx, mask, radius, false); err != nil {
+			return nil, err
+		}
+		if radius >= 3 {
+			if mask, err = GaussianBlurPlaneCtx(ctx, mask, float64(radius)/3, Edge{}, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+	progress.report(1, 1)
+	return mask, nil
+}
+
+// DeringSupport is the [][]float32 adapter for
+// DeringSupportPlane.
+func DeringSupport(src [][]float32, threshold float32, radius int) [][]float32 {
+	return DeringSupportPlane(PlaneFromRows(src), threshold, radius).Rows()
+}
+
+// maxFilter1D returns the maximum over ±r pixels along one
+// axis, clamped to the image.
+func maxFilter1D(ctx context.Context, src *Plane, r int, horizontal bool) (*Plane, error) {
+	w, h := src.W, src.H
+	out := NewPlane(w, h)
+	err := parallelRowsCtx(ctx, h, func(y int) {
+		dst := out.Row(y)
+		for x := range dst {
+			var m float32
+			if horizontal {
+				row := src.Row(y)
+				for i := max(x-r, 0); i <= min(x+r, w-1); i++ {
+					m = max(m, row[i])
+				}
+			} else {
+				for j := max(y-r, 0); j <= min(y+r, h-1); j++ {
+					m = max(m, src.Row(j)[x])
+				}
+			}
+			dst[x] = m
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,92 @@
+package goimagefreq
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// maxDarkening is the largest amount by which estimate lies
+// below observed.
+func maxDarkening(estimate, observed *Plane) float32 {
+	var d float32
+	for i, v := range estimate.Data {
+		d = max(d, observed.Data[i]-v)
+	}
+	return d
+}
+
+func TestDeringGlobalDarkFloor(t *testing.T) {
+	noisy, _, k := noisyStars(0.01)
+	const dark = 0.01
+	plain := RichardsonLucyPlane(noisy, k, k, 30, Edge{})
+	if d := maxDarkening(plain, noisy); d <= dark {
+		t.Fatalf("plain RL darkens by only %g, the test needs more", d)
+	}
+	out, _ := RichardsonLucyOptsPlane(noisy, k, k, 30, Edge{}, RLOptions{Dering: Deringing{GlobalDark: dark, Amount: 1}})
+	if d := maxDarkening(out, noisy); d > dark+1e-6 {
+		t.Errorf("estimate goes %g below the observed image, floor is %g", d, dark)
+	}
+}
+
+func TestDeringLocalOnlyInSupport(t *testing.T) {
+	observed := NewPlane(16, 8)
+	observed.Fill(0.5)
+	support := NewPlane(16, 8)
+	for y := 2; y < 6; y++ {
+		for x := 4; x < 10; x++ {
+			support.Set(x, y, 1)
+		}
+	}
+	support.Set(10, 3, 0.5)
+
+	estimate := NewPlane(16, 8)
+	estimate.Fill(0.2)
+	Deringing{Support: support, LocalDark: 0.1}.apply(estimate, observed)
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			want := float32(0.2)
+			switch s := support.At(x, y); {
+			case s == 1:
+				want = 0.4
+			case s > 0:
+				want = 0.3
+			}
+			if got := estimate.At(x, y); got-want > 1e-6 || want-got > 1e-6 {
+				t.Errorf("(%d, %d) with support %g: %g, want %g", x, y, support.At(x, y), got, want)
+			}
+		}
+	}
+}
+
+func TestDeringSupportPlaneCtx(t *testing.T) {
+	src := NewPlane(32, 24)
+	src.Set(12, 10, 1)
+	mask, err := DeringSupportPlaneCtx(context.Background(), src, 0.5, 4, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mask.At(12, 10) < 0.5 || mask.At(30, 22) != 0 {
+		t.Errorf("mask is %g on the star and %g far from it", mask.At(12, 10), mask.At(30, 22))
+	}
+	for i, v := range mask.Data {
+		if v < 0 || v > 1 {
+			t.Fatalf("mask sample %d = %g", i, v)
+		}
+	}
+	if e := MaxAbsErrorPlane(DeringSupportPlane(src, 0.5, 4), mask); e != 0 {
+		t.Errorf("DeringSupportPlane differs from DeringSupportPlaneCtx by %g", e)
+	}
+
+	if _, err := DeringSupportPlaneCtx(context.Background(), &Plane{}, 0.5, 4, nil); !errors.Is(err, ErrEmptyImage) {
+		t.Errorf("empty image: got %v", err)
+	}
+	if _, err := DeringSupportPlaneCtx(context.Background(), src, 0.5, -1, nil); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("negative radius: got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := DeringSupportPlaneCtx(ctx, src, 0.5, 4, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled: got %v", err)
+	}
+}
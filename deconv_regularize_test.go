@@ -0,0 +1,55 @@
+package goimagefreq
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRichardsonLucyRegularizationFlattensBackground(t *testing.T) {
+	noisy, clean, k := noisyStars(0.01)
+	plain := backgroundVariance(RichardsonLucyPlane(noisy, k, k, 20, Edge{}), clean)
+	tests := []struct {
+		name  string
+		opts  RLOptions
+		ratio float64
+	}{
+		{"TV", RLOptions{Regularization: RLTotalVariation}, 0.9},
+		{"wavelet", RLOptions{Regularization: RLWavelet}, 0.5},
+	}
+	for _, tt := range tests {
+		out, _ := RichardsonLucyOptsPlane(noisy, k, k, 20, Edge{}, tt.opts)
+		if v := backgroundVariance(out, clean); v >= tt.ratio*plain {
+			t.Errorf("%s: background variance %g, plain RL %g", tt.name, v, plain)
+		}
+	}
+}
+
+func TestRLOptionsValidate(t *testing.T) {
+	blurred, k := blurredStars()
+	tests := []struct {
+		name string
+		opts RLOptions
+		ok   bool
+	}{
+		{"TV default", RLOptions{Regularization: RLTotalVariation}, true},
+		{"TV 0.2", RLOptions{Regularization: RLTotalVariation, Lambda: 0.2}, true},
+		{"TV 0.25", RLOptions{Regularization: RLTotalVariation, Lambda: 0.25}, false},
+		{"TV 1", RLOptions{Regularization: RLTotalVariation, Lambda: 1}, false},
+		{"TV negative", RLOptions{Regularization: RLTotalVariation, Lambda: -0.1}, false},
+		{"wavelet 1", RLOptions{Regularization: RLWavelet, Lambda: 1}, true},
+		{"wavelet 1.01", RLOptions{Regularization: RLWavelet, Lambda: 1.01}, false},
+		{"wavelet negative threshold", RLOptions{Regularization: RLWavelet, Thresholds: []float32{3, -1}}, false},
+		{"wavelet no thresholds", RLOptions{Regularization: RLWavelet, Thresholds: []float32{}}, false},
+		{"unknown", RLOptions{Regularization: RLWavelet + 1}, false},
+	}
+	for _, tt := range tests {
+		_, _, err := RichardsonLucyOptsPlaneCtx(context.Background(), blurred, k, k, 2, Edge{}, tt.opts, nil)
+		if tt.ok && err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidParameter) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, ErrInvalidParameter)
+		}
+	}
+}
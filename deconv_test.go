@@ -0,0 +1,126 @@
+package goimagefreq
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// blurredStars returns a few Gaussian-blurred point sources
+// on a flat background, and the blur kernel.
+func blurredStars() (*Plane, []float64) {
+	p := NewPlane(40, 32)
+	p.Fill(0.05)
+	p.Set(10, 8, 1)
+	p.Set(27, 20, 0.6)
+	p.Set(31, 9, 0.8)
+	k := GaussianKernel(1.5)
+	return Convolve2DSeparablePlane(p, k, k, Edge{}), k
+}
+
+// noisyStars returns blurredStars with Gaussian noise of the
+// given sigma added, the noiseless image and the blur kernel.
+func noisyStars(sigma float32) (noisy, clean *Plane, k []float64) {
+	clean, k = blurredStars()
+	r := rand.New(rand.NewSource(11))
+	noisy = clean.Clone()
+	for i := range noisy.Data {
+		noisy.Data[i] += sigma * float32(r.NormFloat64())
+	}
+	return noisy, clean, k
+}
+
+// backgroundVariance is the variance of p over the pixels
+// where the noiseless image clean is flat background.
+func backgroundVariance(p, clean *Plane) float64 {
+	var s, ss float64
+	n := 0
+	for i, v := range p.Data {
+		if clean.Data[i] < 0.0501 {
+			s += float64(v)
+			ss += float64(v) * float64(v)
+			n++
+		}
+	}
+	m := s / float64(n)
+	return ss/float64(n) - m*m
+}
+
+func TestRichardsonLucySharpens(t *testing.T) {
+	blurred, k := blurredStars()
+	out := RichardsonLucyPlane(blurred, k, k, 20, Edge{})
+	if before, after := blurred.At(10, 8), out.At(10, 8); after <= 1.5*before {
+		t.Errorf("peak went from %g to %g", before, after)
+	}
+}
+
+func TestRichardsonLucyStatsMatchPlain(t *testing.T) {
+	blurred, k := blurredStars()
+	plain, err := RichardsonLucyPlaneCtx(context.Background(), blurred, k, k, 8, Edge{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, stats, err := RichardsonLucyOptsPlaneCtx(context.Background(), blurred, k, k, 8, Edge{}, RLOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := MaxAbsErrorPlane(plain, opts); e != 0 {
+		t.Errorf("plain and zero-option results differ by %g", e)
+	}
+	if stats.Iterations != 8 || len(stats.History) != 8 || stats.Stopped != RLStoppedCap {
+		t.Errorf("stats %+v", stats)
+	}
+	for i, h := range stats.History {
+		if !math.IsNaN(h.ChiSquare) {
+			t.Errorf("iteration %d: χ² = %g without a noise sigma", i, h.ChiSquare)
+		}
+		if !(h.Residual > 0) || !(h.Change > 0) {
+			t.Errorf("iteration %d: residual %g, change %g", i, h.Residual, h.Change)
+		}
+	}
+}
+
+func TestRichardsonLucyChiSquare(t *testing.T) {
+	blurred, k := blurredStars()
+
+	_, stats := RichardsonLucyOptsPlane(blurred, k, k, 3, Edge{}, RLOptions{Sigma: 0.01})
+	for i, h := range stats.History {
+		if want := h.Residual * h.Residual / 1e-4; math.Abs(h.ChiSquare-want) > 1e-6*want {
+			t.Errorf("iteration %d: χ² = %g, want %g", i, h.ChiSquare, want)
+		}
+	}
+
+	_, stats = RichardsonLucyOptsPlane(blurred, k, k, 50, Edge{}, RLOptions{Sigma: 0.01, StopChiSquare: 1})
+	if stats.Stopped != RLStoppedChiSquare || !(stats.ChiSquare <= 1) {
+		t.Errorf("χ² stop: stopped %d at χ² %g after %d iterations", stats.Stopped, stats.ChiSquare, stats.Iterations)
+	}
+
+	// Damping needs sigma, so it is estimated and χ² reported.
+	_, stats = RichardsonLucyOptsPlane(blurred, k, k, 2, Edge{}, RLOptions{Damping: 3})
+	if math.IsNaN(stats.ChiSquare) {
+		t.Error("χ² is NaN although sigma was estimated for damping")
+	}
+
+	// Damping stops the noise from being fitted, so the
+	// background stays flatter than with plain RL.
+	noisy, clean, k := noisyStars(0.01)
+	plain := backgroundVariance(RichardsonLucyPlane(noisy, k, k, 20, Edge{}), clean)
+	for _, sigma := range []float32{0, 0.01} {
+		damped, _ := RichardsonLucyOptsPlane(noisy, k, k, 20, Edge{}, RLOptions{Damping: 3, Sigma: sigma})
+		if v := backgroundVariance(damped, clean); v >= 0.6*plain {
+			t.Errorf("sigma %g: damped background variance %g, plain RL %g", sigma, v, plain)
+		}
+	}
+}
+
+func TestRichardsonLucyTolerance(t *testing.T) {
+	blurred, k := blurredStars()
+	_, stats := RichardsonLucyOptsPlane(blurred, k, k, 500, Edge{}, RLOptions{Tolerance: 1e-3})
+	if stats.Stopped != RLStoppedTolerance || stats.Iterations >= 500 {
+		t.Fatalf("stopped %d after %d iterations", stats.Stopped, stats.Iterations)
+	}
+	if last := stats.History[len(stats.History)-1].Change; !(last < 1e-3) {
+		t.Errorf("last change %g", last)
+	}
+}
@@ -0,0 +1,487 @@
+// Bayer (CFA) demosaicing
+package goimagefreq
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// BayerPattern is the 2x2 color filter layout, read from the
+// top-left pixel in row order.
+type BayerPattern int
+
+const (
+	BayerRGGB BayerPattern = iota
+	BayerBGGR
+	BayerGRBG
+	BayerGBRG
+)
+
+// DemosaicMethod selects the CFA interpolation algorithm.
+type DemosaicMethod int
+
+const (
+	// DemosaicBilinear averages the nearest samples of each
+	// color. Fast, but soft and prone to zipper artifacts.
+	DemosaicBilinear DemosaicMethod = iota
+	// DemosaicVNG uses variable number of gradients
+	// (Chang et al.): only directions with low gradient
+	// contribute, which keeps edges sharp.
+	DemosaicVNG
+	// DemosaicAHD is adaptive homogeneity-directed
+	// interpolation (Hirakawa & Parks): green is interpolated
+	// horizontally and vertically with a high-frequency
+	// correction and the more homogeneous result in CIELAB
+	// is kept per pixel.
+	DemosaicAHD
+	// DemosaicSuperPixel merges every 2x2 cell into one RGB
+	// pixel. No interpolation, half resolution.
+	DemosaicSuperPixel
+)
+
+// bayerColors maps each pattern to the colors (0=R, 1=G,
+// 2=B) of its 2x2 cell in row order.
+var bayerColors = [...][4]int{
+	BayerRGGB: {0, 1, 1, 2},
+	BayerBGGR: {2, 1, 1, 0},
+	BayerGRBG: {1, 0, 2, 1},
+	BayerGBRG: {1, 2, 0, 1},
+}
+
+// ParseBayerPattern parses a pattern name such as the FITS
+// BAYERPAT value "RGGB" (case-insensitive).
+func ParseBayerPattern(name string) (BayerPattern, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "RGGB":
+		return BayerRGGB, nil
+	case "BGGR":
+		return BayerBGGR, nil
+	case "GRBG":
+		return BayerGRBG, nil
+	case "GBRG":
+		return BayerGBRG, nil
+	}
+	return 0, fmt.Errorf("unknown Bayer pattern %q", name)
+}
+
+// color returns the filter color at (x, y).
+func (p BayerPattern) color(x, y int) int {
+	return bayerColors[p][(y&1)*2+(x&1)]
+}
+
+// DemosaicPlane interpolates a single-channel CFA mosaic into
+// linear R, G, B planes. The output has the size of the input,
+// except for DemosaicSuperPixel which halves both dimensions.
+//
+// Samples are not rescaled, so the result keeps the black
+// level and units of the raw frame.
+func DemosaicPlane(cfa *Plane, pattern BayerPattern, method DemosaicMethod) (r, g, b *Plane) {
+	r, g, b, err := DemosaicPlaneCtx(context.Background(), cfa, pattern, method, nil)
+	panicOnError(err)
+	return r, g, b
+}
+
+// DemosaicPlaneCtx is DemosaicPlane with cancellation and
+// input validation. The mosaic must hold at least one 2x2
+// cell. It reports one progress step.
+func DemosaicPlaneCtx(ctx context.Context, cfa *Plane, pattern BayerPattern, method DemosaicMethod, progress ProgressFunc) (r, g, b *Plane, err error) {
+	if err := validateSameSize(cfa); err != nil {
+		return nil, nil, nil, err
+	}
+	if cfa.W < 2 || cfa.H < 2 {
+		return nil, nil, nil, invalidParam("CFA mosaic is %dx%d, need at least 2x2", cfa.W, cfa.H)
+	}
+	if pattern < 0 || int(pattern) >= len(bayerColors) {
+		return nil, nil, nil, invalidParam("unknown Bayer pattern %d", pattern)
+	}
+	switch method {
+	case DemosaicBilinear:
+		r, g, b, err = demosaicBilinear(ctx, cfa, pattern)
+	case DemosaicVNG:
+		r, g, b, err = demosaicVNG(ctx, cfa, pattern)
+	case DemosaicAHD:
+		r, g, b, err = demosaicAHD(ctx, cfa, pattern)
+	case DemosaicSuperPixel:
+		r, g, b, err = demosaicSuperPixel(ctx, cfa, pattern)
+	default:
+		return nil, nil, nil, invalidParam("unknown demosaic method %d", method)
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	progress.report(1, 1)
+	return r, g, b, nil
+}
+
+// Demosaic is the [][]float32 adapter for DemosaicPlane.
+func Demosaic(cfa [][]float32, pattern BayerPattern, method DemosaicMethod) RGBImage {
+	return RGBImageFromPlanes(DemosaicPlane(PlaneFromRows(cfa), pattern, method))
+}
+
+// padCFA returns cfa with a mirrored border of pad pixels.
+// Mirroring about the border pixel keeps the CFA phase, so
+// the pattern stays valid in the border.
+func padCFA(cfa *Plane, pad int) *Plane {
+	mirror := Edge{Mode: EdgeMirror}
+	w, h := cfa.W, cfa.H
+	out := NewPlane(w+2*pad, h+2*pad)
+	parallelRows(out.H, func(y int) {
+		sy, _ := mirror.index(y-pad, h)
+		mirror.extendRow(out.Row(y), cfa.Row(sy), pad)
+	})
+	return out
+}
+
+// bayerOffset is a neighbor position relative to a pixel.
+type bayerOffset struct{ dx, dy int }
+
+// bilinear neighbor lists per CFA phase and color.
+func bilinearNeighbors(pattern BayerPattern) [4][3][]bayerOffset {
+	var nb [4][3][]bayerOffset
+	for phase := 0; phase < 4; phase++ {
+		x0, y0 := phase&1, phase>>1
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				if dx == 0 && dy == 0 {
+					continue
+				}
+				c := pattern.color(x0+dx, y0+dy)
+				nb[phase][c] = append(nb[phase][c], bayerOffset{dx, dy})
+			}
+		}
+	}
+	return nb
+}
+
+func demosaicBilinear(ctx context.Context, cfa *Plane, pattern BayerPattern) (r, g, b *Plane, err error) {
+	const pad = 1
+	w, h := cfa.W, cfa.H
+	p := padCFA(cfa, pad)
+	nb := bilinearNeighbors(pattern)
+	out := [3]*Plane{NewPlane(w, h), NewPlane(w, h), NewPlane(w, h)}
+
+	err = parallelRowsCtx(ctx, h, func(y int) {
+		for x := 0; x < w; x++ {
+			phase := (y&1)*2 + x&1
+			c0 := pattern.color(x, y)
+			for c := 0; c < 3; c++ {
+				if c == c0 {
+					out[c].Row(y)[x] = cfa.Row(y)[x]
+					continue
+				}
+				var sum float32
+				for _, o := range nb[phase][c] {
+					sum += p.Row(y + pad + o.dy)[x+pad+o.dx]
+				}
+				out[c].Row(y)[x] = sum / float32(len(nb[phase][c]))
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return out[0], out[1], out[2], nil
+}
+
+// vngDirs are the eight VNG directions: N, NE, E, SE, S, SW, W, NW.
+var vngDirs = [8]bayerOffset{{0, -1}, {1, -1}, {1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}}
+
+// vngPair is a gradient term |I(a) - I(a+2d)| with weight w.
+// Samples two steps apart always share the CFA color.
+type vngPair struct {
+	a, b bayerOffset
+	w    float32
+}
+
+// vngGradientTerms builds the gradient terms of direction d:
+// the center and the pixel behind it at full weight, and two
+// parallel lines next to them at half weight. All terms stay
+// inside the 5x5 window.
+func vngGradientTerms(d bayerOffset) []vngPair {
+	var starts []bayerOffset
+	var weights []float32
+	add := func(o bayerOffset, w float32) {
+		starts = append(starts, o)
+		weights = append(weights, w)
+	}
+	add(bayerOffset{0, 0}, 1)
+	add(bayerOffset{-d.dx, -d.dy}, 1)
+	if d.dx == 0 || d.dy == 0 {
+		q := bayerOffset{d.dy, d.dx} // perpendicular
+		add(q, 0.5)
+		add(bayerOffset{-q.dx, -q.dy}, 0.5)
+		add(bayerOffset{q.dx - d.dx, q.dy - d.dy}, 0.5)
+		add(bayerOffset{-q.dx - d.dx, -q.dy - d.dy}, 0.5)
+	} else {
+		add(bayerOffset{-d.dx, 0}, 0.5)
+		add(bayerOffset{0, -d.dy}, 0.5)
+	}
+	terms := make([]vngPair, len(starts))
+	for i, a := range starts {
+		terms[i] = vngPair{a, bayerOffset{a.dx + 2*d.dx, a.dy + 2*d.dy}, weights[i]}
+	}
+	return terms
+}
+
+func demosaicVNG(ctx context.Context, cfa *Plane, pattern BayerPattern) (r, g, b *Plane, err error) {
+	const pad = 2
+	w, h := cfa.W, cfa.H
+	p := padCFA(cfa, pad)
+	out := [3]*Plane{NewPlane(w, h), NewPlane(w, h), NewPlane(w, h)}
+
+	var terms [8][]vngPair
+	for i, d := range vngDirs {
+		terms[i] = vngGradientTerms(d)
+	}
+	// per phase and direction: the samples of each color in
+	// the 3x3 block centered on the neighbor in that direction
+	var region [4][8][3][]bayerOffset
+	for phase := 0; phase < 4; phase++ {
+		x0, y0 := phase&1, phase>>1
+		for i, d := range vngDirs {
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					o := bayerOffset{d.dx + dx, d.dy + dy}
+					c := pattern.color(x0+o.dx, y0+o.dy)
+					region[phase][i][c] = append(region[phase][i][c], o)
+				}
+			}
+		}
+	}
+
+	err = parallelRowsCtx(ctx, h, func(y int) {
+		at := func(x int, o bayerOffset) float32 {
+			return p.Row(y + pad + o.dy)[x+pad+o.dx]
+		}
+		var grad [8]float32
+		for x := 0; x < w; x++ {
+			gmin, gmax := float32(math.MaxFloat32), float32(0)
+			for i := range vngDirs {
+				var s float32
+				for _, t := range terms[i] {
+					s += t.w * float32(math.Abs(float64(at(x, t.a)-at(x, t.b))))
+				}
+				grad[i] = s
+				if s < gmin {
+					gmin = s
+				}
+				if s > gmax {
+					gmax = s
+				}
+			}
+			thresh := 1.5*gmin + 0.5*(gmax-gmin)
+
+			phase := (y&1)*2 + x&1
+			var sum [3]float32
+			n := 0
+			for i := range vngDirs {
+				if grad[i] > thresh {
+					continue
+				}
+				n++
+				for c := 0; c < 3; c++ {
+					var s float32
+					for _, o := range region[phase][i][c] {
+						s += at(x, o)
+					}
+					sum[c] += s / float32(len(region[phase][i][c]))
+				}
+			}
+
+			c0 := pattern.color(x, y)
+			v := cfa.Row(y)[x]
+			for c := 0; c < 3; c++ {
+				if c == c0 {
+					out[c].Row(y)[x] = v
+				} else {
+					out[c].Row(y)[x] = v + (sum[c]-sum[c0])/float32(n)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return out[0], out[1], out[2], nil
+}
+
+func demosaicAHD(ctx context.Context, cfa *Plane, pattern BayerPattern) (r, g, b *Plane, err error) {
+	// each stage reads one pixel further out than the next
+	const pad = 5
+	w, h := cfa.W, cfa.H
+	p := padCFA(cfa, pad)
+	pw, ph := p.W, p.H
+	colorAt := func(x, y int) int { return pattern.color(x-pad, y-pad) }
+
+	// 1. green, horizontally and vertically, with a
+	// Laplacian correction from the center color and the
+	// result limited to the two green neighbors
+	var gdir [2]*Plane
+	for dir := 0; dir < 2; dir++ {
+		gp := NewPlane(pw, ph)
+		dx, dy := 1-dir, dir
+		err = parallelRowsCtx(ctx, ph-4, func(y int) {
+			y += 2
+			for x := 2; x < pw-2; x++ {
+				v := p.Row(y)[x]
+				if colorAt(x, y) == 1 {
+					gp.Row(y)[x] = v
+					continue
+				}
+				g1, g2 := p.Row(y - dy)[x-dx], p.Row(y + dy)[x+dx]
+				c1, c2 := p.Row(y - 2*dy)[x-2*dx], p.Row(y + 2*dy)[x+2*dx]
+				if g1 > g2 {
+					g1, g2 = g2, g1
+				}
+				est := (g1+g2)/2 + (2*v-c1-c2)/4
+				if est < g1 {
+					est = g1
+				} else if est > g2 {
+					est = g2
+				}
+				gp.Row(y)[x] = est
+			}
+		})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		gdir[dir] = gp
+	}
+
+	// 2. red and blue from color differences against the
+	// directional green, then CIELAB for the homogeneity test
+	var rgb [2][3]*Plane
+	var lab [2][3]*Plane
+	for dir := 0; dir < 2; dir++ {
+		gp := gdir[dir]
+		rp, bp := NewPlane(pw, ph), NewPlane(pw, ph)
+		lp, ap, bbp := NewPlane(pw, ph), NewPlane(pw, ph), NewPlane(pw, ph)
+		err = parallelRowsCtx(ctx, ph-6, func(y int) {
+			y += 3
+			for x := 3; x < pw-3; x++ {
+				c0 := colorAt(x, y)
+				gv := gp.Row(y)[x]
+				var est [3]float32
+				est[1] = gv
+				for c := 0; c < 3; c += 2 {
+					if c == c0 {
+						est[c] = p.Row(y)[x]
+						continue
+					}
+					var s float32
+					n := 0
+					for oy := -1; oy <= 1; oy++ {
+						for ox := -1; ox <= 1; ox++ {
+							if colorAt(x+ox, y+oy) == c {
+								s += p.Row(y + oy)[x+ox] - gp.Row(y + oy)[x+ox]
+								n++
+							}
+						}
+					}
+					est[c] = gv + s/float32(n)
+				}
+				rp.Row(y)[x], bp.Row(y)[x] = est[0], est[2]
+				lp.Row(y)[x], ap.Row(y)[x], bbp.Row(y)[x] = RGBToLab(est[0], est[1], est[2])
+			}
+		})
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		rgb[dir] = [3]*Plane{rp, gp, bp}
+		lab[dir] = [3]*Plane{lp, ap, bbp}
+	}
+
+	// 3. homogeneity: neighbors within the adaptive
+	// luminance and chroma tolerances
+	var homo [2]*Plane
+	for dir := range homo {
+		homo[dir] = NewPlane(pw, ph)
+	}
+	near := [4]bayerOffset{{-1, 0}, {1, 0}, {0, -1}, {0, 1}}
+	err = parallelRowsCtx(ctx, ph-8, func(y int) {
+		y += 4
+		for x := 4; x < pw-4; x++ {
+			var dl, dc [2][4]float64
+			for dir := 0; dir < 2; dir++ {
+				L, A, B := lab[dir][0], lab[dir][1], lab[dir][2]
+				for i, o := range near {
+					dl[dir][i] = math.Abs(float64(L.Row(y)[x] - L.Row(y + o.dy)[x+o.dx]))
+					da := float64(A.Row(y)[x] - A.Row(y + o.dy)[x+o.dx])
+					db := float64(B.Row(y)[x] - B.Row(y + o.dy)[x+o.dx])
+					dc[dir][i] = da*da + db*db
+				}
+			}
+			// horizontal tolerances from the horizontal
+			// candidate, vertical from the vertical one
+			epsL := math.Min(math.Max(dl[0][0], dl[0][1]), math.Max(dl[1][2], dl[1][3]))
+			epsC := math.Min(math.Max(dc[0][0], dc[0][1]), math.Max(dc[1][2], dc[1][3]))
+			for dir := 0; dir < 2; dir++ {
+				n := 0
+				for i := range near {
+					if dl[dir][i] <= epsL && dc[dir][i] <= epsC {
+						n++
+					}
+				}
+				homo[dir].Row(y)[x] = float32(n)
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// 4. keep the direction that is more homogeneous over a
+	// 3x3 window, average on ties
+	out := [3]*Plane{NewPlane(w, h), NewPlane(w, h), NewPlane(w, h)}
+	err = parallelRowsCtx(ctx, h, func(y int) {
+		py := y + pad
+		for x := 0; x < w; x++ {
+			px := x + pad
+			var hh, hv float32
+			for oy := -1; oy <= 1; oy++ {
+				for ox := -1; ox <= 1; ox++ {
+					hh += homo[0].Row(py + oy)[px+ox]
+					hv += homo[1].Row(py + oy)[px+ox]
+				}
+			}
+			for c := 0; c < 3; c++ {
+				vh, vv := rgb[0][c].Row(py)[px], rgb[1][c].Row(py)[px]
+				switch {
+				case hh > hv:
+					out[c].Row(y)[x] = vh
+				case hv > hh:
+					out[c].Row(y)[x] = vv
+				default:
+					out[c].Row(y)[x] = (vh + vv) / 2
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return out[0], out[1], out[2], nil
+}
+
+func demosaicSuperPixel(ctx context.Context, cfa *Plane, pattern BayerPattern) (r, g, b *Plane, err error) {
+	w, h := cfa.W/2, cfa.H/2
+	out := [3]*Plane{NewPlane(w, h), NewPlane(w, h), NewPlane(w, h)}
+	err = parallelRowsCtx(ctx, h, func(y int) {
+		rows := [2][]float32{cfa.Row(2 * y), cfa.Row(2*y + 1)}
+		for x := 0; x < w; x++ {
+			var sum [3]float32
+			for k := 0; k < 4; k++ {
+				sum[bayerColors[pattern][k]] += rows[k>>1][2*x+k&1]
+			}
+			out[0].Row(y)[x] = sum[0]
+			out[1].Row(y)[x] = sum[1] / 2
+			out[2].Row(y)[x] = sum[2]
+		}
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return out[0], out[1], out[2], nil
+}
@@ -0,0 +1,90 @@
+package goimagefreq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var demosaicMethods = []DemosaicMethod{DemosaicBilinear, DemosaicVNG, DemosaicAHD, DemosaicSuperPixel}
+
+func TestDemosaicFlat(t *testing.T) {
+	cfa := NewPlane(13, 9)
+	cfa.Fill(0.4)
+	for _, pattern := range []BayerPattern{BayerRGGB, BayerBGGR, BayerGRBG, BayerGBRG} {
+		for _, method := range demosaicMethods {
+			name := fmt.Sprintf("pattern %d method %d", pattern, method)
+			r, g, b, err := DemosaicPlaneCtx(context.Background(), cfa, pattern, method, nil)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			w, h := 13, 9
+			if method == DemosaicSuperPixel {
+				w, h = 6, 4
+			}
+			for c, p := range []*Plane{r, g, b} {
+				if p.W != w || p.H != h {
+					t.Fatalf("%s: plane %d is %dx%d, want %dx%d", name, c, p.W, p.H, w, h)
+				}
+				for i, v := range p.Data {
+					if d := v - 0.4; d > 1e-6 || d < -1e-6 {
+						t.Errorf("%s: plane %d sample %d = %g", name, c, i, v)
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestDemosaicSuperPixel(t *testing.T) {
+	// one RGGB cell per output pixel: R, G1 / G2, B
+	cfa := PlaneFromRows([][]float32{
+		{0.8, 0.2, 0.6, 0.4},
+		{0.4, 0.1, 0.3, 0.2},
+	})
+	r, g, b := DemosaicPlane(cfa, BayerRGGB, DemosaicSuperPixel)
+	if r.W != 2 || r.H != 1 {
+		t.Fatalf("output is %dx%d", r.W, r.H)
+	}
+	want := [3][]float32{{0.8, 0.6}, {0.3, 0.35}, {0.1, 0.2}}
+	for c, p := range []*Plane{r, g, b} {
+		for x, v := range p.Data {
+			if d := v - want[c][x]; d > 1e-6 || d < -1e-6 {
+				t.Errorf("color %d pixel %d = %g, want %g", c, x, v, want[c][x])
+			}
+		}
+	}
+}
+
+func TestDemosaicPlaneCtxErrors(t *testing.T) {
+	cfa := NewPlane(8, 8)
+	tests := []struct {
+		name    string
+		cfa     *Plane
+		pattern BayerPattern
+		method  DemosaicMethod
+		want    error
+	}{
+		{"empty", &Plane{}, BayerRGGB, DemosaicBilinear, ErrEmptyImage},
+		{"nil", nil, BayerRGGB, DemosaicBilinear, ErrEmptyImage},
+		{"one row", NewPlane(8, 1), BayerRGGB, DemosaicAHD, ErrInvalidParameter},
+		{"unknown pattern", cfa, BayerGBRG + 1, DemosaicBilinear, ErrInvalidParameter},
+		{"negative pattern", cfa, -1, DemosaicBilinear, ErrInvalidParameter},
+		{"unknown method", cfa, BayerRGGB, DemosaicSuperPixel + 1, ErrInvalidParameter},
+	}
+	for _, tt := range tests {
+		if _, _, _, err := DemosaicPlaneCtx(context.Background(), tt.cfa, tt.pattern, tt.method, nil); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, method := range demosaicMethods {
+		if _, _, _, err := DemosaicPlaneCtx(ctx, cfa, BayerRGGB, method, nil); !errors.Is(err, context.Canceled) {
+			t.Errorf("method %d canceled: got %v", method, err)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+// Decimated 2D discrete wavelet transform
+package goimagefreq
+
+import (
+	"context"
+	"math"
+)
+
+// DWTLevel holds the detail subbands of one DWT level. The
+// first letter is the filter applied along x, the second
+// along y: LH holds horizontal edges, HL vertical edges and
+// HH diagonals.
+type DWTLevel struct {
+	LH, HL, HH *Plane
+	W, H       int // size of the image this level decomposed
+}
+
+// DWTResult is a multi-level decimated wavelet decomposition.
+type DWTResult struct {
+	Wavelet Wavelet
+	Levels  []DWTLevel // fine → coarse
+	LL      *Plane     // approximation at the coarsest level
+}
+
+// DWTMaxLevel returns the number of levels after which an
+// axis of length n stops shrinking usefully with wavelet wv
+// (⌊log2(n/(L-1))⌋, as in PyWavelets).
+func DWTMaxLevel(n int, wv Wavelet) int {
+	if wv.Len() < 2 || n < wv.Len()-1 {
+		return 0
+	}
+	return int(math.Log2(float64(n) / float64(wv.Len()-1)))
+}
+
+// dwtLen is the number of coefficients per subband for an
+// axis of length n and filters of length l.
+func dwtLen(n, l int) int {
+	return (n + l - 1) / 2
+}
+
+// symIndex reflects i into [0, n) with half-sample symmetry:
+// cba|abc|cba.
+func symIndex(i, n int) int {
+	period := 2 * n
+	i %= period
+	if i < 0 {
+		i += period
+	}
+	if i >= n {
+		i = period - 1 - i
+	}
+	return i
+}
+
+// DWTPlane performs a levels-deep decimated 2D wavelet
+// transform with symmetric (half-sample) extension.
+//
+// Any image size is accepted: each subband has
+// ⌊(n+L-1)/2⌋ samples per axis for filters of length L (half
+// the input for Haar, a few more for longer filters), and
+// IDWTPlane reconstructs the input exactly.
+func DWTPlane(src *Plane, wv Wavelet, levels int) *DWTResult {
+	d, err := DWTPlaneCtx(context.Background(), src, wv, levels, nil)
+	panicOnError(err)
+	return d
+}
+
+// DWTPlaneCtx is DWTPlane with cancellation. It reports one
+// progress step per level.
+func DWTPlaneCtx(ctx context.Context, src *Plane, wv Wavelet, levels int, progress ProgressFunc) (*DWTResult, error) {
+	if err := validateSameSize(src); err != nil {
+		return nil, err
+	}
+	if err := wv.validate(); err != nil {
+		return nil, err
+	}
+	if err := validateCount("levels", levels); err != nil {
+		return nil, err
+	}
+	if m := DWTMaxLevel(min(src.W, src.H), wv); levels > m && levels > 1 {
+		return nil, invalidParam("%d levels for a %dx%d image with %s (at most %d)", levels, src.W, src.H, wv.Name, m)
+	}
+
+	d := &DWTResult{Wavelet: wv}
+	current := src
+	for level := 0; level < levels; level++ {
+		lo, hi, err := dwtRows(ctx, current, wv.DecLo, wv.DecHi)
+		if err != nil {
+			return nil, err
+		}
+		ll, lh, err := dwtCols(ctx, lo, wv.DecLo, wv.DecHi)
+		if err != nil {
+			return nil, err
+		}
+		hl, hh, err := dwtCols(ctx, hi, wv.DecLo, wv.DecHi)
+		if err != nil {
+			return nil, err
+		}
+		d.Levels = append(d.Levels, DWTLevel{LH: lh, HL: hl, HH: hh, W: current.W, H: current.H})
+		current = ll
+		progress.report(level+1, levels)
+	}
+	d.LL = current
+	return d, nil
+}
+
+// DWT is the [][]float32 adapter for DWTPlane.
+func DWT(src [][]float32, wv Wavelet, levels int) *DWTResult {
+	return DWTPlane(PlaneFromRows(src), wv, levels)
+}
+
+// IDWTPlane reconstructs the image from a DWTPlane result.
+func IDWTPlane(d *DWTResult) *Plane {
+	out, err := IDWTPlaneCtx(context.Background(), d, nil)
+	panicOnError(err)
+	return out
+}
+
+// IDWTPlaneCtx is IDWTPlane with cancellation. It reports
+// one progress step per level.
+func IDWTPlaneCtx(ctx context.Context, d *DWTResult, progress ProgressFunc) (*Plane, error) {
+	if err := d.validate(); err != nil {
+		return nil, err
+	}
+	wv := d.Wavelet
+	current := d.LL
+	for i := len(d.Levels) - 1; i >= 0; i-- {
+		lv := d.Levels[i]
+		lo, err := idwtCols(ctx, current, lv.LH, wv.RecLo, wv.RecHi, lv.H)
+		if err != nil {
+			return nil, err
+		}
+		hi, err := idwtCols(ctx, lv.HL, lv.HH, wv.RecLo, wv.RecHi, lv.H)
+		if err != nil {
+			return nil, err
+		}
+		current, err = idwtRows(ctx, lo, hi, wv.RecLo, wv.RecHi, lv.W)
+		if err != nil {
+			return nil, err
+		}
+		progress.report(len(d.Levels)-i, len(d.Levels))
+	}
+	return current, nil
+}
+
+// IDWT is the [][]float32 adapter for IDWTPlane.
+func IDWT(d *DWTResult) [][]float32 {
+	return IDWTPlane(d).Rows()
+}
+
+// validate checks that the subband sizes follow from the
+// level sizes and the filter length.
+func (d *DWTResult) validate() error {
+	if d == nil {
+		return ErrEmptyImage
+	}
+	if err := d.Wavelet.validate(); err != nil {
+		return err
+	}
+	if err := validateSameSize(d.LL); err != nil {
+		return err
+	}
+	l := d.Wavelet.Len()
+	for i, lv := range d.Levels {
+		if err := validateSameSize(lv.LH, lv.HL, lv.HH); err != nil {
+			return err
+		}
+		w, h := dwtLen(lv.W, l), dwtLen(lv.H, l)
+		next := d.LL
+		if i+1 < len(d.Levels) {
+			next = &Plane{W: d.Levels[i+1].W, H: d.Levels[i+1].H}
+		}
+		if lv.LH.W != w || lv.LH.H != h || next.W != w || next.H != h {
+			return invalidParam("DWT level %d of %dx%d should have %dx%d subbands", i, lv.W, lv.H, w, h)
+		}
+	}
+	return nil
+}
+
+// DWTDenoisePlane is classical wavelet shrinkage: the noise
+// σ is estimated from the finest HH subband (MAD / 0.6745),
+// every detail subband is thresholded at k·σ (soft or hard)
+// and the image is reconstructed. k = √(2 ln N) is Donoho's
+// universal threshold; about 3 is a common choice.
+func DWTDenoisePlane(src *Plane, wv Wavelet, levels int, k float32, soft bool) *Plane {
+	out, err := DWTDenoisePlaneCtx(context.Background(), src, wv, levels, k, soft, nil)
+	panicOnError(err)
+	return out
+}
+
+// DWTDenoisePlaneCtx is DWTDenoisePlane with cancellation. It
+// reports one progress step per level plus a final step for
+// thresholding and reconstruction.
+func DWTDenoisePlaneCtx(ctx context.Context, src *Plane, wv Wavelet, levels int, k float32, soft bool, progress ProgressFunc) (*Plane, error) {
+	return DWTDenoiseOptsPlaneCtx(ctx, src, wv, levels, k, soft, DenoiseOptions{}, progress)
+}
+
+// DWTDenoiseOptsPlane is DWTDenoisePlane with options. Only
+// opts.Shrinkage applies, overriding soft: the transform is
+// the DWT, and an orthogonal DWT leaves the noise sigma the
+// same at every level, so setting opts.Transform,
+// opts.NoiseGains or opts.Selector is an error.
+func DWTDenoiseOptsPlane(src *Plane, wv Wavelet, levels int, k float32, soft bool, opts DenoiseOptions) *Plane {
+	out, err := DWTDenoiseOptsPlaneCtx(context.Background(), src, wv, levels, k, soft, opts, nil)
+	panicOnError(err)
+	return out
+}
+
+// DWTDenoiseOptsPlaneCtx is DWTDenoiseOptsPlane with
+// cancellation. It reports progress like DWTDenoisePlaneCtx.
+func DWTDenoiseOptsPlaneCtx(ctx context.Context, src *Plane, wv Wavelet, levels int, k float32, soft bool, opts DenoiseOptions, progress ProgressFunc) (*Plane, error) {
+	if !(k >= 0) {
+		return nil, invalidParam("threshold must not be negative, got %g", k)
+	}
+	if opts.Transform != nil {
+		return nil, invalidParam("DWT denoising does not take a transform")
+	}
+	if opts.NoiseGains != nil {
+		return nil, invalidParam("DWT denoising does not take noise gains")
+	}
+	if opts.Selector != ManualThreshold {
+		return nil, invalidParam("DWT denoising does not take a threshold selector")
+	}
+
+	total := levels + 1
+	d, err := DWTPlaneCtx(ctx, src, wv, levels, progress.withTotal(total))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(d.Levels) > 0 {
+		t := k * EstimateNoiseMADPlane(d.Levels[0].HH)
+		s := opts.shrinkage(func(v, t float32) float32 { return shrink(v, t, soft) })
+		for _, lv := range d.Levels {
+			for _, b := range []*Plane{lv.LH, lv.HL, lv.HH} {
+				shrinkPlane(b, t, s)
+			}
+		}
+	}
+
+	out, err := IDWTPlaneCtx(ctx, d, nil)
+	if err != nil {
+		return nil, err
+	}
+	progress.report(total, total)
+	return out, nil
+}
+
+// DWTDenoise is the [][]float32 adapter for DWTDenoisePlane.
+func DWTDenoise(src [][]float32, wv Wavelet, levels int, k float32, soft bool) [][]float32 {
+	return DWTDenoisePlane(PlaneFromRows(src), wv, levels, k, soft).Rows()
+}
+
+// dwtRows filters and decimates every row of src with the
+// analysis filters lo and hi:
+//
+//	out[k] = Σ f[j]·x[2k+1-j]
+func dwtRows(ctx context.Context, src *Plane, lo, hi []float64) (*Plane, *Plane, error) {
+	l := len(lo)
+	n := dwtLen(src.W, l)
+	outLo, outHi := NewPlane(n, src.H), NewPlane(n, src.H)
+	err := parallelChunksCtx(ctx, src.H, func(y0, y1 int) {
+		ext := make([]float32, src.W+2*l)
+		for y := y0; y < y1; y++ {
+			// ext[i+l] = x[i], i in [-l, W+l)
+			row := src.Row(y)
+			for i := range ext {
+				ext[i] = row[symIndex(i-l, src.W)]
+			}
+			a, d := outLo.Row(y), outHi.Row(y)
+			for k := 0; k < n; k++ {
+				var sa, sd float64
+				base := 2*k + 1 + l
+				for j := 0; j < l; j++ {
+					v := float64(ext[base-j])
+					sa += lo[j] * v
+					sd += hi[j] * v
+				}
+				a[k], d[k] = float32(sa), float32(sd)
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return outLo, outHi, nil
+}
+
+// dwtCols is dwtRows along y.
+func dwtCols(ctx context.Context, src *Plane, lo, hi []float64) (*Plane, *Plane, error) {
+	l := len(lo)
+	n := dwtLen(src.H, l)
+	outLo, outHi := NewPlane(src.W, n), NewPlane(src.W, n)
+	err := parallelChunksCtx(ctx, n, func(k0, k1 int) {
+		accLo := make([]float64, src.W)
+		accHi := make([]float64, src.W)
+		for k := k0; k < k1; k++ {
+			for x := range accLo {
+				accLo[x], accHi[x] = 0, 0
+			}
+			for j := 0; j < l; j++ {
+				row := src.Row(symIndex(2*k+1-j, src.H))
+				fl, fh := lo[j], hi[j]
+				for x, v := range row {
+					accLo[x] += fl * float64(v)
+					accHi[x] += fh * float64(v)
+				}
+			}
+			a, d := outLo.Row(k), outHi.Row(k)
+			for x := range a {
+				a[x], d[x] = float32(accLo[x]), float32(accHi[x])
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return outLo, outHi, nil
+}
+
+// idwtRows inverts dwtRows for rows of length w:
+//
+//	x[n] = Σ a[k]·g0[n+L-2-2k] + d[k]·g1[n+L-2-2k]
+func idwtRows(ctx context.Context, lo, hi *Plane, g0, g1 []float64, w int) (*Plane, error) {
+	l := len(g0)
+	out := NewPlane(w, lo.H)
+	err := parallelChunksCtx(ctx, lo.H, func(y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			a, d, dst := lo.Row(y), hi.Row(y), out.Row(y)
+			for n := range dst {
+				var s float64
+				for k := n / 2; k <= (n+l-2)/2; k++ {
+					j := n + l - 2 - 2*k
+					s += g0[j]*float64(a[k]) + g1[j]*float64(d[k])
+				}
+				dst[n] = float32(s)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// idwtCols is idwtRows along y, for columns of length h.
+func idwtCols(ctx context.Context, lo, hi *Plane, g0, g1 []float64, h int) (*Plane, error) {
+	l := len(g0)
+	out := NewPlane(lo.W, h)
+	err := parallelChunksCtx(ctx, h, func(n0, n1 int) {
+		acc := make([]float64, lo.W)
+		for n := n0; n < n1; n++ {
+			for x := range acc {
+				acc[x] = 0
+			}
+			for k := n / 2; k <= (n+l-2)/2; k++ {
+				j := n + l - 2 - 2*k
+				f0, f1 := g0[j], g1[j]
+				a, d := lo.Row(k), hi.Row(k)
+				for x := range acc {
+					acc[x] += f0*float64(a[x]) + f1*float64(d[x])
+				}
+			}
+			dst := out.Row(n)
+			for x := range dst {
+				dst[x] = float32(acc[x])
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DWTDenoiseOpts is the [][]float32 adapter for
+// DWTDenoiseOptsPlane.
+func DWTDenoiseOpts(src [][]float32, wv Wavelet, levels int, k float32, soft bool, opts DenoiseOptions) [][]float32 {
+	return DWTDenoiseOptsPlane(PlaneFromRows(src), wv, levels, k, soft, opts).Rows()
+}
@@ -0,0 +1,71 @@
+package goimagefreq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// testWavelets returns every wavelet the package provides.
+func testWavelets(t *testing.T) []Wavelet {
+	t.Helper()
+	wvs := []Wavelet{Haar(), CDF53(), CDF97()}
+	for n := 1; n <= MaxDaubechiesOrder; n++ {
+		wv, err := Daubechies(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wvs = append(wvs, wv)
+		if n >= 2 {
+			if wv, err = Symlet(n); err != nil {
+				t.Fatal(err)
+			}
+			wvs = append(wvs, wv)
+		}
+	}
+	return wvs
+}
+
+func TestDWTRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(14))
+	sizes := []struct{ w, h int }{{64, 48}, {67, 51}, {40, 33}, {1, 9}}
+	for _, sz := range sizes {
+		src := randomPlane(r, sz.w, sz.h)
+		for _, wv := range testWavelets(t) {
+			levels := max(1, DWTMaxLevel(min(sz.w, sz.h), wv))
+			name := fmt.Sprintf("%s %dx%d %d levels", wv.Name, sz.w, sz.h, levels)
+			d, err := DWTPlaneCtx(context.Background(), src, wv, levels, nil)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			out := IDWTPlane(d)
+			if out.W != sz.w || out.H != sz.h {
+				t.Fatalf("%s: reconstructed %dx%d", name, out.W, out.H)
+			}
+			if e := MaxAbsErrorPlane(out, src); e > 1e-6 {
+				t.Errorf("%s: round-trip error %g", name, e)
+			}
+		}
+	}
+}
+
+func TestDWTDenoiseOptsRejectsUnusedOptions(t *testing.T) {
+	src := randomPlane(rand.New(rand.NewSource(15)), 32, 32)
+	tests := []struct {
+		name string
+		opts DenoiseOptions
+	}{
+		{"transform", DenoiseOptions{Transform: MMTPlaneCtx}},
+		{"noise gains", DenoiseOptions{NoiseGains: StarletNoiseGains(2)}},
+	}
+	for _, tt := range tests {
+		if _, err := DWTDenoiseOptsPlaneCtx(context.Background(), src, Haar(), 2, 3, true, tt.opts, nil); !errors.Is(err, ErrInvalidParameter) {
+			t.Errorf("%s: got %v, want ErrInvalidParameter", tt.name, err)
+		}
+	}
+	if _, err := DWTDenoiseOptsPlaneCtx(context.Background(), src, Haar(), 2, 3, true, DenoiseOptions{Shrinkage: GarroteShrink}, nil); err != nil {
+		t.Errorf("shrinkage: %v", err)
+	}
+}
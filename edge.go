@@ -0,0 +1,126 @@
+// Boundary handling for convolutions
+package goimagefreq
+
+// EdgeMode selects how convolutions sample pixels that fall
+// outside the image.
+type EdgeMode int
+
+const (
+	// EdgeClamp replicates the border pixel: aaa|abcd|ddd
+	EdgeClamp EdgeMode = iota
+	// EdgeMirror reflects about the border pixel: dcb|abcd|cba
+	EdgeMirror
+	// EdgeWrap treats the image as periodic: bcd|abcd|abc
+	EdgeWrap
+	// EdgeZero reads zeros outside the image.
+	EdgeZero
+	// EdgeConstant reads Edge.Value outside the image.
+	EdgeConstant
+)
+
+// Edge describes the boundary handling of a convolution.
+//
+// The zero value is clamp-to-edge, which is what the
+// [][]float32 adapters use.
+type Edge struct {
+	Mode  EdgeMode
+	Value float32 // used by EdgeConstant
+}
+
+// ConstantEdge returns an EdgeConstant boundary reading v.
+func ConstantEdge(v float32) Edge {
+	return Edge{Mode: EdgeConstant, Value: v}
+}
+
+// index maps a sample position i of an axis of length n to
+// a pixel inside [0, n). It returns false when the sample lies
+// outside the image and takes the constant fill value.
+func (e Edge) index(i, n int) (int, bool) {
+	if i >= 0 && i < n {
+		return i, true
+	}
+	switch e.Mode {
+	case EdgeMirror:
+		if n == 1 {
+			return 0, true
+		}
+		period := 2 * (n - 1)
+		i %= period
+		if i < 0 {
+			i += period
+		}
+		if i >= n {
+			i = period - i
+		}
+		return i, true
+	case EdgeWrap:
+		i %= n
+		if i < 0 {
+			i += n
+		}
+		return i, true
+	case EdgeZero, EdgeConstant:
+		return 0, false
+	default:
+		return clampIndex(i, n), true
+	}
+}
+
+// fill is the value read outside the image by the
+// EdgeZero and EdgeConstant modes.
+func (e Edge) fill() float32 {
+	if e.Mode == EdgeConstant {
+		return e.Value
+	}
+	return 0
+}
+
+// extendRow writes row into ext[r:r+len(row)] and fills the
+// r samples on each side according to the edge mode.
+// len(ext) must be len(row)+2r.
+func (e Edge) extendRow(ext, row []float32, r int) {
+	n := len(row)
+	copy(ext[r:], row)
+	for i := 0; i < r; i++ {
+		ext[i] = e.sample(row, i-r)
+		ext[r+n+i] = e.sample(row, n+i)
+	}
+}
+
+// sample reads row at a possibly out-of-range position.
+func (e Edge) sample(row []float32, i int) float32 {
+	j, ok := e.index(i, len(row))
+	if !ok {
+		return e.fill()
+	}
+	return row[j]
+}
+
+// clampIndex replicates the border pixel outside [0, n).
+func clampIndex(i, n int) int {
+	if i < 0 {
+		return 0
+	}
+	if i >= n {
+		return n - 1
+	}
+	return i
+}
+
+// extendPlane returns src padded by r pixels on every side
+// according to the edge mode.
+func (e Edge) extendPlane(src *Plane, r int) *Plane {
+	out := NewPlane(src.W+2*r, src.H+2*r)
+	parallelRows(out.H, func(y int) {
+		dst := out.Row(y)
+		yy, ok := e.index(y-r, src.H)
+		if !ok {
+			for x := range dst {
+				dst[x] = e.fill()
+			}
+			return
+		}
+		e.extendRow(dst, src.Row(yy), r)
+	})
+	return out
+}
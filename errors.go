@@ -0,0 +1,196 @@
+// Input validation and error values
+package goimagefreq
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Errors returned (wrapped, test with errors.Is) by the
+// checked API: the Ctx variants and the validators below.
+//
+// The unchecked functions keep their signatures and panic
+// with the same errors on invalid input.
+var (
+	// ErrEmptyImage reports a nil, zero-sized or row-less image.
+	ErrEmptyImage = errors.New("goimagefreq: empty image")
+	// ErrDimensionMismatch reports ragged rows, a buffer too
+	// short for its stride, or channels/layers that differ
+	// in size.
+	ErrDimensionMismatch = errors.New("goimagefreq: dimension mismatch")
+	// ErrInvalidParameter reports a parameter outside its
+	// domain (negative sigma, too few per-level values, ...).
+	ErrInvalidParameter = errors.New("goimagefreq: invalid parameter")
+)
+
+// ValidatePlane checks that p is a non-empty plane whose
+// Data covers every row.
+func ValidatePlane(p *Plane) error {
+	if p == nil || p.W <= 0 || p.H <= 0 {
+		return ErrEmptyImage
+	}
+	if p.Stride < p.W || len(p.Data) < (p.H-1)*p.Stride+p.W {
+		return fmt.Errorf("%w: %dx%d plane with stride %d has %d samples",
+			ErrDimensionMismatch, p.W, p.H, p.Stride, len(p.Data))
+	}
+	return nil
+}
+
+// ValidateRows checks that rows is a non-empty rectangular
+// image, as expected by the [][]float32 functions.
+func ValidateRows(rows [][]float32) error {
+	if len(rows) == 0 || len(rows[0]) == 0 {
+		return ErrEmptyImage
+	}
+	w := len(rows[0])
+	for y, r := range rows {
+		if len(r) != w {
+			return fmt.Errorf("%w: row %d has %d pixels, row 0 has %d",
+				ErrDimensionMismatch, y, len(r), w)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the three channels are rectangular,
+// non-empty and of size W×H.
+func (img RGBImage) Validate() error {
+	for i, ch := range [][][]float32{img.R, img.G, img.B} {
+		if err := ValidateRows(ch); err != nil {
+			return fmt.Errorf("channel %d: %w", i, err)
+		}
+		if len(ch) != img.H || len(ch[0]) != img.W {
+			return fmt.Errorf("%w: channel %d is %dx%d, image is %dx%d",
+				ErrDimensionMismatch, i, len(ch[0]), len(ch), img.W, img.H)
+		}
+	}
+	return nil
+}
+
+// validateSameSize validates every plane and checks that
+// they all have the size of the first.
+func validateSameSize(planes ...*Plane) error {
+	for i, p := range planes {
+		if err := ValidatePlane(p); err != nil {
+			return err
+		}
+		if p.W != planes[0].W || p.H != planes[0].H {
+			return fmt.Errorf("%w: plane %d is %dx%d, plane 0 is %dx%d",
+				ErrDimensionMismatch, i, p.W, p.H, planes[0].W, planes[0].H)
+		}
+	}
+	return nil
+}
+
+// invalidParam wraps ErrInvalidParameter with a description.
+func invalidParam(format string, args ...any) error {
+	return fmt.Errorf("%w: "+format, append([]any{ErrInvalidParameter}, args...)...)
+}
+
+// validateSigma checks that a Gaussian width is positive
+// and finite.
+func validateSigma(name string, sigma float64) error {
+	if !(sigma > 0) || math.IsInf(sigma, 1) {
+		return invalidParam("%s must be positive and finite, got %g", name, sigma)
+	}
+	return nil
+}
+
+// validateBlurSigma checks a Gaussian blur width: 0 means
+// no blur, otherwise it must be positive and finite.
+func validateBlurSigma(name string, sigma float64) error {
+	if sigma == 0 {
+		return nil
+	}
+	return validateSigma(name, sigma)
+}
+
+// validateKernel checks that a 1D kernel has at least one tap.
+func validateKernel(name string, k []float64) error {
+	if len(k) == 0 {
+		return invalidParam("%s kernel is empty", name)
+	}
+	return nil
+}
+
+// validateCount checks a level or iteration count.
+func validateCount(name string, n int) error {
+	if n < 0 {
+		return invalidParam("%s must not be negative, got %d", name, n)
+	}
+	return nil
+}
+
+// validate checks that the edge mode is known.
+func (e Edge) validate() error {
+	if e.Mode < EdgeClamp || e.Mode > EdgeConstant {
+		return invalidParam("unknown edge mode %d", e.Mode)
+	}
+	return nil
+}
+
+// validateRowsSameSize validates every [][]float32 image and
+// checks that they all have the size of the first. The
+// per-channel RGB functions call it before starting any
+// goroutine, so bad input is reported to the caller instead
+// of panicking where it cannot be recovered.
+func validateRowsSameSize(images ...[][]float32) error {
+	for i, rows := range images {
+		if err := ValidateRows(rows); err != nil {
+			return fmt.Errorf("image %d: %w", i, err)
+		}
+		if len(rows) != len(images[0]) || len(rows[0]) != len(images[0][0]) {
+			return fmt.Errorf("%w: image %d is %dx%d, image 0 is %dx%d",
+				ErrDimensionMismatch, i, len(rows[0]), len(rows), len(images[0][0]), len(images[0]))
+		}
+	}
+	return nil
+}
+
+// panicOnError is used by the unchecked wrappers of the Ctx
+// functions: with a background context the only possible
+// error is invalid input.
+func panicOnError(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+// validateSeparable checks the arguments of a separable
+// convolution.
+func validateSeparable(src *Plane, kx, ky []float64, edge Edge) error {
+	if err := validateSameSize(src); err != nil {
+		return err
+	}
+	if err := validateKernel("horizontal", kx); err != nil {
+		return err
+	}
+	if err := validateKernel("vertical", ky); err != nil {
+		return err
+	}
+	return edge.validate()
+}
+
+// validateTransform checks the arguments of a multi-level
+// decomposition.
+func validateTransform(src *Plane, levels int, edge Edge) error {
+	if err := validateSameSize(src); err != nil {
+		return err
+	}
+	if err := validateCount("levels", levels); err != nil {
+		return err
+	}
+	return edge.validate()
+}
+
+// validateConv2D checks the arguments of a 2D convolution.
+func validateConv2D(src, kernel *Plane, edge Edge) error {
+	if err := validateSameSize(src); err != nil {
+		return err
+	}
+	if err := ValidatePlane(kernel); err != nil {
+		return fmt.Errorf("kernel: %w", err)
+	}
+	return edge.validate()
+}
@@ -0,0 +1,112 @@
+package goimagefreq
+
+import (
+	"errors"
+	"testing"
+)
+
+func testRows(w, h int) [][]float32 {
+	rows := make([][]float32, h)
+	for y := range rows {
+		rows[y] = make([]float32, w)
+		for x := range rows[y] {
+			rows[y][x] = float32(x+y) / float32(w+h)
+		}
+	}
+	return rows
+}
+
+func TestRGBErrVariantsRejectBadInput(t *testing.T) {
+	good := testRows(8, 6)
+	ragged := testRows(8, 6)
+	ragged[3] = ragged[3][:5]
+	small := testRows(4, 6)
+
+	tests := []struct {
+		name string
+		call func(bad [][]float32) error
+	}{
+		{"AtrousWaveletRGBErr", func(bad [][]float32) error {
+			_, _, _, _, _, _, err := AtrousWaveletRGBErr(good, bad, good, 2)
+			return err
+		}},
+		{"AtrousReconstructRGBErr", func(bad [][]float32) error {
+			d := [][][]float32{good}
+			_, _, _, err := AtrousReconstructRGBErr(d, [][][]float32{bad}, d, good, good, good)
+			return err
+		}},
+		{"MultiBandRGBErr", func(bad [][]float32) error {
+			_, _, _, _, _, _, err := MultiBandRGBErr(good, good, bad, 2, 1)
+			return err
+		}},
+		{"MultiBandReconstructRGBErr", func(bad [][]float32) error {
+			d := [][][]float32{good}
+			_, _, _, err := MultiBandReconstructRGBErr(d, d, d, good, bad, good)
+			return err
+		}},
+		{"SplitLowHighRGBErr", func(bad [][]float32) error {
+			_, _, _, _, _, _, err := SplitLowHighRGBErr(bad, good, good, 1)
+			return err
+		}},
+		{"ReconstructLowHighRGBErr", func(bad [][]float32) error {
+			_, _, _, err := ReconstructLowHighRGBErr(good, good, good, bad, good, good)
+			return err
+		}},
+		{"MaxAbsErrorRGBErr", func(bad [][]float32) error {
+			_, _, _, err := MaxAbsErrorRGBErr(good, good, good, good, good, bad)
+			return err
+		}},
+		{"DiffImageRGBErr", func(bad [][]float32) error {
+			_, _, _, err := DiffImageRGBErr(good, bad, good, good, good, good)
+			return err
+		}},
+	}
+	inputs := []struct {
+		name string
+		bad  [][]float32
+		want error
+	}{
+		{"ragged", ragged, ErrDimensionMismatch},
+		{"mismatched", small, ErrDimensionMismatch},
+		{"empty", nil, ErrEmptyImage},
+	}
+	for _, tt := range tests {
+		for _, in := range inputs {
+			if err := tt.call(in.bad); !errors.Is(err, in.want) {
+				t.Errorf("%s(%s): got %v, want %v", tt.name, in.name, err, in.want)
+			}
+			if err := tt.call(good); err != nil {
+				t.Errorf("%s(good): %v", tt.name, err)
+			}
+		}
+	}
+}
+
+func TestRGBErrVariantsRejectBadParameters(t *testing.T) {
+	good := testRows(8, 6)
+	if _, _, _, _, _, _, err := AtrousWaveletRGBErr(good, good, good, -1); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("AtrousWaveletRGBErr(levels -1): got %v", err)
+	}
+	if _, _, _, _, _, _, err := MultiBandRGBErr(good, good, good, 2, 0); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("MultiBandRGBErr(sigma0 0): got %v", err)
+	}
+	if _, _, _, _, _, _, err := SplitLowHighRGBErr(good, good, good, -1); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("SplitLowHighRGBErr(sigma -1): got %v", err)
+	}
+}
+
+// The unchecked wrappers must panic on the caller's
+// goroutine, where it can be recovered, not in a worker.
+func TestRGBWrapperPanicIsRecoverable(t *testing.T) {
+	ragged := testRows(8, 6)
+	ragged[2] = ragged[2][:3]
+	defer func() {
+		r := recover()
+		err, ok := r.(error)
+		if !ok || !errors.Is(err, ErrDimensionMismatch) {
+			t.Errorf("recovered %v, want ErrDimensionMismatch", r)
+		}
+	}()
+	good := testRows(8, 6)
+	AtrousWaveletRGB(good, ragged, good, 2)
+}
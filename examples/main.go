@@ -169,11 +169,14 @@ func main() {
 	// Estimate PSF from stars
 	kx, ky := freq.EstimatePSF(L, 0.01)
 
-	// Deconvolve luminance only
-	Ldeconv := freq.RichardsonLucy(L, kx, ky, 25)
-
-	// Optional: mild post-blur to control ringing
-	Ldeconv = freq.GaussianBlur(Ldeconv, 0.5)
+	// Deconvolve luminance only, TV-regularized to keep
+	// noise from being amplified, until the estimate settles
+	// (at most 100 iterations)
+	Ldeconv, rlStats := freq.RichardsonLucyOpts(L, kx, ky, 100, freq.RLOptions{
+		Regularization: freq.RLTotalVariation,
+		Tolerance:      1e-3,
+	})
+	fmt.Println("RL iterations:", rlStats.Iterations, "residual:", rlStats.Residual)
 
 	// Back to RGB
 	rRL, gRL, bRL := freq.LabToRGBImage(Ldeconv, a, b2)
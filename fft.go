@@ -0,0 +1,388 @@
+// Fast Fourier transform
+package goimagefreq
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+)
+
+// maxDirectRadix is the largest prime factor handled by the
+// mixed-radix butterflies. Lengths with a larger prime factor
+// are transformed with Bluestein's algorithm.
+const maxDirectRadix = 13
+
+// FFTPlan holds the precomputed tables for complex FFTs of
+// one length. Plans are immutable and safe for concurrent use.
+//
+// Lengths whose prime factors are all <= 13 use a mixed-radix
+// Cooley–Tukey transform (radix 4, 2, 3, 5 and generic odd
+// radices); any other length goes through Bluestein's chirp-z
+// algorithm on a power-of-two plan.
+type FFTPlan struct {
+	n       int
+	factors []int // radix, remaining length, radix, ...
+	fwd     []complex128
+	inv     []complex128
+
+	// Bluestein
+	blue  *FFTPlan
+	chirp []complex128 // exp(-iπk²/n)
+	bfft  []complex128 // FFT of the conjugate chirp filter
+}
+
+var (
+	fftPlansMu sync.Mutex
+	fftPlans   = map[int]*FFTPlan{}
+)
+
+// PlanFFT returns the cached plan for length n, building it
+// on first use.
+func PlanFFT(n int) *FFTPlan {
+	fftPlansMu.Lock()
+	p, ok := fftPlans[n]
+	fftPlansMu.Unlock()
+	if ok {
+		return p
+	}
+
+	p = newFFTPlan(n)
+
+	fftPlansMu.Lock()
+	if q, ok := fftPlans[n]; ok {
+		p = q
+	} else {
+		fftPlans[n] = p
+	}
+	fftPlansMu.Unlock()
+	return p
+}
+
+func newFFTPlan(n int) *FFTPlan {
+	p := &FFTPlan{n: n}
+	if n <= 1 {
+		return p
+	}
+
+	factors, ok := fftFactor(n)
+	if !ok {
+		p.initBluestein()
+		return p
+	}
+
+	p.factors = factors
+	p.fwd = make([]complex128, n)
+	p.inv = make([]complex128, n)
+	for k := 0; k < n; k++ {
+		s, c := math.Sincos(-2 * math.Pi * float64(k) / float64(n))
+		p.fwd[k] = complex(c, s)
+		p.inv[k] = complex(c, -s)
+	}
+	return p
+}
+
+// fftFactor splits n into (radix, n/radix) pairs, preferring
+// radix 4. It reports false when n has a prime factor larger
+// than maxDirectRadix.
+func fftFactor(n int) ([]int, bool) {
+	var factors []int
+	rem := n
+	for rem > 1 {
+		r := 0
+		switch {
+		case rem%4 == 0:
+			r = 4
+		case rem%2 == 0:
+			r = 2
+		default:
+			for f := 3; f <= maxDirectRadix; f += 2 {
+				if rem%f == 0 {
+					r = f
+					break
+				}
+			}
+		}
+		if r == 0 {
+			return nil, false
+		}
+		rem /= r
+		factors = append(factors, r, rem)
+	}
+	return factors, true
+}
+
+func (p *FFTPlan) initBluestein() {
+	n := p.n
+	m := 1 << bits.Len(uint(2*n-2))
+	p.blue = PlanFFT(m)
+
+	p.chirp = make([]complex128, n)
+	for k := 0; k < n; k++ {
+		// k² mod 2n keeps the angle small for large k
+		kk := (k * k) % (2 * n)
+		s, c := math.Sincos(-math.Pi * float64(kk) / float64(n))
+		p.chirp[k] = complex(c, s)
+	}
+
+	b := make([]complex128, m)
+	b[0] = conj(p.chirp[0])
+	for k := 1; k < n; k++ {
+		b[k] = conj(p.chirp[k])
+		b[m-k] = b[k]
+	}
+	p.bfft = make([]complex128, m)
+	p.blue.transform(p.bfft, b, false)
+}
+
+// Len returns the transform length.
+func (p *FFTPlan) Len() int {
+	return p.n
+}
+
+// Forward computes the unnormalized DFT
+//
+//	dst[k] = Σ src[j]·exp(-2πi·jk/n)
+//
+// dst and src must have length n and may be the same slice.
+func (p *FFTPlan) Forward(dst, src []complex128) {
+	p.run(dst, src, false)
+}
+
+// Inverse computes the inverse DFT, normalized by 1/n so that
+// Inverse(Forward(x)) == x. dst and src may be the same slice.
+func (p *FFTPlan) Inverse(dst, src []complex128) {
+	p.run(dst, src, true)
+	s := 1 / float64(p.n)
+	for i := range dst {
+		dst[i] = complex(real(dst[i])*s, imag(dst[i])*s)
+	}
+}
+
+func (p *FFTPlan) run(dst, src []complex128, inverse bool) {
+	if len(dst) != p.n || len(src) != p.n {
+		panic("goimagefreq: FFT length mismatch")
+	}
+	if p.n > 0 && &dst[0] == &src[0] {
+		tmp := make([]complex128, p.n)
+		copy(tmp, src)
+		src = tmp
+	}
+	p.transform(dst, src, inverse)
+}
+
+// transform computes the unnormalized transform of src into
+// dst. dst and src must not overlap.
+func (p *FFTPlan) transform(dst, src []complex128, inverse bool) {
+	switch {
+	case p.n == 0:
+		return
+	case p.n == 1:
+		dst[0] = src[0]
+	case p.blue != nil:
+		p.bluestein(dst, src, inverse)
+	default:
+		p.work(dst, src, 1, p.factors, inverse)
+	}
+}
+
+// work is the recursive decimation-in-time step: it splits the
+// input into `radix` interleaved sub-sequences of length m,
+// transforms them into consecutive blocks of dst and combines
+// the blocks with a radix butterfly.
+func (p *FFTPlan) work(dst, src []complex128, stride int, factors []int, inverse bool) {
+	radix, m := factors[0], factors[1]
+
+	if m == 1 {
+		for j := 0; j < radix; j++ {
+			dst[j] = src[j*stride]
+		}
+	} else {
+		for j := 0; j < radix; j++ {
+			p.work(dst[j*m:], src[j*stride:], stride*radix, factors[2:], inverse)
+		}
+	}
+
+	tw := p.fwd
+	if inverse {
+		tw = p.inv
+	}
+
+	switch radix {
+	case 2:
+		butterfly2(dst, stride, m, tw)
+	case 3:
+		butterfly3(dst, stride, m, tw, inverse)
+	case 4:
+		butterfly4(dst, stride, m, tw, inverse)
+	case 5:
+		butterfly5(dst, stride, m, tw, inverse)
+	default:
+		butterflyGeneric(dst, stride, radix, m, tw)
+	}
+}
+
+func butterfly2(d []complex128, stride, m int, tw []complex128) {
+	for k := 0; k < m; k++ {
+		t := d[k+m] * tw[k*stride]
+		d[k+m] = d[k] - t
+		d[k] += t
+	}
+}
+
+// mulNegI returns c·(-i), or c·(+i) for the inverse transform.
+func mulNegI(c complex128, inverse bool) complex128 {
+	if inverse {
+		return complex(-imag(c), real(c))
+	}
+	return complex(imag(c), -real(c))
+}
+
+func butterfly3(d []complex128, stride, m int, tw []complex128, inverse bool) {
+	const s60 = 0.86602540378443864676 // sin(2π/3)
+	for k := 0; k < m; k++ {
+		t0 := d[k]
+		t1 := d[k+m] * tw[k*stride]
+		t2 := d[k+2*m] * tw[2*k*stride]
+
+		sum := t1 + t2
+		rot := mulNegI((t1-t2)*s60, inverse)
+		mid := t0 - sum*0.5
+
+		d[k] = t0 + sum
+		d[k+m] = mid + rot
+		d[k+2*m] = mid - rot
+	}
+}
+
+func butterfly5(d []complex128, stride, m int, tw []complex128, inverse bool) {
+	const (
+		c1 = 0.30901699437494742410  // cos(2π/5)
+		c2 = -0.80901699437494742410 // cos(4π/5)
+		s1 = 0.95105651629515357212  // sin(2π/5)
+		s2 = 0.58778525229247312917  // sin(4π/5)
+	)
+	for k := 0; k < m; k++ {
+		t0 := d[k]
+		t1 := d[k+m] * tw[k*stride]
+		t2 := d[k+2*m] * tw[2*k*stride]
+		t3 := d[k+3*m] * tw[3*k*stride]
+		t4 := d[k+4*m] * tw[4*k*stride]
+
+		a1, b1 := t1+t4, t1-t4
+		a2, b2 := t2+t3, t2-t3
+
+		m1 := t0 + a1*c1 + a2*c2
+		m2 := t0 + a1*c2 + a2*c1
+		r1 := mulNegI(b1*s1+b2*s2, inverse)
+		r2 := mulNegI(b1*s2-b2*s1, inverse)
+
+		d[k] = t0 + a1 + a2
+		d[k+m] = m1 + r1
+		d[k+4*m] = m1 - r1
+		d[k+2*m] = m2 + r2
+		d[k+3*m] = m2 - r2
+	}
+}
+
+func butterfly4(d []complex128, stride, m int, tw []complex128, inverse bool) {
+	for k := 0; k < m; k++ {
+		a0 := d[k]
+		a1 := d[k+m] * tw[k*stride]
+		a2 := d[k+2*m] * tw[2*k*stride]
+		a3 := d[k+3*m] * tw[3*k*stride]
+
+		s0 := a0 + a2
+		s1 := a0 - a2
+		s2 := a1 + a3
+		s3 := mulNegI(a1-a3, inverse)
+
+		d[k] = s0 + s2
+		d[k+m] = s1 + s3
+		d[k+2*m] = s0 - s2
+		d[k+3*m] = s1 - s3
+	}
+}
+
+// butterflyGeneric handles odd radices with a direct
+// radix-point DFT of each group.
+func butterflyGeneric(d []complex128, stride, radix, m int, tw []complex128) {
+	n := len(tw)
+	var buf [maxDirectRadix]complex128
+	scratch := buf[:radix]
+
+	for u := 0; u < m; u++ {
+		for q := 0; q < radix; q++ {
+			scratch[q] = d[u+q*m]
+		}
+		for q1 := 0; q1 < radix; q1++ {
+			k := u + q1*m
+			acc := scratch[0]
+			step := (k * stride) % n
+			idx := 0
+			for q2 := 1; q2 < radix; q2++ {
+				idx += step
+				if idx >= n {
+					idx -= n
+				}
+				acc += scratch[q2] * tw[idx]
+			}
+			d[k] = acc
+		}
+	}
+}
+
+// bluestein evaluates an arbitrary-length DFT as a circular
+// convolution of power-of-two length.
+func (p *FFTPlan) bluestein(dst, src []complex128, inverse bool) {
+	n := p.n
+	m := p.blue.n
+
+	a := make([]complex128, m)
+	for k := 0; k < n; k++ {
+		x := src[k]
+		if inverse {
+			x = conj(x)
+		}
+		a[k] = x * p.chirp[k]
+	}
+
+	fa := make([]complex128, m)
+	p.blue.transform(fa, a, false)
+	for i := range fa {
+		fa[i] *= p.bfft[i]
+	}
+	p.blue.transform(a, fa, true)
+
+	s := 1 / float64(m)
+	for k := 0; k < n; k++ {
+		v := a[k] * p.chirp[k]
+		v = complex(real(v)*s, imag(v)*s)
+		if inverse {
+			v = conj(v)
+		}
+		dst[k] = v
+	}
+}
+
+func conj(c complex128) complex128 {
+	return complex(real(c), -imag(c))
+}
+
+// NextFastFFTSize returns the smallest n' >= n whose prime
+// factors are only 2, 3 and 5, i.e. the cheapest padded size.
+func NextFastFFTSize(n int) int {
+	if n <= 1 {
+		return 1
+	}
+	for m := n; ; m++ {
+		r := m
+		for _, f := range [...]int{2, 3, 5} {
+			for r%f == 0 {
+				r /= f
+			}
+		}
+		if r == 1 {
+			return m
+		}
+	}
+}
@@ -0,0 +1,234 @@
+// 2D real-to-complex FFT for planes
+package goimagefreq
+
+import (
+	"runtime"
+	"sync"
+)
+
+// Spectrum is the 2D Fourier transform of a real W×H plane.
+//
+// Because the input is real the spectrum is Hermitian, so
+// only the non-negative horizontal frequencies are stored:
+// Data holds H rows of Cols = W/2+1 coefficients, with
+// frequency (u, v) at Data[v*Cols+u].
+type Spectrum struct {
+	W, H int
+	Cols int
+	Data []complex64
+}
+
+// NewSpectrum allocates a zeroed spectrum for a w×h plane.
+func NewSpectrum(w, h int) *Spectrum {
+	cols := w/2 + 1
+	return &Spectrum{
+		W:    w,
+		H:    h,
+		Cols: cols,
+		Data: make([]complex64, cols*h),
+	}
+}
+
+// Row returns the coefficients of vertical frequency v.
+func (s *Spectrum) Row(v int) []complex64 {
+	return s.Data[v*s.Cols : (v+1)*s.Cols]
+}
+
+// At returns frequency (u, v) for any u in [0, W), using
+// Hermitian symmetry for the half that is not stored.
+func (s *Spectrum) At(u, v int) complex64 {
+	if u < s.Cols {
+		return s.Data[v*s.Cols+u]
+	}
+	c := s.Data[((s.H-v)%s.H)*s.Cols+(s.W-u)]
+	return complex(real(c), -imag(c))
+}
+
+// Mul multiplies s by o element-wise, in place. Both spectra
+// must come from planes of the same size.
+func (s *Spectrum) Mul(o *Spectrum) {
+	for i, a := range s.Data {
+		s.Data[i] = complex64(complex128(a) * complex128(o.Data[i]))
+	}
+}
+
+// FFT2D computes the forward 2D DFT of a real plane.
+//
+// Rows are transformed two at a time by packing them into
+// the real and imaginary parts of one complex FFT, then the
+// W/2+1 columns are transformed. Both passes run in parallel.
+func FFT2D(p *Plane) *Spectrum {
+	w, h := p.W, p.H
+	s := NewSpectrum(w, h)
+	if w == 0 || h == 0 {
+		return s
+	}
+
+	rowPlan := PlanFFT(w)
+	cols := s.Cols
+
+	// Row pass: rows (2i, 2i+1) share one complex transform.
+	parallelChunks((h+1)/2, func(lo, hi int) {
+		z := make([]complex128, w)
+		zf := make([]complex128, w)
+		for pair := lo; pair < hi; pair++ {
+			y0 := 2 * pair
+			y1 := y0 + 1
+			r0 := p.Row(y0)
+			if y1 < h {
+				r1 := p.Row(y1)
+				for x := 0; x < w; x++ {
+					z[x] = complex(float64(r0[x]), float64(r1[x]))
+				}
+			} else {
+				for x := 0; x < w; x++ {
+					z[x] = complex(float64(r0[x]), 0)
+				}
+			}
+			rowPlan.transform(zf, z, false)
+
+			// Split the packed spectrum:
+			//   X0[k] = (Z[k] + conj(Z[-k])) / 2
+			//   X1[k] = (Z[k] - conj(Z[-k])) / 2i
+			o0 := s.Row(y0)
+			var o1 []complex64
+			if y1 < h {
+				o1 = s.Row(y1)
+			}
+			for k := 0; k < cols; k++ {
+				a := zf[k]
+				b := conj(zf[(w-k)%w])
+				x0 := (a + b) * 0.5
+				o0[k] = complex64(x0)
+				if o1 != nil {
+					d := (a - b) * 0.5
+					o1[k] = complex64(complex(imag(d), -real(d)))
+				}
+			}
+		}
+	})
+
+	// Column pass
+	colPlan := PlanFFT(h)
+	parallelChunks(cols, func(lo, hi int) {
+		c := make([]complex128, h)
+		cf := make([]complex128, h)
+		for u := lo; u < hi; u++ {
+			for v := 0; v < h; v++ {
+				c[v] = complex128(s.Data[v*cols+u])
+			}
+			colPlan.transform(cf, c, false)
+			for v := 0; v < h; v++ {
+				s.Data[v*cols+u] = complex64(cf[v])
+			}
+		}
+	})
+
+	return s
+}
+
+// IFFT2D computes the inverse of FFT2D, including the
+// 1/(W·H) normalization, and returns a real plane.
+// The spectrum is left unmodified.
+func IFFT2D(s *Spectrum) *Plane {
+	w, h := s.W, s.H
+	out := NewPlane(w, h)
+	if w == 0 || h == 0 {
+		return out
+	}
+
+	cols := s.Cols
+	tmp := make([]complex64, len(s.Data))
+
+	// Column pass
+	colPlan := PlanFFT(h)
+	parallelChunks(cols, func(lo, hi int) {
+		c := make([]complex128, h)
+		cf := make([]complex128, h)
+		for u := lo; u < hi; u++ {
+			for v := 0; v < h; v++ {
+				c[v] = complex128(s.Data[v*cols+u])
+			}
+			colPlan.transform(cf, c, true)
+			for v := 0; v < h; v++ {
+				tmp[v*cols+u] = complex64(cf[v])
+			}
+		}
+	})
+
+	// Row pass: rebuild the full Hermitian rows of two
+	// outputs as Z = X0 + i·X1 and invert them together.
+	rowPlan := PlanFFT(w)
+	scale := 1 / (float64(w) * float64(h))
+	parallelChunks((h+1)/2, func(lo, hi int) {
+		z := make([]complex128, w)
+		zt := make([]complex128, w)
+		for pair := lo; pair < hi; pair++ {
+			y0 := 2 * pair
+			y1 := y0 + 1
+			x0 := tmp[y0*cols : (y0+1)*cols]
+			var x1 []complex64
+			if y1 < h {
+				x1 = tmp[y1*cols : (y1+1)*cols]
+			}
+			for k := 0; k < w; k++ {
+				var a, b complex128
+				if k < cols {
+					a = complex128(x0[k])
+					if x1 != nil {
+						b = complex128(x1[k])
+					}
+				} else {
+					a = conj(complex128(x0[w-k]))
+					if x1 != nil {
+						b = conj(complex128(x1[w-k]))
+					}
+				}
+				// a + i·b
+				z[k] = complex(real(a)-imag(b), imag(a)+real(b))
+			}
+			rowPlan.transform(zt, z, true)
+
+			r0 := out.Row(y0)
+			for x := 0; x < w; x++ {
+				r0[x] = float32(real(zt[x]) * scale)
+			}
+			if y1 < h {
+				r1 := out.Row(y1)
+				for x := 0; x < w; x++ {
+					r1[x] = float32(imag(zt[x]) * scale)
+				}
+			}
+		}
+	})
+
+	return out
+}
+
+// parallelChunks splits [0, n) into contiguous ranges, one
+// batch per worker, so each worker can reuse its scratch
+// buffers across the whole range.
+func parallelChunks(n int, fn func(lo, hi int)) {
+	if n <= 0 {
+		return
+	}
+	workers := runtime.GOMAXPROCS(0)
+	if workers > n {
+		workers = n
+	}
+	chunk := (n + workers - 1) / workers
+
+	wg := sync.WaitGroup{}
+	for lo := 0; lo < n; lo += chunk {
+		hi := lo + chunk
+		if hi > n {
+			hi = n
+		}
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			fn(lo, hi)
+		}(lo, hi)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,181 @@
+package goimagefreq
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"testing"
+)
+
+// naiveDFT is the O(n²) reference transform.
+func naiveDFT(x []complex128, inverse bool) []complex128 {
+	n := len(x)
+	sign := -1.0
+	if inverse {
+		sign = 1
+	}
+	out := make([]complex128, n)
+	for k := range out {
+		var s complex128
+		for j, v := range x {
+			// Reduce jk mod n first to keep the angle accurate.
+			a := sign * 2 * math.Pi * float64((j*k)%n) / float64(n)
+			s += v * cmplx.Rect(1, a)
+		}
+		out[k] = s
+	}
+	return out
+}
+
+func randomComplex(r *rand.Rand, n int) []complex128 {
+	x := make([]complex128, n)
+	for i := range x {
+		x[i] = complex(r.NormFloat64(), r.NormFloat64())
+	}
+	return x
+}
+
+// maxRelDiff returns max|a−b| relative to the largest |b|.
+func maxRelDiff(a, b []complex128) float64 {
+	var d, scale float64
+	for i := range a {
+		d = math.Max(d, cmplx.Abs(a[i]-b[i]))
+		scale = math.Max(scale, cmplx.Abs(b[i]))
+	}
+	if scale == 0 {
+		return d
+	}
+	return d / scale
+}
+
+func TestFFTPlanAgainstDFT(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tests := []struct {
+		n    int
+		kind string
+	}{
+		{1, "trivial"},
+		{2, "radix 2"},
+		{3, "radix 3"},
+		{4, "radix 4"},
+		{5, "radix 5"},
+		{7, "generic odd radix"},
+		{8, "radix 4·2"},
+		{11, "generic odd radix"},
+		{13, "largest direct radix"},
+		{12, "mixed 4·3"},
+		{30, "mixed 2·3·5"},
+		{60, "mixed 4·3·5"},
+		{64, "power of 4"},
+		{143, "mixed 11·13"},
+		{360, "mixed 4·2·3·3·5"},
+		{1000, "mixed 4·2·5·5·5"},
+		{17, "Bluestein prime"},
+		{34, "Bluestein 2·17"},
+		{97, "Bluestein prime"},
+		{221, "Bluestein 13·17"},
+		{1009, "Bluestein large prime"},
+	}
+	for _, tt := range tests {
+		p := PlanFFT(tt.n)
+		if p.Len() != tt.n {
+			t.Fatalf("n=%d: plan length %d", tt.n, p.Len())
+		}
+		x := randomComplex(r, tt.n)
+		tol := 1e-12 * float64(tt.n)
+
+		got := make([]complex128, tt.n)
+		p.Forward(got, x)
+		if e := maxRelDiff(got, naiveDFT(x, false)); e > tol {
+			t.Errorf("n=%d (%s): forward error %g", tt.n, tt.kind, e)
+		}
+
+		back := make([]complex128, tt.n)
+		p.Inverse(back, got)
+		if e := maxRelDiff(back, x); e > tol {
+			t.Errorf("n=%d (%s): round-trip error %g", tt.n, tt.kind, e)
+		}
+
+		// In place.
+		inPlace := append([]complex128(nil), x...)
+		p.Forward(inPlace, inPlace)
+		if e := maxRelDiff(inPlace, got); e > tol {
+			t.Errorf("n=%d (%s): in-place forward differs by %g", tt.n, tt.kind, e)
+		}
+		p.Inverse(inPlace, inPlace)
+		if e := maxRelDiff(inPlace, x); e > tol {
+			t.Errorf("n=%d (%s): in-place round-trip error %g", tt.n, tt.kind, e)
+		}
+	}
+}
+
+func TestPlanFFTIsCached(t *testing.T) {
+	if PlanFFT(48) != PlanFFT(48) {
+		t.Error("PlanFFT(48) returned two different plans")
+	}
+}
+
+func TestFFT2DAgainstDFT(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	sizes := [][2]int{{1, 1}, {2, 1}, {1, 5}, {5, 3}, {8, 8}, {7, 10}, {17, 6}, {32, 12}, {19, 23}}
+	for _, sz := range sizes {
+		w, h := sz[0], sz[1]
+		p := NewPlane(w, h)
+		for i := range p.Data {
+			p.Data[i] = float32(r.NormFloat64())
+		}
+		spec := FFT2D(p)
+
+		// Reference: 1D DFT of every row, then of every column.
+		ref := make([][]complex128, h)
+		for y := range ref {
+			row := make([]complex128, w)
+			for x, v := range p.Row(y) {
+				row[x] = complex(float64(v), 0)
+			}
+			ref[y] = naiveDFT(row, false)
+		}
+		for u := 0; u < w; u++ {
+			col := make([]complex128, h)
+			for v := range col {
+				col[v] = ref[v][u]
+			}
+			col = naiveDFT(col, false)
+			for v := range col {
+				ref[v][u] = col[v]
+			}
+		}
+
+		var maxErr, scale float64
+		for v := 0; v < h; v++ {
+			for u := 0; u < w; u++ {
+				got := complex128(spec.At(u, v))
+				maxErr = math.Max(maxErr, cmplx.Abs(got-ref[v][u]))
+				scale = math.Max(scale, cmplx.Abs(ref[v][u]))
+			}
+		}
+		if maxErr > 1e-5*scale {
+			t.Errorf("%dx%d: FFT2D error %g (scale %g)", w, h, maxErr, scale)
+		}
+
+		back := IFFT2D(spec)
+		if back.W != w || back.H != h {
+			t.Fatalf("%dx%d: IFFT2D returned %dx%d", w, h, back.W, back.H)
+		}
+		if e := MaxAbsErrorPlane(back, p); e > 1e-5 {
+			t.Errorf("%dx%d: round-trip error %g", w, h, e)
+		}
+	}
+}
+
+func TestNextFastFFTSize(t *testing.T) {
+	tests := []struct{ n, want int }{
+		{0, 1}, {1, 1}, {2, 2}, {7, 8}, {11, 12}, {13, 15}, {17, 18},
+		{97, 100}, {121, 125}, {500, 500}, {513, 540}, {1025, 1080},
+	}
+	for _, tt := range tests {
+		if got := NextFastFFTSize(tt.n); got != tt.want {
+			t.Errorf("NextFastFFTSize(%d) = %d, want %d", tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,596 @@
+// FITS image reader and writer
+package goimagefreq
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	fitsBlock   = 2880
+	fitsCardLen = 80
+)
+
+// FITSCard is one 80-character header record.
+//
+// Value holds the raw value field as written in the file
+// (strings keep their quotes), so unknown keywords round-trip
+// unchanged. Commentary cards (COMMENT, HISTORY, blank) have
+// no value and carry their text in Comment.
+type FITSCard struct {
+	Key     string
+	Value   string
+	Comment string
+}
+
+// FITSHeader is an ordered list of header cards.
+type FITSHeader struct {
+	Cards []FITSCard
+}
+
+// FITSImage is the primary HDU of a FITS file.
+//
+// Planes holds NAXIS3 planes (1 for gray, 3 for RGB cubes)
+// in physical units, i.e. BZERO + BSCALE·stored. Rows are
+// kept in file order: Planes[c].Row(0) is the first row
+// stored in the file.
+//
+// Header holds every card except the structural ones
+// (SIMPLE, BITPIX, NAXISn, EXTEND, BZERO, BSCALE, END),
+// which are regenerated from the fields on write.
+type FITSImage struct {
+	BitPix int
+	BZero  float64
+	BScale float64
+	Planes []*Plane
+	Header FITSHeader
+}
+
+// NewFITSImage wraps planes as a FITS image with the given
+// BITPIX (8, 16, 32, 64, -32 or -64).
+//
+// For BITPIX 16 the unsigned convention BZERO = 32768 is
+// used, so 0..65535 data stores without clipping.
+func NewFITSImage(bitpix int, planes ...*Plane) *FITSImage {
+	f := &FITSImage{BitPix: bitpix, BScale: 1, Planes: planes}
+	if bitpix == 16 {
+		f.BZero = 32768
+	}
+	return f
+}
+
+// FITSImageFromRGB wraps an RGBImage as a 3-plane cube.
+func FITSImageFromRGB(img RGBImage, bitpix int) *FITSImage {
+	r, g, b := img.Planes()
+	return NewFITSImage(bitpix, r, g, b)
+}
+
+// Gray returns the first plane.
+func (f *FITSImage) Gray() *Plane {
+	return f.Planes[0]
+}
+
+// RGB returns the cube as an RGBImage. It fails unless the
+// image has exactly three planes.
+func (f *FITSImage) RGB() (RGBImage, error) {
+	if len(f.Planes) != 3 {
+		return RGBImage{}, fmt.Errorf("fits: RGB needs 3 planes, have %d", len(f.Planes))
+	}
+	return RGBImageFromPlanes(f.Planes[0], f.Planes[1], f.Planes[2]), nil
+}
+
+// Get returns the raw value of the first card named key.
+func (h *FITSHeader) Get(key string) (string, bool) {
+	key = strings.ToUpper(key)
+	for _, c := range h.Cards {
+		if c.Key == key && c.Value != "" {
+			return c.Value, true
+		}
+	}
+	return "", false
+}
+
+// String returns a string keyword with quotes and
+// trailing blanks removed.
+func (h *FITSHeader) String(key string) (string, bool) {
+	v, ok := h.Get(key)
+	if !ok {
+		return "", false
+	}
+	return fitsUnquote(v), true
+}
+
+// Float returns a numeric keyword.
+func (h *FITSHeader) Float(key string) (float64, bool) {
+	v, ok := h.Get(key)
+	if !ok {
+		return 0, false
+	}
+	// FITS allows Fortran-style exponents
+	f, err := strconv.ParseFloat(strings.Replace(v, "D", "E", 1), 64)
+	return f, err == nil
+}
+
+// Int returns an integer keyword.
+func (h *FITSHeader) Int(key string) (int, bool) {
+	f, ok := h.Float(key)
+	return int(f), ok
+}
+
+// Set adds or replaces the value card key. value may be a
+// string, bool, integer or floating-point number.
+func (h *FITSHeader) Set(key string, value any, comment string) {
+	key = strings.ToUpper(key)
+	card := FITSCard{Key: key, Value: fitsFormatValue(value), Comment: comment}
+	for i, c := range h.Cards {
+		if c.Key == key && c.Value != "" {
+			h.Cards[i] = card
+			return
+		}
+	}
+	h.Cards = append(h.Cards, card)
+}
+
+// Add appends a commentary card (COMMENT, HISTORY, ...).
+func (h *FITSHeader) Add(key, text string) {
+	h.Cards = append(h.Cards, FITSCard{Key: strings.ToUpper(key), Comment: text})
+}
+
+func fitsFormatValue(v any) string {
+	switch x := v.(type) {
+	case string:
+		return "'" + strings.ReplaceAll(x, "'", "''") + "'"
+	case bool:
+		if x {
+			return "T"
+		}
+		return "F"
+	case int:
+		return strconv.Itoa(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float32:
+		return strconv.FormatFloat(float64(x), 'G', -1, 32)
+	case float64:
+		s := strconv.FormatFloat(x, 'G', -1, 64)
+		if !strings.ContainsAny(s, ".EN") {
+			s += ".0"
+		}
+		return s
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+func fitsUnquote(v string) string {
+	if len(v) < 2 || v[0] != '\'' {
+		return v
+	}
+	s := v[1 : len(v)-1]
+	s = strings.ReplaceAll(s, "''", "'")
+	return strings.TrimRight(s, " ")
+}
+
+// fitsStructural reports keywords regenerated on write.
+func fitsStructural(key string) bool {
+	switch key {
+	case "SIMPLE", "BITPIX", "NAXIS", "EXTEND", "BZERO", "BSCALE", "END":
+		return true
+	}
+	return strings.HasPrefix(key, "NAXIS")
+}
+
+// parseFITSCard splits an 80-byte record.
+func parseFITSCard(rec string) FITSCard {
+	key := strings.TrimRight(rec[:8], " ")
+	if rec[8:10] != "= " {
+		return FITSCard{Key: key, Comment: strings.TrimRight(rec[8:], " ")}
+	}
+
+	field := rec[10:]
+	var value, comment string
+	trimmed := strings.TrimLeft(field, " ")
+	if strings.HasPrefix(trimmed, "'") {
+		// string value: '' escapes a quote
+		i := 1
+		for i < len(trimmed) {
+			if trimmed[i] == '\'' {
+				if i+1 < len(trimmed) && trimmed[i+1] == '\'' {
+					i += 2
+					continue
+				}
+				break
+			}
+			i++
+		}
+		end := min(i+1, len(trimmed))
+		value = trimmed[:end]
+		comment = trimmed[end:]
+	} else if i := strings.IndexByte(field, '/'); i >= 0 {
+		value, comment = field[:i], field[i:]
+	} else {
+		value = field
+	}
+
+	comment = strings.TrimSpace(comment)
+	comment = strings.TrimSpace(strings.TrimPrefix(comment, "/"))
+	return FITSCard{Key: key, Value: strings.TrimSpace(value), Comment: comment}
+}
+
+// formatFITSCard renders a card as an 80-byte record.
+func formatFITSCard(c FITSCard) string {
+	var s string
+	switch {
+	case c.Value == "":
+		s = fmt.Sprintf("%-8s%s", c.Key, c.Comment)
+	case strings.HasPrefix(c.Value, "'"):
+		s = fmt.Sprintf("%-8s= %-20s", c.Key, fitsPadString(c.Value))
+	default:
+		s = fmt.Sprintf("%-8s= %20s", c.Key, c.Value)
+	}
+	if c.Value != "" && c.Comment != "" {
+		s += " / " + c.Comment
+	}
+	if len(s) > fitsCardLen {
+		s = s[:fitsCardLen]
+	}
+	return s + strings.Repeat(" ", fitsCardLen-len(s))
+}
+
+// fitsPadString pads a quoted string to the 8-character
+// minimum required by the standard.
+func fitsPadString(v string) string {
+	inner := v[1 : len(v)-1]
+	if len(inner) < 8 {
+		inner += strings.Repeat(" ", 8-len(inner))
+	}
+	return "'" + inner + "'"
+}
+
+// LoadFITS reads a FITS file from disk.
+func LoadFITS(path string) (*FITSImage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadFITS(f)
+}
+
+// ReadFITS decodes the primary image HDU of a FITS stream.
+//
+// BITPIX 8, 16, 32, 64, -32 and -64 are supported with
+// BZERO/BSCALE scaling. Integer pixels equal to BLANK are
+// returned as NaN. Samples are converted to float32, which is
+// exact for 8/16-bit and float32 data.
+func ReadFITS(r io.Reader) (*FITSImage, error) {
+	br := bufio.NewReader(r)
+
+	var all FITSHeader
+	rec := make([]byte, fitsCardLen)
+	n := 0
+	for {
+		if _, err := io.ReadFull(br, rec); err != nil {
+			return nil, fmt.Errorf("fits: reading header: %w", err)
+		}
+		n++
+		c := parseFITSCard(string(rec))
+		if c.Key == "END" {
+			break
+		}
+		all.Cards = append(all.Cards, c)
+	}
+	// skip the rest of the header block
+	if rem := (n * fitsCardLen) % fitsBlock; rem != 0 {
+		if _, err := br.Discard(fitsBlock - rem); err != nil {
+			return nil, fmt.Errorf("fits: reading header: %w", err)
+		}
+	}
+
+	if v, _ := all.Get("SIMPLE"); v != "T" {
+		return nil, fmt.Errorf("fits: not a FITS file (SIMPLE != T)")
+	}
+	bitpix, ok := all.Int("BITPIX")
+	if !ok {
+		return nil, fmt.Errorf("fits: missing BITPIX")
+	}
+	naxis, _ := all.Int("NAXIS")
+	if naxis < 2 || naxis > 3 {
+		return nil, fmt.Errorf("fits: unsupported NAXIS = %d", naxis)
+	}
+	w, _ := all.Int("NAXIS1")
+	h, _ := all.Int("NAXIS2")
+	depth := 1
+	if naxis == 3 {
+		depth, _ = all.Int("NAXIS3")
+	}
+	if w <= 0 || h <= 0 || depth <= 0 {
+		return nil, fmt.Errorf("fits: invalid dimensions %dx%dx%d", w, h, depth)
+	}
+
+	img := &FITSImage{BitPix: bitpix, BScale: 1}
+	if v, ok := all.Float("BZERO"); ok {
+		img.BZero = v
+	}
+	if v, ok := all.Float("BSCALE"); ok {
+		img.BScale = v
+	}
+	for _, c := range all.Cards {
+		if !fitsStructural(c.Key) {
+			img.Header.Cards = append(img.Header.Cards, c)
+		}
+	}
+
+	bytesPer := 0
+	switch bitpix {
+	case 8, 16, 32, 64, -32, -64:
+		bytesPer = absInt(bitpix) / 8
+	default:
+		return nil, fmt.Errorf("fits: unsupported BITPIX = %d", bitpix)
+	}
+	blank, hasBlank := all.Int("BLANK")
+	if bitpix < 0 {
+		hasBlank = false
+	}
+
+	size, ok := mulDims(w, h, depth, bytesPer)
+	if _, ok4 := mulDims(w, h, depth, 4); !ok || !ok4 {
+		return nil, fmt.Errorf("fits: %dx%dx%d image with BITPIX %d is too large", w, h, depth, bitpix)
+	}
+	// Only allocate the planes up front when the stream is
+	// known to hold the data; otherwise grow them as samples
+	// arrive, so a bogus header cannot demand gigabytes
+	// before EOF.
+	left, known := streamRemaining(r)
+	if known && left+int64(br.Buffered()) < int64(size) {
+		return nil, fmt.Errorf("fits: %w: header needs %d data bytes, %d left",
+			io.ErrUnexpectedEOF, size, left+int64(br.Buffered()))
+	}
+
+	// Planes are unpadded, so samples are decoded in chunks
+	// straight into Data.
+	const chunk = 1 << 14
+	samples := w * h
+	buf := make([]byte, min(samples, chunk)*bytesPer)
+	for c := 0; c < depth; c++ {
+		p := &Plane{W: w, H: h, Stride: w}
+		if known {
+			p.Data = make([]float32, samples)
+		}
+		for off := 0; off < samples; off += chunk {
+			k := min(chunk, samples-off)
+			if _, err := io.ReadFull(br, buf[:k*bytesPer]); err != nil {
+				return nil, fmt.Errorf("fits: reading data: %w", err)
+			}
+			if !known {
+				p.Data = append(p.Data, make([]float32, k)...)
+			}
+			decodeFITSRow(p.Data[off:off+k], buf, bitpix, img.BZero, img.BScale, int64(blank), hasBlank)
+		}
+		img.Planes = append(img.Planes, p)
+	}
+
+	return img, nil
+}
+
+func decodeFITSRow(dst []float32, src []byte, bitpix int, bzero, bscale float64, blank int64, hasBlank bool) {
+	be := binary.BigEndian
+	for x := range dst {
+		var v float64
+		var raw int64
+		switch bitpix {
+		case 8:
+			raw = int64(src[x])
+		case 16:
+			raw = int64(int16(be.Uint16(src[2*x:])))
+		case 32:
+			raw = int64(int32(be.Uint32(src[4*x:])))
+		case 64:
+			raw = int64(be.Uint64(src[8*x:]))
+		case -32:
+			v = float64(math.Float32frombits(be.Uint32(src[4*x:])))
+		case -64:
+			v = math.Float64frombits(be.Uint64(src[8*x:]))
+		}
+		if bitpix > 0 {
+			if hasBlank && raw == blank {
+				dst[x] = float32(math.NaN())
+				continue
+			}
+			v = float64(raw)
+		}
+		dst[x] = float32(bzero + bscale*v)
+	}
+}
+
+// SaveFITS writes img to path.
+func SaveFITS(path string, img *FITSImage) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteFITS(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteFITS encodes img as a single-HDU FITS stream.
+//
+// Integer BITPIX values are stored as
+// round((v - BZERO) / BSCALE), clipped to the type range;
+// NaN becomes BLANK if the header defines it, 0 otherwise.
+func WriteFITS(w io.Writer, img *FITSImage) error {
+	if len(img.Planes) == 0 {
+		return fmt.Errorf("fits: no planes to write: %w", ErrEmptyImage)
+	}
+	switch img.BitPix {
+	case 8, 16, 32, 64, -32, -64:
+	default:
+		return fmt.Errorf("fits: unsupported BITPIX = %d", img.BitPix)
+	}
+	pw, ph := img.Planes[0].W, img.Planes[0].H
+	for _, p := range img.Planes {
+		if p.W != pw || p.H != ph {
+			return fmt.Errorf("fits: planes differ in size: %w", ErrDimensionMismatch)
+		}
+	}
+	bscale := img.BScale
+	if bscale == 0 {
+		bscale = 1
+	}
+
+	var hdr FITSHeader
+	hdr.Set("SIMPLE", true, "conforms to FITS standard")
+	hdr.Set("BITPIX", img.BitPix, "array data type")
+	if len(img.Planes) == 1 {
+		hdr.Set("NAXIS", 2, "number of array dimensions")
+	} else {
+		hdr.Set("NAXIS", 3, "number of array dimensions")
+	}
+	hdr.Set("NAXIS1", pw, "")
+	hdr.Set("NAXIS2", ph, "")
+	if len(img.Planes) > 1 {
+		hdr.Set("NAXIS3", len(img.Planes), "")
+	}
+	if img.BZero != 0 {
+		hdr.Set("BZERO", img.BZero, "")
+	}
+	if bscale != 1 {
+		hdr.Set("BSCALE", bscale, "")
+	}
+	for _, c := range img.Header.Cards {
+		if !fitsStructural(c.Key) {
+			hdr.Cards = append(hdr.Cards, c)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	n := 0
+	for _, c := range hdr.Cards {
+		bw.WriteString(formatFITSCard(c))
+		n++
+	}
+	bw.WriteString(formatFITSCard(FITSCard{Key: "END"}))
+	n++
+	if rem := (n * fitsCardLen) % fitsBlock; rem != 0 {
+		bw.WriteString(strings.Repeat(" ", fitsBlock-rem))
+	}
+
+	blank, hasBlank := img.Header.Int("BLANK")
+	bytesPer := absInt(img.BitPix) / 8
+	buf := make([]byte, pw*bytesPer)
+	for _, p := range img.Planes {
+		for y := 0; y < ph; y++ {
+			encodeFITSRow(buf, p.Row(y), img.BitPix, img.BZero, bscale, int64(blank), hasBlank)
+			if _, err := bw.Write(buf); err != nil {
+				return err
+			}
+		}
+	}
+	total := pw * ph * len(img.Planes) * bytesPer
+	if rem := total % fitsBlock; rem != 0 {
+		bw.Write(make([]byte, fitsBlock-rem))
+	}
+	return bw.Flush()
+}
+
+func encodeFITSRow(dst []byte, src []float32, bitpix int, bzero, bscale float64, blank int64, hasBlank bool) {
+	be := binary.BigEndian
+	for x, f := range src {
+		if bitpix < 0 {
+			v := (float64(f) - bzero) / bscale
+			if bitpix == -32 {
+				be.PutUint32(dst[4*x:], math.Float32bits(float32(v)))
+			} else {
+				be.PutUint64(dst[8*x:], math.Float64bits(v))
+			}
+			continue
+		}
+
+		var raw int64
+		if math.IsNaN(float64(f)) {
+			if hasBlank {
+				raw = blank
+			}
+		} else {
+			v := math.Round((float64(f) - bzero) / bscale)
+			lo, hi := fitsIntRange(bitpix)
+			v = math.Max(lo, math.Min(hi, v))
+			raw = int64(v)
+		}
+		switch bitpix {
+		case 8:
+			dst[x] = uint8(raw)
+		case 16:
+			be.PutUint16(dst[2*x:], uint16(int16(raw)))
+		case 32:
+			be.PutUint32(dst[4*x:], uint32(int32(raw)))
+		case 64:
+			be.PutUint64(dst[8*x:], uint64(raw))
+		}
+	}
+}
+
+func fitsIntRange(bitpix int) (lo, hi float64) {
+	switch bitpix {
+	case 8:
+		return 0, math.MaxUint8
+	case 16:
+		return math.MinInt16, math.MaxInt16
+	case 32:
+		return math.MinInt32, math.MaxInt32
+	}
+	return math.MinInt64, math.Nextafter(math.MaxInt64, 0)
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// mulDims returns the product of positive dims, or false if
+// any is non-positive or the product overflows int.
+func mulDims(dims ...int) (int, bool) {
+	n := 1
+	for _, d := range dims {
+		if d <= 0 || n > math.MaxInt/d {
+			return 0, false
+		}
+		n *= d
+	}
+	return n, true
+}
+
+// streamRemaining reports how many unread bytes r holds, for
+// readers that can tell without consuming them: in-memory
+// readers with Len and seekable files.
+func streamRemaining(r io.Reader) (int64, bool) {
+	switch s := r.(type) {
+	case interface{ Len() int }:
+		return int64(s.Len()), true
+	case io.Seeker:
+		cur, err := s.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, false
+		}
+		end, err := s.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, false
+		}
+		if _, err := s.Seek(cur, io.SeekStart); err != nil {
+			return 0, false
+		}
+		return end - cur, true
+	}
+	return 0, false
+}
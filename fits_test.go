@@ -0,0 +1,172 @@
+package goimagefreq
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// onlyReader hides Len and Seek, like a pipe.
+type onlyReader struct{ io.Reader }
+
+// fitsTestPlanes returns depth w×h planes of values the given
+// BITPIX stores exactly after BZERO/BSCALE.
+func fitsTestPlanes(bitpix, w, h, depth int, bzero, bscale float64) []*Plane {
+	planes := make([]*Plane, depth)
+	lo, hi := fitsIntRange(bitpix)
+	if bitpix < 0 || hi > 1<<20 {
+		lo, hi = -1<<20, 1<<20
+	}
+	for c := range planes {
+		p := NewPlane(w, h)
+		for i := range p.Data {
+			raw := lo + math.Mod(float64(i*7919+c*104729), hi-lo+1)
+			p.Data[i] = float32(bzero + bscale*raw)
+		}
+		planes[c] = p
+	}
+	return planes
+}
+
+func TestFITSRoundTrip(t *testing.T) {
+	tests := []struct {
+		bitpix        int
+		bzero, bscale float64
+	}{
+		{8, 0, 1},
+		{16, 32768, 1},
+		{16, 0, 1},
+		{32, 0, 1},
+		{32, 100, 0.5},
+		{64, 0, 1},
+		{-32, 0, 1},
+		{-64, 0, 1},
+		{-32, 1, 2},
+	}
+	for _, tt := range tests {
+		for _, depth := range []int{1, 3} {
+			name := fmt.Sprintf("BITPIX %d BZERO %g BSCALE %g depth %d", tt.bitpix, tt.bzero, tt.bscale, depth)
+			img := &FITSImage{BitPix: tt.bitpix, BZero: tt.bzero, BScale: tt.bscale,
+				Planes: fitsTestPlanes(tt.bitpix, 13, 7, depth, tt.bzero, tt.bscale)}
+			img.Header.Set("OBJECT", "M 31", "target")
+
+			var buf bytes.Buffer
+			if err := WriteFITS(&buf, img); err != nil {
+				t.Fatalf("%s: WriteFITS: %v", name, err)
+			}
+			if buf.Len()%fitsBlock != 0 {
+				t.Errorf("%s: file is %d bytes, not a multiple of %d", name, buf.Len(), fitsBlock)
+			}
+			for _, r := range []io.Reader{bytes.NewReader(buf.Bytes()), onlyReader{bytes.NewReader(buf.Bytes())}} {
+				got, err := ReadFITS(r)
+				if err != nil {
+					t.Fatalf("%s: ReadFITS(%T): %v", name, r, err)
+				}
+				if got.BitPix != tt.bitpix || got.BZero != tt.bzero || got.BScale != tt.bscale {
+					t.Errorf("%s: read BITPIX %d BZERO %g BSCALE %g", name, got.BitPix, got.BZero, got.BScale)
+				}
+				if len(got.Planes) != depth {
+					t.Fatalf("%s: read %d planes", name, len(got.Planes))
+				}
+				for c, p := range got.Planes {
+					if p.W != 13 || p.H != 7 {
+						t.Fatalf("%s: plane %d is %dx%d", name, c, p.W, p.H)
+					}
+					if err := MaxAbsErrorPlane(p, img.Planes[c]); err != 0 {
+						t.Errorf("%s: plane %d differs by %g", name, c, err)
+					}
+				}
+				if v, _ := got.Header.String("OBJECT"); v != "M 31" {
+					t.Errorf("%s: OBJECT = %q", name, v)
+				}
+			}
+		}
+	}
+}
+
+func TestFITSBlankRoundTrip(t *testing.T) {
+	for _, bitpix := range []int{8, 16, 32, 64} {
+		p := NewPlane(4, 3)
+		p.Set(2, 1, float32(math.NaN()))
+		img := NewFITSImage(bitpix, p)
+		img.Header.Set("BLANK", 0, "")
+		if bitpix == 16 {
+			img.Header.Set("BLANK", -32768, "")
+		}
+		var buf bytes.Buffer
+		if err := WriteFITS(&buf, img); err != nil {
+			t.Fatalf("BITPIX %d: WriteFITS: %v", bitpix, err)
+		}
+		got, err := ReadFITS(&buf)
+		if err != nil {
+			t.Fatalf("BITPIX %d: ReadFITS: %v", bitpix, err)
+		}
+		if v := got.Planes[0].At(2, 1); !math.IsNaN(float64(v)) {
+			t.Errorf("BITPIX %d: BLANK pixel read as %g", bitpix, v)
+		}
+	}
+}
+
+// fitsTestHeader returns a header block with the given cards.
+func fitsTestHeader(cards ...string) []byte {
+	var b strings.Builder
+	for _, c := range append(cards, "END") {
+		b.WriteString(fmt.Sprintf("%-80s", c))
+	}
+	for b.Len()%fitsBlock != 0 {
+		b.WriteByte(' ')
+	}
+	return []byte(b.String())
+}
+
+func TestReadFITSRejectsHostileHeader(t *testing.T) {
+	tests := []struct {
+		name  string
+		cards []string
+		data  int
+		want  error
+	}{
+		{"huge plane", []string{"SIMPLE  = T", "BITPIX  = 8", "NAXIS   = 2",
+			"NAXIS1  = 65535", "NAXIS2  = 65535"}, 100, io.ErrUnexpectedEOF},
+		{"huge row", []string{"SIMPLE  = T", "BITPIX  = -64", "NAXIS   = 2",
+			"NAXIS1  = 2147483647", "NAXIS2  = 1"}, 100, io.ErrUnexpectedEOF},
+		{"short data", []string{"SIMPLE  = T", "BITPIX  = 16", "NAXIS   = 3",
+			"NAXIS1  = 10", "NAXIS2  = 10", "NAXIS3  = 3"}, 599, io.ErrUnexpectedEOF},
+		{"overflow", []string{"SIMPLE  = T", "BITPIX  = 64", "NAXIS   = 3",
+			"NAXIS1  = 4294967296", "NAXIS2  = 4294967296", "NAXIS3  = 3"}, 0, nil},
+		{"negative", []string{"SIMPLE  = T", "BITPIX  = 8", "NAXIS   = 2",
+			"NAXIS1  = -5", "NAXIS2  = 5"}, 0, nil},
+	}
+	for _, tt := range tests {
+		file := append(fitsTestHeader(tt.cards...), make([]byte, tt.data)...)
+		for _, r := range []io.Reader{bytes.NewReader(file), onlyReader{bytes.NewReader(file)}} {
+			img, err := ReadFITS(r)
+			if err == nil {
+				t.Errorf("%s (%T): read a %dx%d image", tt.name, r, img.Planes[0].W, img.Planes[0].H)
+				continue
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("%s (%T): got %v, want %v", tt.name, r, err, tt.want)
+			}
+		}
+	}
+}
+
+// LoadFITS sees an *os.File, whose size is found by seeking.
+func TestLoadFITSShortFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "short.fits")
+	file := append(fitsTestHeader("SIMPLE  = T", "BITPIX  = 8", "NAXIS   = 2",
+		"NAXIS1  = 65535", "NAXIS2  = 65535"), make([]byte, 100)...)
+	if err := os.WriteFile(path, file, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadFITS(path); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
@@ -6,8 +6,25 @@ import "math"
 // GaussianKernel generates a 1D normalized Gaussian kernel.
 //
 // Radius is chosen as 3*sigma, which captures >99%
-// of the Gaussian energy.
+// of the Gaussian energy. A sigma of 0 means no blur and
+// yields the identity kernel {1}; a negative, NaN or
+// infinite sigma panics with ErrInvalidParameter (see
+// GaussianKernelErr).
 func GaussianKernel(sigma float64) []float64 {
+	k, err := GaussianKernelErr(sigma)
+	panicOnError(err)
+	return k
+}
+
+// GaussianKernelErr is GaussianKernel returning an error
+// instead of panicking on a negative, NaN or infinite sigma.
+func GaussianKernelErr(sigma float64) ([]float64, error) {
+	if err := validateBlurSigma("sigma", sigma); err != nil {
+		return nil, err
+	}
+	if sigma == 0 {
+		return []float64{1}, nil
+	}
 	r := int(math.Ceil(3 * sigma))
 	size := 2*r + 1
 	k := make([]float64, size)
@@ -21,5 +38,5 @@ func GaussianKernel(sigma float64) []float64 {
 	for i := range k {
 		k[i] /= total
 	}
-	return k
+	return k, nil
 }
@@ -0,0 +1,78 @@
+package goimagefreq
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// wideGaussianKernel is the normalized Gaussian truncated
+// at 8σ, the reference GaussianRecursive is documented
+// against.
+func wideGaussianKernel(sigma float64) []float64 {
+	r := int(math.Ceil(8 * sigma))
+	k := make([]float64, 2*r+1)
+	var sum float64
+	for i := -r; i <= r; i++ {
+		k[i+r] = math.Exp(-float64(i*i) / (2 * sigma * sigma))
+		sum += k[i+r]
+	}
+	for i := range k {
+		k[i] /= sum
+	}
+	return k
+}
+
+// recursiveTestImages are images in [0,1]: noise, a step
+// and isolated points, which stress the tails the most.
+func recursiveTestImages() map[string]*Plane {
+	const w, h = 96, 80
+	step, points := NewPlane(w, h), NewPlane(w, h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if x > 40 {
+				step.Set(x, y, 1)
+			}
+			if x%23 == 5 && y%19 == 7 {
+				points.Set(x, y, 1)
+			}
+		}
+	}
+	return map[string]*Plane{
+		"noise":  randomPlane(rand.New(rand.NewSource(26)), w, h),
+		"step":   step,
+		"points": points,
+	}
+}
+
+// GaussianRecursive stays within its documented 3e-4 of
+// the 8σ Gaussian and 4e-3 of the FIR blur.
+func TestGaussianRecursiveAccuracy(t *testing.T) {
+	for name, src := range recursiveTestImages() {
+		for _, sigma := range []float64{1, 2.5, 6, 12} {
+			k := wideGaussianKernel(sigma)
+			for _, e := range testEdges {
+				label := fmt.Sprintf("%s sigma %g %s", name, sigma, edgeName(e))
+				rec := GaussianBlurMethodPlane(src, sigma, e, GaussianRecursive)
+				if d := MaxAbsErrorPlane(rec, Convolve2DSeparablePlane(src, k, k, e)); d > 3e-4 {
+					t.Errorf("%s: %g from the 8σ Gaussian", label, d)
+				}
+				if d := MaxAbsErrorPlane(rec, GaussianBlurMethodPlane(src, sigma, e, GaussianFIR)); d > 4e-3 {
+					t.Errorf("%s: %g from the FIR blur", label, d)
+				}
+			}
+		}
+	}
+}
+
+// Below recursiveMinSigma the recursive method is the FIR.
+func TestGaussianRecursiveSmallSigmaFallsBack(t *testing.T) {
+	src := recursiveTestImages()["noise"]
+	for _, sigma := range []float64{0.3, 0.8} {
+		rec := GaussianBlurMethodPlane(src, sigma, Edge{}, GaussianRecursive)
+		if d := MaxAbsErrorPlane(rec, GaussianBlurMethodPlane(src, sigma, Edge{}, GaussianFIR)); d != 0 {
+			t.Errorf("sigma %g: differs from the FIR blur by %g", sigma, d)
+		}
+	}
+}
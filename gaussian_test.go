@@ -0,0 +1,72 @@
+package goimagefreq
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestGaussianKernelErr(t *testing.T) {
+	for _, sigma := range []float64{-1, math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, err := GaussianKernelErr(sigma); !errors.Is(err, ErrInvalidParameter) {
+			t.Errorf("GaussianKernelErr(%g): got %v, want ErrInvalidParameter", sigma, err)
+		}
+	}
+
+	k, err := GaussianKernelErr(0)
+	if err != nil || len(k) != 1 || k[0] != 1 {
+		t.Errorf("GaussianKernelErr(0) = %v, %v, want identity", k, err)
+	}
+
+	for _, sigma := range []float64{0.3, 1, 2.5} {
+		k, err := GaussianKernelErr(sigma)
+		if err != nil {
+			t.Fatalf("GaussianKernelErr(%g): %v", sigma, err)
+		}
+		if want := 2*int(math.Ceil(3*sigma)) + 1; len(k) != want {
+			t.Errorf("sigma %g: %d taps, want %d", sigma, len(k), want)
+		}
+		var sum float64
+		for i, v := range k {
+			sum += v
+			if v != k[len(k)-1-i] {
+				t.Errorf("sigma %g: kernel not symmetric", sigma)
+				break
+			}
+		}
+		if math.Abs(sum-1) > 1e-12 {
+			t.Errorf("sigma %g: sum %g, want 1", sigma, sum)
+		}
+	}
+}
+
+func TestGaussianKernelPanicsOnInvalidSigma(t *testing.T) {
+	defer func() {
+		err, ok := recover().(error)
+		if !ok || !errors.Is(err, ErrInvalidParameter) {
+			t.Errorf("recovered %v, want ErrInvalidParameter", err)
+		}
+	}()
+	GaussianKernel(math.NaN())
+}
+
+// Sigma 0 is no blur for both the kernel and the blur.
+func TestGaussianBlurSigmaZero(t *testing.T) {
+	src := randomPlane(rand.New(rand.NewSource(12)), 9, 7)
+	for _, method := range []GaussianMethod{GaussianFIR, GaussianRecursive} {
+		out, err := GaussianBlurMethodPlaneCtx(context.Background(), src, 0, Edge{}, method, nil)
+		if err != nil {
+			t.Fatalf("method %d: %v", method, err)
+		}
+		if e := MaxAbsErrorPlane(out, src); e != 0 {
+			t.Errorf("method %d: sigma 0 changed the image by %g", method, e)
+		}
+	}
+	for _, sigma := range []float64{-1, math.NaN(), math.Inf(1)} {
+		if _, err := GaussianBlurPlaneCtx(context.Background(), src, sigma, Edge{}, nil); !errors.Is(err, ErrInvalidParameter) {
+			t.Errorf("sigma %g: got %v, want ErrInvalidParameter", sigma, err)
+		}
+	}
+}
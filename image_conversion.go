@@ -4,7 +4,6 @@ package goimagefreq
 import (
 	"image"
 	"image/color"
-	"sync"
 )
 
 type RGBImage struct {
@@ -12,8 +11,26 @@ type RGBImage struct {
 	R, G, B [][]float32
 }
 
-// ToGrayF32 converts a generic image.Image into a
-// 2D float32 grayscale buffer.
+// RGBImageFromPlanes wraps three planes as an RGBImage.
+// The channel rows alias the plane buffers.
+func RGBImageFromPlanes(r, g, b *Plane) RGBImage {
+	return RGBImage{
+		W: r.W,
+		H: r.H,
+		R: r.Rows(),
+		G: g.Rows(),
+		B: b.Rows(),
+	}
+}
+
+// Planes returns the R, G and B channels as planes
+// (zero-copy when the rows are contiguous).
+func (img RGBImage) Planes() (r, g, b *Plane) {
+	return PlaneFromRows(img.R), PlaneFromRows(img.G), PlaneFromRows(img.B)
+}
+
+// ToGrayPlane converts a generic image.Image into a
+// float32 grayscale plane.
 //
 // Output values are normalized to [0,1] using
 // ITU-R BT.709 luminance coefficients:
@@ -22,15 +39,15 @@ type RGBImage struct {
 //
 // This preserves perceived brightness and is suitable
 // for frequency-domain operations.
-func ToGrayF32(img image.Image) [][]float32 {
+func ToGrayPlane(img image.Image) *Plane {
 	b := img.Bounds()
 	w, h := b.Dx(), b.Dy()
-	out := make([][]float32, h)
+	out := NewPlane(w, h)
 	for y := 0; y < h; y++ {
-		out[y] = make([]float32, w)
+		row := out.Row(y)
 		for x := 0; x < w; x++ {
 			r, g, bb, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
-			out[y][x] = float32(0.2126*float64(r)/65535.0 +
+			row[x] = float32(0.2126*float64(r)/65535.0 +
 				0.7152*float64(g)/65535.0 +
 				0.0722*float64(bb)/65535.0)
 		}
@@ -38,32 +55,24 @@ func ToGrayF32(img image.Image) [][]float32 {
 	return out
 }
 
-// F32ToGray converts a float32 grayscale matrix into
+// ToGrayF32 is the [][]float32 adapter for ToGrayPlane.
+func ToGrayF32(img image.Image) [][]float32 {
+	return ToGrayPlane(img).Rows()
+}
+
+// PlaneToGray converts a float32 grayscale plane into
 // an 8-bit image.Gray for visualization.
 //
 // The data is linearly normalized to [0,255].
 // This is intended ONLY for display/debugging,
 // not for scientific output.
-func F32ToGray(img [][]float32) *image.Gray {
-	h := len(img)
-	w := 0
-	if h > 0 {
-		w = len(img[0])
-	}
+func PlaneToGray(img *Plane) *image.Gray {
+	h := img.H
+	w := img.W
 	out := image.NewGray(image.Rect(0, 0, w, h))
 
 	// Find min/max for linear normalization
-	minv, maxv := float32(1e9), float32(-1e9)
-	for y := 0; y < h; y++ {
-		for x := 0; x < w; x++ {
-			if img[y][x] < minv {
-				minv = img[y][x]
-			}
-			if img[y][x] > maxv {
-				maxv = img[y][x]
-			}
-		}
-	}
+	minv, maxv := planeMinMax(img)
 
 	// Avoid division by zero
 	scale := float32(1.0)
@@ -75,93 +84,66 @@ func F32ToGray(img [][]float32) *image.Gray {
 
 	// Normalize and convert to uint8
 	for y := 0; y < h; y++ {
-		for x := 0; x < w; x++ {
-			v := uint8(255 * (img[y][x] - minv) * scale)
-			out.SetGray(x, y, color.Gray{Y: v})
+		for x, v := range img.Row(y) {
+			out.SetGray(x, y, color.Gray{Y: uint8(255 * (v - minv) * scale)})
 		}
 	}
 	return out
 }
 
-// ToRGBF32 converts image.Image to three float32 matrices (R, G, B) in range [0,1].
+// F32ToGray is the [][]float32 adapter for PlaneToGray.
+func F32ToGray(img [][]float32) *image.Gray {
+	return PlaneToGray(PlaneFromRows(img))
+}
+
+// ToRGBPlanes converts image.Image to three float32 planes (R, G, B) in range [0,1].
 // It respects arbitrary image bounds.
-func ToRGBF32(img image.Image) (rOut, gOut, bOut [][]float32) {
+func ToRGBPlanes(img image.Image) (rOut, gOut, bOut *Plane) {
 	b := img.Bounds()
 	w, h := b.Dx(), b.Dy()
 
-	rOut = make([][]float32, h)
-	gOut = make([][]float32, h)
-	bOut = make([][]float32, h)
-
-	var wg sync.WaitGroup
-	wg.Add(h)
+	rOut = NewPlane(w, h)
+	gOut = NewPlane(w, h)
+	bOut = NewPlane(w, h)
 
-	for y := 0; y < h; y++ {
-		y := y
-		go func() {
-			defer wg.Done()
-			rRow := make([]float32, w)
-			gRow := make([]float32, w)
-			bRow := make([]float32, w)
-
-			for x := 0; x < w; x++ {
-				rr, gg, bb, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
-				// Normalize from 0..65535 to 0..1
-				rRow[x] = float32(rr) / 65535.0
-				gRow[x] = float32(gg) / 65535.0
-				bRow[x] = float32(bb) / 65535.0
-			}
-
-			rOut[y] = rRow
-			gOut[y] = gRow
-			bOut[y] = bRow
-		}()
-	}
+	parallelRows(h, func(y int) {
+		rRow := rOut.Row(y)
+		gRow := gOut.Row(y)
+		bRow := bOut.Row(y)
 
-	wg.Wait()
+		for x := 0; x < w; x++ {
+			rr, gg, bb, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			// Normalize from 0..65535 to 0..1
+			rRow[x] = float32(rr) / 65535.0
+			gRow[x] = float32(gg) / 65535.0
+			bRow[x] = float32(bb) / 65535.0
+		}
+	})
 	return
 }
 
-// F32ToRGB converts three float32 matrices (R,G,B) into an *image.NRGBA suitable for PNG encoding.
+// ToRGBF32 is the [][]float32 adapter for ToRGBPlanes.
+func ToRGBF32(img image.Image) (rOut, gOut, bOut [][]float32) {
+	r, g, b := ToRGBPlanes(img)
+	return r.Rows(), g.Rows(), b.Rows()
+}
+
+// PlanesToRGB converts three float32 planes (R,G,B) into an *image.NRGBA suitable for PNG encoding.
 // Each channel is normalized independently (linear min/max).
 // FIXME: Add luminance normalization
-func F32ToRGB(rImg, gImg, bImg [][]float32) *image.NRGBA {
-	h := len(rImg)
+func PlanesToRGB(rImg, gImg, bImg *Plane) *image.NRGBA {
+	h := rImg.H
 	if h == 0 {
 		return image.NewNRGBA(image.Rect(0, 0, 0, 0))
 	}
-	w := len(rImg[0])
+	w := rImg.W
 	out := image.NewNRGBA(image.Rect(0, 0, w, h))
 
 	// find per-channel min/max
-	minR, maxR := float32(1e9), float32(-1e9)
-	minG, maxG := float32(1e9), float32(-1e9)
-	minB, maxB := float32(1e9), float32(-1e9)
-	for y := 0; y < h; y++ {
-		for x := 0; x < w; x++ {
-			v := rImg[y][x]
-			if v < minR {
-				minR = v
-			}
-			if v > maxR {
-				maxR = v
-			}
-			v = gImg[y][x]
-			if v < minG {
-				minG = v
-			}
-			if v > maxG {
-				maxG = v
-			}
-			v = bImg[y][x]
-			if v < minB {
-				minB = v
-			}
-			if v > maxB {
-				maxB = v
-			}
-		}
-	}
+	minR, maxR := planeMinMax(rImg)
+	minG, maxG := planeMinMax(gImg)
+	minB, maxB := planeMinMax(bImg)
+
 	// avoid division by zero
 	scaleR := float32(1.0)
 	scaleG := float32(1.0)
@@ -176,24 +158,90 @@ func F32ToRGB(rImg, gImg, bImg [][]float32) *image.NRGBA {
 		scaleB = 1.0 / (maxB - minB)
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(h)
+	parallelRows(h, func(y int) {
+		rowOff := y * out.Stride
+		rr, gg, bb := rImg.Row(y), gImg.Row(y), bImg.Row(y)
+		for x := 0; x < w; x++ {
+			out.Pix[rowOff+x*4+0] = uint8(255 * (rr[x] - minR) * scaleR)
+			out.Pix[rowOff+x*4+1] = uint8(255 * (gg[x] - minG) * scaleG)
+			out.Pix[rowOff+x*4+2] = uint8(255 * (bb[x] - minB) * scaleB)
+			// Set as fully opaque
+			out.Pix[rowOff+x*4+3] = 0xFF
+		}
+	})
 
-	for y := 0; y < h; y++ {
-		y := y
-		go func() {
-			defer wg.Done()
-			rowOff := y * out.Stride
-			for x := 0; x < w; x++ {
-				out.Pix[rowOff+x*4+0] = uint8(255 * (rImg[y][x] - minR) * scaleR)
-				out.Pix[rowOff+x*4+1] = uint8(255 * (gImg[y][x] - minG) * scaleG)
-				out.Pix[rowOff+x*4+2] = uint8(255 * (bImg[y][x] - minB) * scaleB)
-				// Set as fully opaque
-				out.Pix[rowOff+x*4+3] = 0xFF
+	return out
+}
+
+// F32ToRGB is the [][]float32 adapter for PlanesToRGB.
+func F32ToRGB(rImg, gImg, bImg [][]float32) *image.NRGBA {
+	return PlanesToRGB(PlaneFromRows(rImg), PlaneFromRows(gImg), PlaneFromRows(bImg))
+}
+
+// PlaneToGray16 maps [lo, hi] linearly onto 0..65535, clipping
+// values outside the range. Unlike PlaneToGray the mapping is
+// fixed, so absolute levels survive a save/load round trip.
+func PlaneToGray16(img *Plane, lo, hi float32) *image.Gray16 {
+	out := image.NewGray16(image.Rect(0, 0, img.W, img.H))
+	parallelRows(img.H, func(y int) {
+		rowOff := y * out.Stride
+		for x, v := range img.Row(y) {
+			q := quantize16(v, lo, hi)
+			out.Pix[rowOff+2*x] = uint8(q >> 8)
+			out.Pix[rowOff+2*x+1] = uint8(q)
+		}
+	})
+	return out
+}
+
+// PlanesToRGB64 maps [lo, hi] linearly onto 0..65535 in all
+// three channels, clipping values outside the range. The same
+// range is used for every channel so color balance is kept.
+func PlanesToRGB64(rImg, gImg, bImg *Plane, lo, hi float32) *image.RGBA64 {
+	w, h := rImg.W, rImg.H
+	out := image.NewRGBA64(image.Rect(0, 0, w, h))
+	parallelRows(h, func(y int) {
+		rowOff := y * out.Stride
+		rows := [3][]float32{rImg.Row(y), gImg.Row(y), bImg.Row(y)}
+		for x := 0; x < w; x++ {
+			px := out.Pix[rowOff+8*x : rowOff+8*x+8]
+			for c, row := range rows {
+				q := quantize16(row[x], lo, hi)
+				px[2*c] = uint8(q >> 8)
+				px[2*c+1] = uint8(q)
 			}
-		}()
+			// Set as fully opaque
+			px[6], px[7] = 0xFF, 0xFF
+		}
+	})
+	return out
+}
+
+// quantize16 maps v from [lo, hi] to 0..65535 with clipping.
+// NaN maps to 0.
+func quantize16(v, lo, hi float32) uint16 {
+	t := float64(v-lo) / float64(hi-lo)
+	if !(t > 0) {
+		return 0
 	}
+	if t >= 1 {
+		return 0xFFFF
+	}
+	return uint16(t*0xFFFF + 0.5)
+}
 
-	wg.Wait()
-	return out
+// planeMinMax returns the smallest and largest pixel of p.
+func planeMinMax(p *Plane) (minv, maxv float32) {
+	minv, maxv = float32(1e9), float32(-1e9)
+	for y := 0; y < p.H; y++ {
+		for _, v := range p.Row(y) {
+			if v < minv {
+				minv = v
+			}
+			if v > maxv {
+				maxv = v
+			}
+		}
+	}
+	return
 }
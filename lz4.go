@@ -0,0 +1,159 @@
+// LZ4 block codec (raw blocks, no frame) used by XISF
+package goimagefreq
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	lz4MinMatch     = 4
+	lz4MFLimit      = 12 // a match may not start in the last 12 bytes
+	lz4LastLiterals = 5  // the last 5 bytes are always literals
+	lz4HashLog      = 16
+	lz4MaxOffset    = 65535
+)
+
+var errLZ4Corrupt = errors.New("lz4: corrupt block")
+
+// lz4Compress encodes src as a single LZ4 block using a
+// greedy hash-chain-free matcher (fast, LZ4-default style).
+func lz4Compress(src []byte) []byte {
+	n := len(src)
+	dst := make([]byte, 0, n+n/255+16)
+	var table [1 << lz4HashLog]int32
+
+	anchor := 0
+	if n > lz4MFLimit {
+		limit := n - lz4MFLimit
+		for i := 0; i < limit; {
+			seq := binary.LittleEndian.Uint32(src[i:])
+			h := (seq * 2654435761) >> (32 - lz4HashLog)
+			ref := int(table[h]) - 1
+			table[h] = int32(i + 1)
+
+			if ref < 0 || i-ref > lz4MaxOffset || binary.LittleEndian.Uint32(src[ref:]) != seq {
+				i++
+				continue
+			}
+
+			mlen := lz4MinMatch
+			for i+mlen < n-lz4LastLiterals && src[ref+mlen] == src[i+mlen] {
+				mlen++
+			}
+
+			dst = lz4AppendSequence(dst, src[anchor:i], i-ref, mlen)
+			i += mlen
+			anchor = i
+		}
+	}
+
+	return lz4AppendSequence(dst, src[anchor:], 0, 0)
+}
+
+// lz4AppendSequence writes one token + literals (+ match).
+// A zero mlen emits the final literal-only sequence.
+func lz4AppendSequence(dst, lit []byte, offset, mlen int) []byte {
+	ll := len(lit)
+	ml := 0
+	if mlen > 0 {
+		ml = mlen - lz4MinMatch
+	}
+
+	token := byte(min(ll, 15)<<4) | byte(min(ml, 15))
+	dst = append(dst, token)
+	dst = lz4AppendLen(dst, ll)
+	dst = append(dst, lit...)
+
+	if mlen > 0 {
+		dst = append(dst, byte(offset), byte(offset>>8))
+		dst = lz4AppendLen(dst, ml)
+	}
+	return dst
+}
+
+func lz4AppendLen(dst []byte, l int) []byte {
+	if l < 15 {
+		return dst
+	}
+	l -= 15
+	for l >= 255 {
+		dst = append(dst, 255)
+		l -= 255
+	}
+	return append(dst, byte(l))
+}
+
+// lz4Decompress decodes one LZ4 block whose decoded size is
+// known to be size bytes.
+func lz4Decompress(src []byte, size int) ([]byte, error) {
+	dst := make([]byte, 0, size)
+	i := 0
+	for i < len(src) {
+		token := src[i]
+		i++
+
+		ll := int(token >> 4)
+		if ll == 15 {
+			for {
+				if i >= len(src) {
+					return nil, errLZ4Corrupt
+				}
+				b := src[i]
+				i++
+				ll += int(b)
+				if b != 255 {
+					break
+				}
+			}
+		}
+		if i+ll > len(src) || len(dst)+ll > size {
+			return nil, errLZ4Corrupt
+		}
+		dst = append(dst, src[i:i+ll]...)
+		i += ll
+
+		if i == len(src) {
+			break // final literal-only sequence
+		}
+
+		if i+2 > len(src) {
+			return nil, errLZ4Corrupt
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+		if offset == 0 || offset > len(dst) {
+			return nil, errLZ4Corrupt
+		}
+
+		ml := int(token & 15)
+		if ml == 15 {
+			for {
+				if i >= len(src) {
+					return nil, errLZ4Corrupt
+				}
+				b := src[i]
+				i++
+				ml += int(b)
+				if b != 255 {
+					break
+				}
+			}
+		}
+		ml += lz4MinMatch
+		if len(dst)+ml > size {
+			return nil, errLZ4Corrupt
+		}
+
+		// byte-wise copy: matches may overlap their output
+		start := len(dst) - offset
+		for k := 0; k < ml; k++ {
+			dst = append(dst, dst[start+k])
+		}
+	}
+
+	if len(dst) != size {
+		return nil, errLZ4Corrupt
+	}
+	return dst, nil
+}
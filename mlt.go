@@ -1,26 +1,64 @@
 // PixInsight-like MLT
 package goimagefreq
 
+import "context"
+
 // MLTParams defines PixInsight-style MLT controls
 type MLTParams struct {
 	Gain []float64 // per scale
 	Bias []float64 // per scale (negative suppresses noise)
+
+	// Transform decomposes L* (nil: à trous). Use
+	// MMTPlaneCtx or MedianWaveletTransform to sharpen or
+	// suppress layers without ringing around stars.
+	Transform Transform
 }
 
-// ApplyMLTLuminance applies MLT to L* channel only
-func ApplyMLTLuminance(L [][]float32, params MLTParams) [][]float32 {
+// ApplyMLTLuminancePlane applies MLT to L* channel only
+func ApplyMLTLuminancePlane(L *Plane, params MLTParams, edge Edge) *Plane {
+	out, err := ApplyMLTLuminancePlaneCtx(context.Background(), L, params, edge, nil)
+	panicOnError(err)
+	return out
+}
+
+// ApplyMLTLuminancePlaneCtx is ApplyMLTLuminancePlane with
+// cancellation. It reports one progress step per layer plus a
+// final step for the gains and reconstruction.
+func ApplyMLTLuminancePlaneCtx(ctx context.Context, L *Plane, params MLTParams, edge Edge, progress ProgressFunc) (*Plane, error) {
+	if len(params.Bias) < len(params.Gain) {
+		return nil, invalidParam("%d MLT biases for %d gains", len(params.Bias), len(params.Gain))
+	}
+
 	levels := len(params.Gain)
-	details, residual := AtrousWavelet(L, levels)
+	total := levels + 1
+	transform := params.Transform
+	if transform == nil {
+		transform = AtrousWaveletPlaneCtx
+	}
+	details, residual, err := transform(ctx, L, levels, edge, progress.withTotal(total))
+	if err != nil {
+		return nil, err
+	}
 
 	for i := 0; i < levels; i++ {
-		for y := range details[i] {
-			for x := range details[i][y] {
-				v := float64(details[i][y][x])
+		d := details[i]
+		for y := 0; y < d.H; y++ {
+			row := d.Row(y)
+			for x := range row {
+				v := float64(row[x])
 				v = params.Bias[i] + params.Gain[i]*v
-				details[i][y][x] = float32(v)
+				row[x] = float32(v)
 			}
 		}
 	}
 
-	return AtrousReconstruct(details, residual)
+	out := AtrousReconstructPlane(details, residual)
+	progress.report(total, total)
+	return out, nil
+}
+
+// ApplyMLTLuminance is the [][]float32 adapter for ApplyMLTLuminancePlane
+// (clamp-to-edge).
+func ApplyMLTLuminance(L [][]float32, params MLTParams) [][]float32 {
+	return ApplyMLTLuminancePlane(PlaneFromRows(L), params, Edge{}).Rows()
 }
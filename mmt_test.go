@@ -0,0 +1,67 @@
+package goimagefreq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func refMedian(src *Plane, r int, e Edge) *Plane {
+	out := NewPlane(src.W, src.H)
+	win := make([]float64, 0, (2*r+1)*(2*r+1))
+	for y := 0; y < src.H; y++ {
+		for x := 0; x < src.W; x++ {
+			win = win[:0]
+			for j := -r; j <= r; j++ {
+				for i := -r; i <= r; i++ {
+					win = append(win, float64(refSample(src, x+i, y+j, e)))
+				}
+			}
+			sort.Float64s(win)
+			out.Set(x, y, float32(win[len(win)/2]))
+		}
+	}
+	return out
+}
+
+func TestMedianFilter(t *testing.T) {
+	r := rand.New(rand.NewSource(13))
+	src := randomPlane(r, 23, 37) // taller than a ctxRowBlock
+	// Repeated values exercise the tie ordering of ranks.
+	for i := range src.Data {
+		if i%3 == 0 {
+			src.Data[i] = 0.5
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, radius := range []int{1, 2, 3, 5, 12} {
+		for _, e := range testEdges {
+			name := fmt.Sprintf("radius %d %s", radius, edgeName(e))
+			want := refMedian(src, radius, e)
+			for _, c := range []context.Context{context.Background(), ctx} {
+				got, err := medianFilter(c, src, radius, e)
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				if err := MaxAbsErrorPlane(got, want); err != 0 {
+					t.Errorf("%s: differs from the reference by %g", name, err)
+				}
+			}
+		}
+	}
+}
+
+func TestMedianFilterCanceled(t *testing.T) {
+	src := randomPlane(rand.New(rand.NewSource(14)), 20, 40)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, radius := range []int{1, 4} {
+		if _, err := medianFilter(ctx, src, radius, Edge{}); !errors.Is(err, context.Canceled) {
+			t.Errorf("radius %d: got %v, want %v", radius, err, context.Canceled)
+		}
+	}
+}
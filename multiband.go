@@ -2,93 +2,167 @@
 package goimagefreq
 
 import (
+	"context"
 	"math"
-	"sync"
 )
 
-// MultiBand performs a Gaussian pyramid-like decomposition
+// MultiBandPlane performs a Gaussian pyramid-like decomposition
 // using increasing sigma values.
 //
 // Each band captures a frequency range.
-func MultiBand(src [][]float32, levels int, sigma0 float64) (bands [][][]float32, residual [][]float32) {
+// Samples outside the image are read according to edge.
+func MultiBandPlane(src *Plane, levels int, sigma0 float64, edge Edge) (bands []*Plane, residual *Plane) {
+	bands, residual, err := MultiBandPlaneCtx(context.Background(), src, levels, sigma0, edge, nil)
+	panicOnError(err)
+	return bands, residual
+}
+
+// MultiBandPlaneCtx is MultiBandPlane with cancellation.
+// It reports one progress step per band.
+func MultiBandPlaneCtx(ctx context.Context, src *Plane, levels int, sigma0 float64, edge Edge, progress ProgressFunc) (bands []*Plane, residual *Plane, err error) {
+	return MultiBandMethodPlaneCtx(ctx, src, levels, sigma0, edge, GaussianFIR, progress)
+}
+
+// MultiBandMethodPlane is MultiBandPlane with the blurs
+// computed by the given method. With GaussianRecursive every
+// level costs the same, however large sigma0·2^i gets.
+func MultiBandMethodPlane(src *Plane, levels int, sigma0 float64, edge Edge, method GaussianMethod) (bands []*Plane, residual *Plane) {
+	bands, residual, err := MultiBandMethodPlaneCtx(context.Background(), src, levels, sigma0, edge, method, nil)
+	panicOnError(err)
+	return bands, residual
+}
+
+// MultiBandMethodPlaneCtx is MultiBandMethodPlane with
+// cancellation. It reports one progress step per band.
+func MultiBandMethodPlaneCtx(ctx context.Context, src *Plane, levels int, sigma0 float64, edge Edge, method GaussianMethod, progress ProgressFunc) (bands []*Plane, residual *Plane, err error) {
+	if err := validateTransform(src, levels, edge); err != nil {
+		return nil, nil, err
+	}
+	if err := validateSigma("sigma0", sigma0); err != nil {
+		return nil, nil, err
+	}
+	if err := method.validate(); err != nil {
+		return nil, nil, err
+	}
+
 	current := src
 	for i := 0; i < levels; i++ {
 		sigma := sigma0 * math.Pow(2, float64(i)) // geometric growth
-		low := GaussianBlur(current, sigma)
-		h := len(src)
-		w := len(src[0])
-		band := make([][]float32, h)
+		low, err := GaussianBlurMethodPlaneCtx(ctx, current, sigma, edge, method, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		h := src.H
+		w := src.W
+		band := NewPlane(w, h)
 		for y := 0; y < h; y++ {
-			band[y] = make([]float32, w)
+			cur, lo, b := current.Row(y), low.Row(y), band.Row(y)
 			for x := 0; x < w; x++ {
-				band[y][x] = current[y][x] - low[y][x]
+				b[x] = cur[x] - lo[x]
 			}
 		}
 		bands = append(bands, band)
 		current = low
+		progress.report(i+1, levels)
 	}
 	residual = current
-	return
+	return bands, residual, nil
 }
 
-// MultiBandReconstruct reconstrucs the image by
-// summing all bands plus residual.
-func MultiBandReconstruct(bands [][][]float32, residual [][]float32) [][]float32 {
-	h := len(residual)
-	w := len(residual[0])
-	out := make([][]float32, h)
-	for y := range out {
-		out[y] = make([]float32, w)
-		for x := range out[y] {
-			out[y][x] = residual[y][x]
-		}
+// MultiBand is the [][]float32 adapter for MultiBandPlane
+// (clamp-to-edge).
+func MultiBand(src [][]float32, levels int, sigma0 float64) (bands [][][]float32, residual [][]float32) {
+	b, r := MultiBandPlane(PlaneFromRows(src), levels, sigma0, Edge{})
+	return planesToRows(b), r.Rows()
+}
+
+// MultiBandMethod is the [][]float32 adapter for
+// MultiBandMethodPlane (clamp-to-edge).
+func MultiBandMethod(src [][]float32, levels int, sigma0 float64, method GaussianMethod) (bands [][][]float32, residual [][]float32) {
+	b, r := MultiBandMethodPlane(PlaneFromRows(src), levels, sigma0, Edge{}, method)
+	return planesToRows(b), r.Rows()
+}
+
+// MultiBandTransform returns MultiBandMethodPlaneCtx with
+// sigma0 and method as a Transform.
+func MultiBandTransform(sigma0 float64, method GaussianMethod) Transform {
+	return func(ctx context.Context, src *Plane, levels int, edge Edge, progress ProgressFunc) ([]*Plane, *Plane, error) {
+		return MultiBandMethodPlaneCtx(ctx, src, levels, sigma0, edge, method, progress)
 	}
+}
+
+// MultiBandReconstructPlane reconstrucs the image by
+// summing all bands plus residual.
+func MultiBandReconstructPlane(bands []*Plane, residual *Plane) *Plane {
+	h := residual.H
+	w := residual.W
+	out := residual.Clone()
 	for _, b := range bands {
 		for y := 0; y < h; y++ {
+			o, br := out.Row(y), b.Row(y)
 			for x := 0; x < w; x++ {
-				out[y][x] += b[y][x]
+				o[x] += br[x]
 			}
 		}
 	}
 	return out
 }
 
+// MultiBandReconstruct is the [][]float32 adapter for MultiBandReconstructPlane.
+func MultiBandReconstruct(bands [][][]float32, residual [][]float32) [][]float32 {
+	return MultiBandReconstructPlane(planesFromRows(bands), PlaneFromRows(residual)).Rows()
+}
+
 // MultiBandRGB splits into multiband per channel.
 func MultiBandRGB(r, g, b [][]float32, levels int, sigma0 float64) (rBands, gBands, bBands [][][]float32, rResid, gResid, bResid [][]float32) {
-	var wg sync.WaitGroup
-	wg.Add(3)
-
-	go func() {
-		defer wg.Done()
-		rBands, rResid = MultiBand(r, levels, sigma0)
-	}()
-	go func() {
-		defer wg.Done()
-		gBands, gResid = MultiBand(g, levels, sigma0)
-	}()
-	go func() {
-		defer wg.Done()
-		bBands, bResid = MultiBand(b, levels, sigma0)
-	}()
+	rBands, gBands, bBands, rResid, gResid, bResid, err := MultiBandRGBErr(r, g, b, levels, sigma0)
+	panicOnError(err)
 	return
 }
 
+// MultiBandRGBErr is MultiBandRGB returning an error instead
+// of panicking on empty, ragged or mismatched channels or
+// invalid parameters.
+func MultiBandRGBErr(r, g, b [][]float32, levels int, sigma0 float64) (rBands, gBands, bBands [][][]float32, rResid, gResid, bResid [][]float32, err error) {
+	if err := validateRowsSameSize(r, g, b); err != nil {
+		return nil, nil, nil, nil, nil, nil, err
+	}
+	type result struct {
+		bands    [][][]float32
+		residual [][]float32
+	}
+	in := [3][][]float32{r, g, b}
+	res, err := dispatchErr(3, func(c int) (result, error) {
+		bs, rs, err := MultiBandPlaneCtx(context.Background(), PlaneFromRows(in[c]), levels, sigma0, Edge{}, nil)
+		if err != nil {
+			return result{}, err
+		}
+		return result{planesToRows(bs), rs.Rows()}, nil
+	})
+	if err != nil {
+		return nil, nil, nil, nil, nil, nil, err
+	}
+	return res[0].bands, res[1].bands, res[2].bands, res[0].residual, res[1].residual, res[2].residual, nil
+}
+
 // MultiBandReconstructRGB reconstructs per channel.
 func MultiBandReconstructRGB(rBands, gBands, bBands [][][]float32, rResid, gResid, bResid [][]float32) (r, g, b [][]float32) {
-	var wg sync.WaitGroup
-	wg.Add(3)
-
-	go func() {
-		defer wg.Done()
-		r = MultiBandReconstruct(rBands, rResid)
-	}()
-	go func() {
-		defer wg.Done()
-		g = MultiBandReconstruct(gBands, gResid)
-	}()
-	go func() {
-		defer wg.Done()
-		b = MultiBandReconstruct(bBands, bResid)
-	}()
+	r, g, b, err := MultiBandReconstructRGBErr(rBands, gBands, bBands, rResid, gResid, bResid)
+	panicOnError(err)
 	return
 }
+
+// MultiBandReconstructRGBErr is MultiBandReconstructRGB
+// returning an error instead of panicking on empty, ragged
+// or mismatched layers.
+func MultiBandReconstructRGBErr(rBands, gBands, bBands [][][]float32, rResid, gResid, bResid [][]float32) (r, g, b [][]float32, err error) {
+	bands := [3][][][]float32{rBands, gBands, bBands}
+	resid := [3][][]float32{rResid, gResid, bResid}
+	if err := validateLayersRGB(bands, resid); err != nil {
+		return nil, nil, nil, err
+	}
+	out := dispatch(3, func(c int) [][]float32 {
+		return MultiBandReconstruct(bands[c], resid[c])
+	})
+	return out[0], out[1], out[2], nil
+}
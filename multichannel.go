@@ -0,0 +1,238 @@
+// Multi-channel images and per-channel dispatch
+package goimagefreq
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sync"
+)
+
+// MultiImage is an image with any number of channels plus an
+// optional alpha plane, e.g. gray (1), RGB (3), or a
+// narrowband stack such as Ha/OIII/SII/L (4).
+//
+// Alpha is nil for opaque images. It is carried through
+// Map and the converters untouched and never filtered.
+type MultiImage struct {
+	Channels []*Plane
+	Names    []string // optional, one per channel
+	Alpha    *Plane
+}
+
+// NewMultiImage allocates a W×H image with n zeroed channels
+// and, if alpha is set, an alpha plane filled with 1.
+func NewMultiImage(w, h, n int, alpha bool) *MultiImage {
+	m := &MultiImage{Channels: make([]*Plane, n)}
+	for c := range m.Channels {
+		m.Channels[c] = NewPlane(w, h)
+	}
+	if alpha {
+		m.Alpha = NewPlane(w, h)
+		m.Alpha.Fill(1)
+	}
+	return m
+}
+
+// MultiImageFromRGB wraps the channels of an RGBImage
+// (zero-copy when its rows are contiguous).
+func MultiImageFromRGB(img RGBImage) *MultiImage {
+	r, g, b := img.Planes()
+	return &MultiImage{Channels: []*Plane{r, g, b}, Names: []string{"R", "G", "B"}}
+}
+
+// W returns the image width.
+func (m *MultiImage) W() int { return m.Channels[0].W }
+
+// H returns the image height.
+func (m *MultiImage) H() int { return m.Channels[0].H }
+
+// Validate checks that the image has at least one channel and
+// that all channels and the alpha plane share one size.
+func (m *MultiImage) Validate() error {
+	if m == nil || len(m.Channels) == 0 {
+		return ErrEmptyImage
+	}
+	planes := m.Channels
+	if m.Alpha != nil {
+		planes = append(planes[:len(planes):len(planes)], m.Alpha)
+	}
+	if err := validateSameSize(planes...); err != nil {
+		return err
+	}
+	if m.Names != nil && len(m.Names) != len(m.Channels) {
+		return invalidParam("%d names for %d channels", len(m.Names), len(m.Channels))
+	}
+	return nil
+}
+
+// Clone returns a deep copy of m.
+func (m *MultiImage) Clone() *MultiImage {
+	out := &MultiImage{
+		Channels: PerChannel(m.Channels, func(_ int, p *Plane) *Plane { return p.Clone() }),
+		Names:    append([]string(nil), m.Names...),
+	}
+	if m.Alpha != nil {
+		out.Alpha = m.Alpha.Clone()
+	}
+	return out
+}
+
+// Map applies fn to every channel concurrently and returns a
+// new image with the results. Names are kept and alpha is
+// shared with m, not filtered.
+//
+//	blurred := img.Map(func(p *Plane) *Plane {
+//		return GaussianBlurPlane(p, 2, Edge{})
+//	})
+func (m *MultiImage) Map(fn func(p *Plane) *Plane) *MultiImage {
+	return &MultiImage{
+		Channels: PerChannel(m.Channels, func(_ int, p *Plane) *Plane { return fn(p) }),
+		Names:    m.Names,
+		Alpha:    m.Alpha,
+	}
+}
+
+// RGB returns a 3-channel image as an RGBImage (alpha is
+// dropped).
+func (m *MultiImage) RGB() (RGBImage, error) {
+	if len(m.Channels) != 3 {
+		return RGBImage{}, fmt.Errorf("%w: RGB needs 3 channels, have %d", ErrDimensionMismatch, len(m.Channels))
+	}
+	return RGBImageFromPlanes(m.Channels[0], m.Channels[1], m.Channels[2]), nil
+}
+
+// MultiImageFromImage converts an image.Image to a 1-channel
+// (gray models) or 3-channel image in [0,1]. Images that are
+// not opaque get an alpha plane, and their color channels are
+// un-premultiplied so filtering does not darken soft edges.
+func MultiImageFromImage(img image.Image) *MultiImage {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	n := 3
+	switch img.ColorModel() {
+	case color.GrayModel, color.Gray16Model:
+		n = 1
+	}
+	opaque := true
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		opaque = o.Opaque()
+	}
+	m := NewMultiImage(w, h, n, !opaque)
+
+	// Non-premultiplied sources are read directly: going
+	// through RGBA() would lose precision at low alpha.
+	at := func(x, y int) color.NRGBA64 {
+		return color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+	}
+	switch src := img.(type) {
+	case *image.NRGBA:
+		at = func(x, y int) color.NRGBA64 {
+			c := src.NRGBAAt(x, y)
+			return color.NRGBA64{uint16(c.R) * 0x101, uint16(c.G) * 0x101, uint16(c.B) * 0x101, uint16(c.A) * 0x101}
+		}
+	case *image.NRGBA64:
+		at = src.NRGBA64At
+	}
+
+	parallelRows(h, func(y int) {
+		for x := 0; x < w; x++ {
+			c := at(b.Min.X+x, b.Min.Y+y)
+			if n == 1 {
+				m.Channels[0].Row(y)[x] = float32(c.R) / 65535
+			} else {
+				m.Channels[0].Row(y)[x] = float32(c.R) / 65535
+				m.Channels[1].Row(y)[x] = float32(c.G) / 65535
+				m.Channels[2].Row(y)[x] = float32(c.B) / 65535
+			}
+			if m.Alpha != nil {
+				m.Alpha.Row(y)[x] = float32(c.A) / 65535
+			}
+		}
+	})
+	if n == 1 {
+		m.Names = []string{"L"}
+	} else {
+		m.Names = []string{"R", "G", "B"}
+	}
+	return m
+}
+
+// NRGBA64 maps [lo, hi] of a 1- or 3-channel image to 16 bits
+// with clipping, like PlanesToRGB64, keeping alpha (opaque
+// when m has none). Gray images are replicated to R, G and B.
+func (m *MultiImage) NRGBA64(lo, hi float32) (*image.NRGBA64, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	n := len(m.Channels)
+	if n != 1 && n != 3 {
+		return nil, fmt.Errorf("%w: need 1 or 3 channels, have %d", ErrDimensionMismatch, n)
+	}
+	w, h := m.W(), m.H()
+	out := image.NewNRGBA64(image.Rect(0, 0, w, h))
+	parallelRows(h, func(y int) {
+		rowOff := y * out.Stride
+		for x := 0; x < w; x++ {
+			px := out.Pix[rowOff+8*x : rowOff+8*x+8]
+			for c := 0; c < 3; c++ {
+				q := quantize16(m.Channels[c%n].Row(y)[x], lo, hi)
+				px[2*c] = uint8(q >> 8)
+				px[2*c+1] = uint8(q)
+			}
+			a := uint16(0xFFFF)
+			if m.Alpha != nil {
+				a = quantize16(m.Alpha.Row(y)[x], 0, 1)
+			}
+			px[6], px[7] = uint8(a>>8), uint8(a)
+		}
+	})
+	return out, nil
+}
+
+// PerChannel runs fn on every plane concurrently, one
+// goroutine per channel, and returns the results in channel
+// order once all of them have finished.
+func PerChannel[T any](channels []*Plane, fn func(c int, p *Plane) T) []T {
+	return dispatch(len(channels), func(c int) T { return fn(c, channels[c]) })
+}
+
+// PerChannelErr is PerChannel for functions that can fail.
+// It waits for every channel and returns the first error in
+// channel order.
+func PerChannelErr[T any](channels []*Plane, fn func(c int, p *Plane) (T, error)) ([]T, error) {
+	return dispatchErr(len(channels), func(c int) (T, error) { return fn(c, channels[c]) })
+}
+
+// dispatchErr is dispatch for functions that can fail. It
+// waits for all and returns the first error in index order.
+func dispatchErr[T any](n int, fn func(c int) (T, error)) ([]T, error) {
+	errs := make([]error, n)
+	out := dispatch(n, func(c int) T {
+		v, err := fn(c)
+		errs[c] = err
+		return v
+	})
+	for c, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("channel %d: %w", c, err)
+		}
+	}
+	return out, nil
+}
+
+// dispatch calls fn(0..n-1) concurrently and waits for all.
+func dispatch[T any](n int, fn func(c int) T) []T {
+	out := make([]T, n)
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for c := 0; c < n; c++ {
+		go func(c int) {
+			defer wg.Done()
+			out[c] = fn(c)
+		}(c)
+	}
+	wg.Wait()
+	return out
+}
@@ -0,0 +1,116 @@
+package goimagefreq
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// PerChannel runs the channels concurrently, keeps results in
+// channel order whatever order they finish in, and returns
+// only once every channel is done.
+func TestPerChannelOrderAndWait(t *testing.T) {
+	const n = 5
+	channels := make([]*Plane, n)
+	for c := range channels {
+		channels[c] = NewPlane(1, 1)
+		channels[c].Data[0] = float32(c)
+	}
+	// Channel c waits for channel c+1, so they finish last
+	// to first; this deadlocks unless they run concurrently.
+	finished := make([]chan struct{}, n)
+	for c := range finished {
+		finished[c] = make(chan struct{})
+	}
+	var done atomic.Int32
+	out := PerChannel(channels, func(c int, p *Plane) string {
+		if c+1 < n {
+			<-finished[c+1]
+		}
+		done.Add(1)
+		close(finished[c])
+		return fmt.Sprint(c, p.Data[0])
+	})
+	if got := done.Load(); got != n {
+		t.Fatalf("returned after %d of %d channels", got, n)
+	}
+	for c, v := range out {
+		if want := fmt.Sprint(c, float32(c)); v != want {
+			t.Errorf("result %d = %q, want %q", c, v, want)
+		}
+	}
+}
+
+func TestPerChannelErr(t *testing.T) {
+	channels := []*Plane{NewPlane(1, 1), NewPlane(1, 1), NewPlane(1, 1), NewPlane(1, 1)}
+	errOne, errThree := errors.New("one failed"), errors.New("three failed")
+	var done atomic.Int32
+	out, err := PerChannelErr(channels, func(c int, p *Plane) (int, error) {
+		defer done.Add(1)
+		switch c {
+		case 1:
+			return 0, errOne
+		case 3:
+			return 0, errThree
+		}
+		return c * 10, nil
+	})
+	if !errors.Is(err, errOne) || !strings.Contains(err.Error(), "channel 1") || out != nil {
+		t.Errorf("got %v, %v; want the channel 1 error", out, err)
+	}
+	if got := done.Load(); got != 4 {
+		t.Errorf("returned after %d of 4 channels", got)
+	}
+
+	out, err = PerChannelErr(channels, func(c int, p *Plane) (int, error) { return c * 10, nil })
+	if err != nil || len(out) != 4 || out[3] != 30 {
+		t.Errorf("got %v, %v", out, err)
+	}
+}
+
+func TestMultiImage(t *testing.T) {
+	m := NewMultiImage(6, 4, 4, true)
+	m.Names = []string{"Ha", "OIII", "SII", "L"}
+	if err := m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if m.W() != 6 || m.H() != 4 || m.Alpha.At(5, 3) != 1 {
+		t.Errorf("%dx%d image, alpha %g", m.W(), m.H(), m.Alpha.At(5, 3))
+	}
+	for c, p := range m.Channels {
+		p.Fill(float32(c + 1))
+	}
+
+	doubled := m.Map(func(p *Plane) *Plane {
+		out := p.Clone()
+		for i := range out.Data {
+			out.Data[i] *= 2
+		}
+		return out
+	})
+	for c, p := range doubled.Channels {
+		if p.At(2, 1) != float32(2*(c+1)) {
+			t.Errorf("Map channel %d = %g", c, p.At(2, 1))
+		}
+	}
+	if doubled.Alpha != m.Alpha || doubled.Names[3] != "L" {
+		t.Error("Map did not keep alpha and names")
+	}
+
+	if _, err := m.RGB(); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("RGB of 4 channels: got %v", err)
+	}
+	m.Alpha = NewPlane(6, 3)
+	if err := m.Validate(); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("mismatched alpha: got %v", err)
+	}
+	if err := (&MultiImage{}).Validate(); !errors.Is(err, ErrEmptyImage) {
+		t.Errorf("no channels: got %v", err)
+	}
+	m.Alpha, m.Names = nil, []string{"L"}
+	if err := m.Validate(); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("too few names: got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package goimagefreq
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestNonLocalMeansLabCtx(t *testing.T) {
+	clean, noisy := noisyRGB(24, 20, 0.02)
+	params := NLMParams{PatchRadius: 2, SearchRadius: 5}
+	out, err := NonLocalMeansLabCtx(context.Background(), noisy, params, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.W != 24 || out.H != 20 {
+		t.Fatalf("output is %dx%d", out.W, out.H)
+	}
+	checkLuminanceDenoised(t, "NonLocalMeansLabCtx", clean, noisy, out, 0.7)
+	if e := rgbMaxError(NonLocalMeansLab(noisy, params), out); e != 0 {
+		t.Errorf("NonLocalMeansLab differs from NonLocalMeansLabCtx by %g", e)
+	}
+}
+
+func TestNonLocalMeansLabCtxErrors(t *testing.T) {
+	_, noisy := noisyRGB(16, 16, 0.02)
+	short := noisy
+	short.B = noisy.B[:10]
+	if _, err := NonLocalMeansLabCtx(context.Background(), short, NLMParams{}, nil); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("short channel: got %v", err)
+	}
+	if _, err := NonLocalMeansLabCtx(context.Background(), RGBImage{}, NLMParams{}, nil); !errors.Is(err, ErrEmptyImage) {
+		t.Errorf("empty image: got %v", err)
+	}
+	if _, err := NonLocalMeansLabCtx(context.Background(), noisy, NLMParams{PatchRadius: -1}, nil); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("negative patch radius: got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NonLocalMeansLabCtx(ctx, noisy, NLMParams{}, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled: got %v", err)
+	}
+}
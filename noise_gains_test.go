@@ -0,0 +1,67 @@
+package goimagefreq
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// measuredGains decomposes white noise of unit sigma with tr
+// and returns the standard deviation of each detail layer
+// away from the borders.
+func measuredGains(t *testing.T, tr Transform, levels int) []float64 {
+	t.Helper()
+	r := rand.New(rand.NewSource(18))
+	const size, border = 256, 48
+	src := NewPlane(size, size)
+	for i := range src.Data {
+		src.Data[i] = float32(r.NormFloat64())
+	}
+	details, _, err := tr(context.Background(), src, levels, Edge{Mode: EdgeMirror}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gains := make([]float64, levels)
+	for i, d := range details {
+		var ss float64
+		n := 0
+		for y := border; y < size-border; y++ {
+			for _, v := range d.Row(y)[border : size-border] {
+				ss += float64(v) * float64(v)
+				n++
+			}
+		}
+		gains[i] = math.Sqrt(ss / float64(n))
+	}
+	return gains
+}
+
+func TestNoiseGainsMatchMonteCarlo(t *testing.T) {
+	const levels = 4
+	tests := []struct {
+		name  string
+		tr    Transform
+		gains []float64
+	}{
+		{"starlet", AtrousWaveletPlaneCtx, StarletNoiseGains(levels)},
+		{"SWT", SWTDecomposePlaneCtx, SWTNoiseGains(levels)},
+		{"multiband", MultiBandTransform(1, GaussianFIR), MultiBandNoiseGains(levels, 1)},
+	}
+	for _, tt := range tests {
+		got := measuredGains(t, tt.tr, levels)
+		for i, want := range tt.gains {
+			// the coarse layers have few independent samples
+			if math.Abs(got[i]-want) > 0.05*want {
+				t.Errorf("%s layer %d: measured %.4f, table %.4f", tt.name, i, got[i], want)
+			}
+		}
+	}
+
+	want := []float64{0.8908, 0.2007, 0.0683, 0.0413, 0.0265, 0.0160}
+	for i, g := range StarletNoiseGains(len(want)) {
+		if math.Abs(g-want[i]) > 5e-5 {
+			t.Errorf("StarletNoiseGains[%d] = %.5f, want %.4f", i, g, want[i])
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package goimagefreq
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// starField is a 128x128 background with a gentle gradient,
+// bright Gaussian stars and normal noise of the given sigma.
+func starField(r *rand.Rand, sigma float32, stars int) *Plane {
+	const w, h = 128, 128
+	p := NewPlane(w, h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			p.Set(x, y, 0.1+0.1*float32(x)/w)
+		}
+	}
+	for i := 0; i < stars; i++ {
+		cx, cy := r.Float64()*w, r.Float64()*h
+		peak, s := 0.2+0.8*r.Float64(), 0.8+r.Float64()
+		for y := max(0, int(cy-4*s)); y < min(h, int(cy+4*s)+1); y++ {
+			for x := max(0, int(cx-4*s)); x < min(w, int(cx+4*s)+1); x++ {
+				dx, dy := float64(x)-cx, float64(y)-cy
+				p.Data[y*p.Stride+x] += float32(peak * math.Exp(-(dx*dx+dy*dy)/(2*s*s)))
+			}
+		}
+	}
+	for i := range p.Data {
+		p.Data[i] += sigma * float32(r.NormFloat64())
+	}
+	return p
+}
+
+// MRS recovers the sigma of Gaussian noise to within 3%,
+// and with stars present it masks them out and beats the
+// plain MAD of the first layer.
+func TestEstimateNoiseMRS(t *testing.T) {
+	r := rand.New(rand.NewSource(27))
+	for _, sigma := range []float32{0.005, 0.02, 0.05} {
+		for _, stars := range []int{0, 25} {
+			src := starField(r, sigma, stars)
+			n := EstimateNoiseMRSPlane(src, 4, 3, Edge{})
+			if e := math.Abs(float64(n.Sigma/sigma - 1)); e > 0.03 {
+				t.Errorf("sigma %g, %d stars: estimated %g", sigma, stars, n.Sigma)
+			}
+			if n.Iterations < 1 || n.Iterations > mrsMaxIterations {
+				t.Errorf("sigma %g, %d stars: %d iterations", sigma, stars, n.Iterations)
+			}
+			if stars == 0 {
+				if n.Fraction < 0.85 {
+					t.Errorf("sigma %g, pure noise: only %.2f of the pixels used", sigma, n.Fraction)
+				}
+				continue
+			}
+			if n.Fraction > 0.9 {
+				t.Errorf("sigma %g, %d stars: %.2f of the pixels used", sigma, stars, n.Fraction)
+			}
+			d, _ := AtrousWaveletPlane(src, 1, Edge{})
+			mad := EstimateNoiseMADPlane(d[0]) / float32(StarletNoiseGains(1)[0])
+			if math.Abs(float64(n.Sigma-sigma)) >= math.Abs(float64(mad-sigma)) {
+				t.Errorf("sigma %g, %d stars: MRS %g is no closer than MAD %g", sigma, stars, n.Sigma, mad)
+			}
+		}
+	}
+}
+
+func TestEstimateNoiseMRSRGB(t *testing.T) {
+	r := rand.New(rand.NewSource(28))
+	sigmas := [3]float32{0.01, 0.02, 0.04}
+	var planes [3]*Plane
+	for c := range planes {
+		planes[c] = starField(r, sigmas[c], 10)
+	}
+	img := RGBImageFromPlanes(planes[0], planes[1], planes[2])
+	n := EstimateNoiseMRSRGB(img, 4, 3)
+	for c := range n {
+		if e := math.Abs(float64(n[c].Sigma/sigmas[c] - 1)); e > 0.03 {
+			t.Errorf("channel %d: estimated %g, want %g", c, n[c].Sigma, sigmas[c])
+		}
+	}
+}
+
+func TestEstimateNoiseMRSErrors(t *testing.T) {
+	ctx := context.Background()
+	src := starField(rand.New(rand.NewSource(29)), 0.01, 0)
+	for _, k := range []float32{0, -1, float32(math.NaN()), float32(math.Inf(1))} {
+		if _, err := EstimateNoiseMRSPlaneCtx(ctx, src, 4, k, Edge{}, nil); !errors.Is(err, ErrInvalidParameter) {
+			t.Errorf("k %g: got %v", k, err)
+		}
+	}
+	if _, err := EstimateNoiseMRSPlaneCtx(ctx, src, 0, 3, Edge{}, nil); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("0 levels: got %v", err)
+	}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := EstimateNoiseMRSPlaneCtx(canceled, src, 4, 3, Edge{}, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled: got %v", err)
+	}
+}
@@ -0,0 +1,218 @@
+// Contiguous float32 image planes
+package goimagefreq
+
+import (
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// Plane is a single-channel float32 image stored in one
+// contiguous buffer.
+//
+// Pixel (x, y) lives at Data[y*Stride+x]. A plane created
+// with NewPlane has Stride == W; sub-rectangle views returned
+// by Sub share Data with their parent and keep its stride.
+//
+// Plane is the native image type of the package. The
+// [][]float32 functions (Convolve1D, AtrousWavelet, ...) are
+// thin adapters around their *Plane counterparts and are kept
+// so existing code compiles during the transition.
+type Plane struct {
+	W, H   int
+	Stride int
+	Data   []float32
+}
+
+// NewPlane allocates a zeroed w×h plane.
+func NewPlane(w, h int) *Plane {
+	return &Plane{
+		W:      w,
+		H:      h,
+		Stride: w,
+		Data:   make([]float32, w*h),
+	}
+}
+
+// Row returns row y as a slice into the plane's buffer.
+// Writes through the slice modify the plane.
+func (p *Plane) Row(y int) []float32 {
+	off := y * p.Stride
+	return p.Data[off : off+p.W]
+}
+
+// At returns the pixel at (x, y).
+func (p *Plane) At(x, y int) float32 {
+	return p.Data[y*p.Stride+x]
+}
+
+// Set stores v at (x, y).
+func (p *Plane) Set(x, y int, v float32) {
+	p.Data[y*p.Stride+x] = v
+}
+
+// Sub returns a w×h view of p starting at (x0, y0).
+// The view shares memory with p; no pixels are copied.
+func (p *Plane) Sub(x0, y0, w, h int) *Plane {
+	if w <= 0 || h <= 0 {
+		return &Plane{}
+	}
+	off := y0*p.Stride + x0
+	return &Plane{
+		W:      w,
+		H:      h,
+		Stride: p.Stride,
+		Data:   p.Data[off : off+(h-1)*p.Stride+w],
+	}
+}
+
+// Clone returns a compact (Stride == W) copy of p.
+func (p *Plane) Clone() *Plane {
+	out := NewPlane(p.W, p.H)
+	for y := 0; y < p.H; y++ {
+		copy(out.Row(y), p.Row(y))
+	}
+	return out
+}
+
+// Fill sets every pixel of p to v.
+func (p *Plane) Fill(v float32) {
+	for y := 0; y < p.H; y++ {
+		row := p.Row(y)
+		for x := range row {
+			row[x] = v
+		}
+	}
+}
+
+// Rows returns p as row slices without copying.
+//
+// Each row aliases the plane buffer, so the result can be
+// passed back to PlaneFromRows at no cost.
+func (p *Plane) Rows() [][]float32 {
+	rows := make([][]float32, p.H)
+	for y := range rows {
+		off := y * p.Stride
+		rows[y] = p.Data[off : off+p.W]
+	}
+	return rows
+}
+
+// PlaneFromRows converts row slices into a Plane.
+//
+// When the rows are laid out back to back with a constant
+// stride (as returned by Plane.Rows) the plane views the same
+// memory; otherwise the pixels are copied.
+//
+// Ragged rows panic with ErrDimensionMismatch; use
+// ValidateRows to check untrusted input first.
+func PlaneFromRows(rows [][]float32) *Plane {
+	h := len(rows)
+	if h == 0 {
+		return &Plane{}
+	}
+	w := len(rows[0])
+	if p, ok := viewRows(rows, w); ok {
+		return p
+	}
+	if w > 0 {
+		panicOnError(ValidateRows(rows))
+	}
+
+	p := NewPlane(w, h)
+	for y, r := range rows {
+		copy(p.Row(y), r)
+	}
+	return p
+}
+
+// viewRows reports whether rows share one backing array
+// with a constant stride and, if so, wraps it as a Plane.
+func viewRows(rows [][]float32, w int) (*Plane, bool) {
+	h := len(rows)
+	if w == 0 {
+		return nil, false
+	}
+	base := rows[0][:cap(rows[0])]
+
+	stride := w
+	if h > 1 {
+		if len(rows[1]) == 0 {
+			return nil, false
+		}
+		d := uintptr(unsafe.Pointer(&rows[1][0])) - uintptr(unsafe.Pointer(&rows[0][0]))
+		if d%4 != 0 {
+			return nil, false
+		}
+		stride = int(d / 4)
+		if stride < w {
+			return nil, false
+		}
+	}
+
+	n := (h-1)*stride + w
+	if n > len(base) {
+		return nil, false
+	}
+	for y := 0; y < h; y++ {
+		if len(rows[y]) != w || &rows[y][0] != &base[y*stride] {
+			return nil, false
+		}
+	}
+
+	return &Plane{W: w, H: h, Stride: stride, Data: base[:n]}, true
+}
+
+// writeRows copies p into rows, skipping rows that already
+// alias the plane. Used by in-place [][]float32 adapters.
+func (p *Plane) writeRows(rows [][]float32) {
+	for y := 0; y < p.H; y++ {
+		src := p.Row(y)
+		if len(src) > 0 && &rows[y][0] == &src[0] {
+			continue
+		}
+		copy(rows[y], src)
+	}
+}
+
+// planesFromRows converts a stack of layers.
+func planesFromRows(layers [][][]float32) []*Plane {
+	out := make([]*Plane, len(layers))
+	for i, l := range layers {
+		out[i] = PlaneFromRows(l)
+	}
+	return out
+}
+
+// planesToRows converts a stack of planes.
+func planesToRows(planes []*Plane) [][][]float32 {
+	out := make([][][]float32, len(planes))
+	for i, p := range planes {
+		out[i] = p.Rows()
+	}
+	return out
+}
+
+// parallelRows calls fn for every row in [0, h)
+// using one worker per CPU.
+func parallelRows(h int, fn func(y int)) {
+	workers := runtime.GOMAXPROCS(0)
+	jobs := make(chan int, h)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := range jobs {
+				fn(y)
+			}
+		}()
+	}
+
+	for y := 0; y < h; y++ {
+		jobs <- y
+	}
+	close(jobs)
+	wg.Wait()
+}
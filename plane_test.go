@@ -0,0 +1,104 @@
+package goimagefreq
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestPlaneLayout(t *testing.T) {
+	p := NewPlane(5, 3)
+	if p.Stride != 5 || len(p.Data) != 15 {
+		t.Fatalf("stride %d, %d samples", p.Stride, len(p.Data))
+	}
+	p.Set(3, 2, 7)
+	if p.Data[2*5+3] != 7 || p.At(3, 2) != 7 || p.Row(2)[3] != 7 {
+		t.Error("Set, At, Row and Data disagree")
+	}
+	p.Row(1)[4] = 9
+	if p.At(4, 1) != 9 {
+		t.Error("a write through Row did not reach the plane")
+	}
+}
+
+func TestPlaneSub(t *testing.T) {
+	p := randomPlane(rand.New(rand.NewSource(21)), 9, 7)
+	s := p.Sub(2, 3, 4, 3)
+	if s.W != 4 || s.H != 3 || s.Stride != 9 {
+		t.Fatalf("view is %dx%d with stride %d", s.W, s.H, s.Stride)
+	}
+	for y := 0; y < s.H; y++ {
+		for x := 0; x < s.W; x++ {
+			if s.At(x, y) != p.At(x+2, y+3) {
+				t.Fatalf("view (%d, %d) differs from the plane", x, y)
+			}
+		}
+	}
+	s.Fill(-1)
+	if p.At(2, 3) != -1 || p.At(5, 5) != -1 || p.At(1, 3) == -1 || p.At(6, 3) == -1 {
+		t.Error("Fill on the view did not write exactly its rectangle")
+	}
+
+	c := s.Clone()
+	if c.Stride != c.W || len(c.Data) != c.W*c.H || &c.Data[0] == &s.Data[0] {
+		t.Error("Clone is not a compact copy")
+	}
+	if e := MaxAbsErrorPlane(c, s); e != 0 {
+		t.Errorf("Clone differs by %g", e)
+	}
+}
+
+func TestPlaneRowsRoundTrip(t *testing.T) {
+	p := randomPlane(rand.New(rand.NewSource(22)), 6, 4)
+
+	// Rows and PlaneFromRows share the buffer both ways,
+	// also for a strided view.
+	for _, src := range []*Plane{p, p.Sub(1, 1, 3, 3)} {
+		q := PlaneFromRows(src.Rows())
+		if q.W != src.W || q.H != src.H || q.Stride != src.Stride || &q.Data[0] != &src.Data[0] {
+			t.Errorf("%dx%d stride %d: round trip copied or changed the layout", src.W, src.H, src.Stride)
+		}
+	}
+
+	// Separately allocated rows are copied.
+	rows := [][]float32{{1, 2, 3}, {4, 5, 6}}
+	q := PlaneFromRows(rows)
+	rows[0][0] = 10
+	if q.At(0, 0) != 1 || q.At(2, 1) != 6 || q.Stride != 3 {
+		t.Error("separate rows were not copied into a compact plane")
+	}
+
+	defer func() {
+		err, _ := recover().(error)
+		if !errors.Is(err, ErrDimensionMismatch) {
+			t.Errorf("ragged rows: recovered %v", err)
+		}
+	}()
+	PlaneFromRows([][]float32{{1, 2, 3}, {4, 5}})
+}
+
+// Algorithms honour the stride of a view.
+func TestPlaneViewsAreProcessedLikeCopies(t *testing.T) {
+	p := randomPlane(rand.New(rand.NewSource(23)), 20, 16)
+	view := p.Sub(3, 2, 12, 11)
+	copied := view.Clone()
+	if e := MaxAbsErrorPlane(GaussianBlurPlane(view, 1.5, Edge{}), GaussianBlurPlane(copied, 1.5, Edge{})); e != 0 {
+		t.Errorf("GaussianBlurPlane: view and copy differ by %g", e)
+	}
+	d1, r1 := AtrousWaveletPlane(view, 3, Edge{})
+	d2, r2 := AtrousWaveletPlane(copied, 3, Edge{})
+	for i := range d1 {
+		if e := MaxAbsErrorPlane(d1[i], d2[i]); e != 0 {
+			t.Errorf("AtrousWaveletPlane layer %d: view and copy differ by %g", i, e)
+		}
+	}
+	if e := MaxAbsErrorPlane(r1, r2); e != 0 {
+		t.Errorf("AtrousWaveletPlane residual: view and copy differ by %g", e)
+	}
+
+	// The [][]float32 adapters match the Plane functions.
+	rows := GaussianBlur(copied.Rows(), 1.5)
+	if e := MaxAbsErrorPlane(PlaneFromRows(rows), GaussianBlurPlane(copied, 1.5, Edge{})); e != 0 {
+		t.Errorf("GaussianBlur adapter differs by %g", e)
+	}
+}
@@ -0,0 +1,91 @@
+// Wavelet coefficient shrinkage rules
+package goimagefreq
+
+import "math"
+
+// Shrinkage maps a wavelet coefficient v to its denoised
+// value given the layer threshold t ≥ 0. Set it in
+// DenoiseOptions.Shrinkage to replace a denoiser's soft or
+// hard thresholding.
+type Shrinkage func(v, t float32) float32
+
+// SoftShrink zeroes coefficients below t and moves the
+// others t closer to 0: no artifacts, but edges and stars
+// lose contrast.
+func SoftShrink(v, t float32) float32 {
+	return shrink(v, t, true)
+}
+
+// HardShrink zeroes coefficients below t and keeps the
+// others: sharp, but isolated survivors leave artifacts.
+func HardShrink(v, t float32) float32 {
+	return shrink(v, t, false)
+}
+
+// GarroteShrink is the non-negative garrote, v − t²/v above
+// t: continuous like soft thresholding, but large
+// coefficients are barely biased.
+func GarroteShrink(v, t float32) float32 {
+	if float32(math.Abs(float64(v))) <= t {
+		return 0
+	}
+	return v - t*t/v
+}
+
+// WienerShrink attenuates every coefficient by v²/(v²+t²),
+// the Wiener gain for signal power v² in noise power t²,
+// so nothing is zeroed outright. Here t acts as the noise
+// level: pass k·σ with k around 1.
+func WienerShrink(v, t float32) float32 {
+	v2 := v * v
+	if v2 == 0 {
+		return 0
+	}
+	return v * v2 / (v2 + t*t)
+}
+
+// FirmShrink returns firm (semi-soft) shrinkage (Gao & Bruce
+// 1997): coefficients below t are zeroed, those above
+// ratio·t kept, and those in between mapped linearly from 0
+// to ratio·t. It is continuous like soft thresholding with
+// the small bias of hard thresholding. A ratio of 1 or less
+// is hard thresholding.
+func FirmShrink(ratio float32) Shrinkage {
+	if !(ratio > 1) {
+		return HardShrink
+	}
+	return func(v, t float32) float32 {
+		av := float32(math.Abs(float64(v)))
+		switch {
+		case av <= t:
+			return 0
+		case av >= ratio*t:
+			return v
+		}
+		return float32(math.Copysign(float64(ratio*(av-t)/(ratio-1)), float64(v)))
+	}
+}
+
+// AmountShrink applies s only partially, like PixInsight's
+// "amount": v + amount·(s(v, t) − v). amount is clamped to
+// [0, 1]; 1 is s itself and 0 leaves v untouched.
+func AmountShrink(s Shrinkage, amount float32) Shrinkage {
+	if !(amount > 0) {
+		amount = 0
+	} else if amount > 1 {
+		amount = 1
+	}
+	return func(v, t float32) float32 {
+		return v + amount*(s(v, t)-v)
+	}
+}
+
+// shrinkPlane applies s with threshold t to p in place.
+func shrinkPlane(p *Plane, t float32, s Shrinkage) {
+	for y := 0; y < p.H; y++ {
+		row := p.Row(y)
+		for x := range row {
+			row[x] = s(row[x], t)
+		}
+	}
+}
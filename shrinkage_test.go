@@ -0,0 +1,78 @@
+package goimagefreq
+
+import (
+	"math"
+	"testing"
+)
+
+func TestShrinkageRules(t *testing.T) {
+	const th = 2
+	tests := []struct {
+		name string
+		s    Shrinkage
+		// v -> s(v, 2), for v ≥ 0; every rule is odd
+		want map[float32]float32
+	}{
+		{"soft", SoftShrink, map[float32]float32{0: 0, 1: 0, 2: 0, 2.5: 0.5, 3: 1, 5: 3}},
+		{"hard", HardShrink, map[float32]float32{0: 0, 1: 0, 1.99: 0, 2: 2, 2.5: 2.5, 5: 5}},
+		{"garrote", GarroteShrink, map[float32]float32{0: 0, 1: 0, 2: 0, 3: 3 - 4.0/3, 4: 3, 8: 7.5}},
+		{"wiener", WienerShrink, map[float32]float32{0: 0, 1: 0.2, 2: 1, 4: 3.2, 6: 5.4}},
+		{"firm 2", FirmShrink(2), map[float32]float32{0: 0, 1: 0, 2: 0, 2.5: 1, 3: 2, 3.5: 3, 4: 4, 6: 6}},
+		{"firm 3", FirmShrink(3), map[float32]float32{2: 0, 3: 1.5, 4: 3, 6: 6}},
+		{"soft at half amount", AmountShrink(SoftShrink, 0.5), map[float32]float32{0: 0, 1: 0.5, 2: 1, 3: 2, 5: 4}},
+		{"hard at zero amount", AmountShrink(HardShrink, 0), map[float32]float32{1: 1, 2: 2, 3: 3}},
+		{"soft at clamped amount", AmountShrink(SoftShrink, 2), map[float32]float32{1: 0, 3: 1}},
+	}
+	for _, tt := range tests {
+		for v, want := range tt.want {
+			for _, sign := range []float32{1, -1} {
+				if got := tt.s(sign*v, th); math.Abs(float64(got-sign*want)) > 1e-6 {
+					t.Errorf("%s(%g, %d) = %g, want %g", tt.name, sign*v, th, got, sign*want)
+				}
+			}
+		}
+	}
+}
+
+// Soft, garrote and firm shrinkage are continuous at the
+// threshold; hard thresholding jumps there.
+func TestShrinkageContinuityAtThreshold(t *testing.T) {
+	const th, eps = 2, 1e-3
+	for _, tt := range []struct {
+		name string
+		s    Shrinkage
+	}{{"soft", SoftShrink}, {"garrote", GarroteShrink}, {"firm", FirmShrink(2)}} {
+		if got := tt.s(th+eps, th); math.Abs(float64(got)) > 3*eps {
+			t.Errorf("%s just above the threshold = %g", tt.name, got)
+		}
+	}
+	if got := HardShrink(th+eps, th); got != th+eps {
+		t.Errorf("hard just above the threshold = %g", got)
+	}
+	// firm meets the identity at ratio·t
+	if got := FirmShrink(2)(2*th-eps, th); math.Abs(float64(got-(2*th-eps))) > 3*eps {
+		t.Errorf("firm just below ratio·t = %g", got)
+	}
+}
+
+func TestFirmShrinkSmallRatioIsHard(t *testing.T) {
+	for _, ratio := range []float32{1, 0.5, -1, float32(math.NaN())} {
+		s := FirmShrink(ratio)
+		for _, v := range []float32{-3, -2, -1, 0, 1, 2, 3} {
+			if got, want := s(v, 2), HardShrink(v, 2); got != want {
+				t.Errorf("ratio %g: s(%g, 2) = %g, want %g", ratio, v, got, want)
+			}
+		}
+	}
+}
+
+// With a zero threshold nothing is shrunk.
+func TestShrinkageZeroThreshold(t *testing.T) {
+	for _, s := range []Shrinkage{SoftShrink, HardShrink, GarroteShrink, FirmShrink(2)} {
+		for _, v := range []float32{-1.5, 0.25, 3} {
+			if got := s(v, 0); got != v {
+				t.Errorf("s(%g, 0) = %g", v, got)
+			}
+		}
+	}
+}
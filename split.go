@@ -1,104 +1,111 @@
 // Low / high frequency split
 package goimagefreq
 
-import (
-	"runtime"
-	"sync"
-)
-
-// SplitLowHigh decomposes an image into:
+// SplitLowHighPlane decomposes an image into:
 //
 //	low  = GaussianBlur(src)
 //	high = src - low
-func SplitLowHigh(src [][]float32, sigma float64) (low, high [][]float32) {
-	low = GaussianBlur(src, sigma)
-
-	h := len(src)
-	w := len(src[0])
+func SplitLowHighPlane(src *Plane, sigma float64, edge Edge) (low, high *Plane) {
+	return SplitLowHighMethodPlane(src, sigma, edge, GaussianFIR)
+}
 
-	high = make([][]float32, h)
-	for y := range high {
-		high[y] = make([]float32, w)
-	}
+// SplitLowHighMethodPlane is SplitLowHighPlane with the low
+// pass computed by the given method.
+func SplitLowHighMethodPlane(src *Plane, sigma float64, edge Edge, method GaussianMethod) (low, high *Plane) {
+	low = GaussianBlurMethodPlane(src, sigma, edge, method)
 
-	workers := runtime.GOMAXPROCS(0)
-	jobs := make(chan int, h)
-	wg := sync.WaitGroup{}
+	h := src.H
+	w := src.W
 
-	for i := 0; i < workers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for y := range jobs {
-				for x := 0; x < w; x++ {
-					high[y][x] = src[y][x] - low[y][x]
-				}
-			}
-		}()
-	}
+	high = NewPlane(w, h)
 
-	for y := 0; y < h; y++ {
-		jobs <- y
-	}
-	close(jobs)
-	wg.Wait()
+	parallelRows(h, func(y int) {
+		s, lo, hi := src.Row(y), low.Row(y), high.Row(y)
+		for x := 0; x < w; x++ {
+			hi[x] = s[x] - lo[x]
+		}
+	})
 
 	return
 }
 
-// ReconstructLowHigh perfectly reconstructs the image
+// SplitLowHigh is the [][]float32 adapter for SplitLowHighPlane
+// (clamp-to-edge).
+func SplitLowHigh(src [][]float32, sigma float64) (low, high [][]float32) {
+	lo, hi := SplitLowHighPlane(PlaneFromRows(src), sigma, Edge{})
+	return lo.Rows(), hi.Rows()
+}
+
+// SplitLowHighMethod is the [][]float32 adapter for
+// SplitLowHighMethodPlane (clamp-to-edge).
+func SplitLowHighMethod(src [][]float32, sigma float64, method GaussianMethod) (low, high [][]float32) {
+	lo, hi := SplitLowHighMethodPlane(PlaneFromRows(src), sigma, Edge{}, method)
+	return lo.Rows(), hi.Rows()
+}
+
+// ReconstructLowHighPlane perfectly reconstructs the image
 // by summing low + high components.
-func ReconstructLowHigh(low, high [][]float32) [][]float32 {
-	h := len(low)
-	w := len(low[0])
-	out := make([][]float32, h)
+func ReconstructLowHighPlane(low, high *Plane) *Plane {
+	h := low.H
+	w := low.W
+	out := NewPlane(w, h)
 	for y := 0; y < h; y++ {
-		out[y] = make([]float32, w)
+		lo, hi, o := low.Row(y), high.Row(y), out.Row(y)
 		for x := 0; x < w; x++ {
-			out[y][x] = low[y][x] + high[y][x]
+			o[x] = lo[x] + hi[x]
 		}
 	}
 	return out
 }
 
+// ReconstructLowHigh is the [][]float32 adapter for ReconstructLowHighPlane.
+func ReconstructLowHigh(low, high [][]float32) [][]float32 {
+	return ReconstructLowHighPlane(PlaneFromRows(low), PlaneFromRows(high)).Rows()
+}
+
 // SplitLowHighRGB applies SplitLowHigh per channel.
 func SplitLowHighRGB(r, g, b [][]float32, sigma float64) (rLow, rHigh, gLow, gHigh, bLow, bHigh [][]float32) {
-	var wg sync.WaitGroup
-	wg.Add(3)
-
-	go func() {
-		defer wg.Done()
-		rLow, rHigh = SplitLowHigh(r, sigma)
-	}()
-	go func() {
-		defer wg.Done()
-		gLow, gHigh = SplitLowHigh(g, sigma)
-	}()
-	go func() {
-		defer wg.Done()
-		bLow, bHigh = SplitLowHigh(b, sigma)
-	}()
-
-	wg.Wait()
+	rLow, rHigh, gLow, gHigh, bLow, bHigh, err := SplitLowHighRGBErr(r, g, b, sigma)
+	panicOnError(err)
 	return
 }
 
+// SplitLowHighRGBErr is SplitLowHighRGB returning an error
+// instead of panicking on empty, ragged or mismatched
+// channels or an invalid sigma.
+func SplitLowHighRGBErr(r, g, b [][]float32, sigma float64) (rLow, rHigh, gLow, gHigh, bLow, bHigh [][]float32, err error) {
+	if err := validateRowsSameSize(r, g, b); err != nil {
+		return nil, nil, nil, nil, nil, nil, err
+	}
+	if err := validateBlurSigma("sigma", sigma); err != nil {
+		return nil, nil, nil, nil, nil, nil, err
+	}
+	in := [3][][]float32{r, g, b}
+	res := dispatch(3, func(c int) [2][][]float32 {
+		lo, hi := SplitLowHigh(in[c], sigma)
+		return [2][][]float32{lo, hi}
+	})
+	return res[0][0], res[0][1], res[1][0], res[1][1], res[2][0], res[2][1], nil
+}
+
 // ReconstructLowHighRGB reconstructs per channel.
 func ReconstructLowHighRGB(rLow, rHigh, gLow, gHigh, bLow, bHigh [][]float32) (r, g, b [][]float32) {
-	var wg sync.WaitGroup
-	wg.Add(3)
-
-	go func() {
-		defer wg.Done()
-		r = ReconstructLowHigh(rLow, rHigh)
-	}()
-	go func() {
-		defer wg.Done()
-		g = ReconstructLowHigh(gLow, gHigh)
-	}()
-	go func() {
-		defer wg.Done()
-		b = ReconstructLowHigh(bLow, bHigh)
-	}()
+	r, g, b, err := ReconstructLowHighRGBErr(rLow, rHigh, gLow, gHigh, bLow, bHigh)
+	panicOnError(err)
 	return
 }
+
+// ReconstructLowHighRGBErr is ReconstructLowHighRGB returning
+// an error instead of panicking on empty, ragged or
+// mismatched images.
+func ReconstructLowHighRGBErr(rLow, rHigh, gLow, gHigh, bLow, bHigh [][]float32) (r, g, b [][]float32, err error) {
+	if err := validateRowsSameSize(rLow, rHigh, gLow, gHigh, bLow, bHigh); err != nil {
+		return nil, nil, nil, err
+	}
+	low := [3][][]float32{rLow, gLow, bLow}
+	high := [3][][]float32{rHigh, gHigh, bHigh}
+	out := dispatch(3, func(c int) [][]float32 {
+		return ReconstructLowHigh(low[c], high[c])
+	})
+	return out[0], out[1], out[2], nil
+}
@@ -11,21 +11,21 @@ type Star struct {
 	Peak float32
 }
 
-func DetectStars(
-	L [][]float32,
+func DetectStarsPlane(
+	L *Plane,
 	threshold float32,
 	minDist int,
 ) []Star {
 
-	h := len(L)
-	w := len(L[0])
+	h := L.H
+	w := L.W
 
 	var stars []Star
 
 	for y := minDist; y < h-minDist; y++ {
 		for x := minDist; x < w-minDist; x++ {
 
-			v := L[y][x]
+			v := L.At(x, y)
 			if v < threshold {
 				continue
 			}
@@ -37,7 +37,7 @@ func DetectStars(
 					if dy == 0 && dx == 0 {
 						continue
 					}
-					if L[y+dy][x+dx] >= v {
+					if L.At(x+dx, y+dy) >= v {
 						isMax = false
 						break
 					}
@@ -53,75 +53,91 @@ func DetectStars(
 	return stars
 }
 
-func ExtractPatch(
+func DetectStars(
 	L [][]float32,
+	threshold float32,
+	minDist int,
+) []Star {
+	return DetectStarsPlane(PlaneFromRows(L), threshold, minDist)
+}
+
+func ExtractPatchPlane(
+	L *Plane,
 	x, y, r int,
-) [][]float32 {
+) *Plane {
 
 	size := 2*r + 1
-	patch := make([][]float32, size)
+	return L.Sub(x-r, y-r, size, size).Clone()
+}
 
-	for j := -r; j <= r; j++ {
-		row := make([]float32, size)
-		for i := -r; i <= r; i++ {
-			row[i+r] = L[y+j][x+i]
-		}
-		patch[j+r] = row
-	}
-	return patch
+func ExtractPatch(
+	L [][]float32,
+	x, y, r int,
+) [][]float32 {
+	return ExtractPatchPlane(PlaneFromRows(L), x, y, r).Rows()
 }
 
-func NormalizePatch(p [][]float32) {
+func NormalizePatchPlane(p *Plane) {
 	var sum float32
-	for y := range p {
-		for x := range p[y] {
-			sum += p[y][x]
+	for y := 0; y < p.H; y++ {
+		for _, v := range p.Row(y) {
+			sum += v
 		}
 	}
 	if sum == 0 {
 		return
 	}
 	inv := 1 / sum
-	for y := range p {
-		for x := range p[y] {
-			p[y][x] *= inv
+	for y := 0; y < p.H; y++ {
+		row := p.Row(y)
+		for x := range row {
+			row[x] *= inv
 		}
 	}
 }
 
-func StackPatches(patches [][][]float32) [][]float32 {
+func NormalizePatch(p [][]float32) {
+	q := PlaneFromRows(p)
+	NormalizePatchPlane(q)
+	q.writeRows(p)
+}
+
+func StackPatchesPlane(patches []*Plane) *Plane {
 
 	n := len(patches)
-	h := len(patches[0])
-	w := len(patches[0][0])
+	h := patches[0].H
+	w := patches[0].W
 
-	out := make([][]float32, h)
-	for y := range out {
-		out[y] = make([]float32, w)
-	}
+	out := NewPlane(w, h)
 
 	for _, p := range patches {
 		for y := 0; y < h; y++ {
+			o, pr := out.Row(y), p.Row(y)
 			for x := 0; x < w; x++ {
-				out[y][x] += p[y][x]
+				o[x] += pr[x]
 			}
 		}
 	}
 
 	inv := float32(1.0 / float64(n))
-	for y := range out {
-		for x := range out[y] {
-			out[y][x] *= inv
+	for y := 0; y < h; y++ {
+		row := out.Row(y)
+		for x := range row {
+			row[x] *= inv
 		}
 	}
 
 	return out
 }
 
-func RadialProfile(psf [][]float32) []float64 {
+func StackPatches(patches [][][]float32) [][]float32 {
+	return StackPatchesPlane(planesFromRows(patches)).Rows()
+}
+
+func RadialProfilePlane(psf *Plane) []float64 {
 
-	h := len(psf)
-	w := len(psf[0])
+	h := psf.H
+	w := psf.W
 	cx := float64(w-1) / 2
 	cy := float64(h-1) / 2
 
@@ -135,7 +151,7 @@ func RadialProfile(psf [][]float32) []float64 {
 			dy := float64(y) - cy
 			r := int(math.Hypot(dx, dy))
 			if r <= maxR {
-				sum[r] += float64(psf[y][x])
+				sum[r] += float64(psf.At(x, y))
 				cnt[r]++
 			}
 		}
@@ -150,6 +166,10 @@ func RadialProfile(psf [][]float32) []float64 {
 	return profile
 }
 
+func RadialProfile(psf [][]float32) []float64 {
+	return RadialProfilePlane(PlaneFromRows(psf))
+}
+
 func FitMoffat(profile []float64) (alpha, beta float64) {
 
 	bestErr := math.Inf(1)
@@ -195,28 +215,35 @@ func MoffatKernel1D(alpha, beta float64, radius int) []float64 {
 	return k
 }
 
-func EstimatePSF(
-	L [][]float32,
+func EstimatePSFPlane(
+	L *Plane,
 	threshold float32,
 ) (kx, ky []float64) {
 
-	stars := DetectStars(L, threshold, 10)
+	stars := DetectStarsPlane(L, threshold, 10)
 
-	var patches [][][]float32
+	var patches []*Plane
 	for _, s := range stars {
-		p := ExtractPatch(L, s.X, s.Y, 10)
-		NormalizePatch(p)
+		p := ExtractPatchPlane(L, s.X, s.Y, 10)
+		NormalizePatchPlane(p)
 		patches = append(patches, p)
 		if len(patches) >= 50 {
 			break
 		}
 	}
 
-	psf := StackPatches(patches)
-	profile := RadialProfile(psf)
+	psf := StackPatchesPlane(patches)
+	profile := RadialProfilePlane(psf)
 	alpha, beta := FitMoffat(profile)
 
 	k := MoffatKernel1D(alpha, beta, 10)
 
 	return k, k
 }
+
+func EstimatePSF(
+	L [][]float32,
+	threshold float32,
+) (kx, ky []float64) {
+	return EstimatePSFPlane(PlaneFromRows(L), threshold)
+}
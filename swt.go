@@ -1,7 +1,10 @@
 // Stationary wavelet transform
 package goimagefreq
 
-import "math"
+import (
+	"context"
+	"math"
+)
 
 type SWTLayer struct {
 	Detail [][]float32
@@ -38,50 +41,97 @@ func swtKernel(level int) []float64 {
 	return k
 }
 
-func SWTDecompose(
-	src [][]float32,
+// SWTDecomposePlane runs the stationary wavelet transform
+// and returns the detail layers and the final residual.
+// Samples outside the image are read according to edge.
+func SWTDecomposePlane(
+	src *Plane,
 	levels int,
-) SWTResult {
+	edge Edge,
+) (details []*Plane, residual *Plane) {
+	details, residual, err := SWTDecomposePlaneCtx(context.Background(), src, levels, edge, nil)
+	panicOnError(err)
+	return details, residual
+}
+
+// SWTDecomposePlaneCtx is SWTDecomposePlane with cancellation.
+// It reports one progress step per level.
+func SWTDecomposePlaneCtx(
+	ctx context.Context,
+	src *Plane,
+	levels int,
+	edge Edge,
+	progress ProgressFunc,
+) (details []*Plane, residual *Plane, err error) {
+
+	if err := validateTransform(src, levels, edge); err != nil {
+		return nil, nil, err
+	}
 
 	current := src
-	var layers []SWTLayer
 
 	for i := 0; i < levels; i++ {
 		k := swtKernel(i)
 
-		tmp := Convolve1D(current, k, true)
-		smooth := Convolve1D(tmp, k, false)
+		tmp, err := convolve1D(ctx, current, k, true, edge)
+		if err != nil {
+			return nil, nil, err
+		}
+		smooth, err := convolve1D(ctx, tmp, k, false, edge)
+		if err != nil {
+			return nil, nil, err
+		}
 
-		h := len(src)
-		w := len(src[0])
+		h := src.H
+		w := src.W
 
-		detail := make([][]float32, h)
+		detail := NewPlane(w, h)
 		for y := 0; y < h; y++ {
-			detail[y] = make([]float32, w)
+			cur, sm, d := current.Row(y), smooth.Row(y), detail.Row(y)
 			for x := 0; x < w; x++ {
-				detail[y][x] = current[y][x] - smooth[y][x]
+				d[x] = cur[x] - sm[x]
 			}
 		}
 
-		layers = append(layers, SWTLayer{
-			Detail: detail,
-		})
+		details = append(details, detail)
 
 		current = smooth
+		progress.report(i+1, levels)
+	}
+
+	return details, current, nil
+}
+
+// SWTDecompose is the [][]float32 adapter for SWTDecomposePlane
+// (clamp-to-edge).
+func SWTDecompose(
+	src [][]float32,
+	levels int,
+) SWTResult {
+
+	details, residual := SWTDecomposePlane(PlaneFromRows(src), levels, Edge{})
+
+	layers := make([]SWTLayer, len(details))
+	for i, d := range details {
+		layers[i] = SWTLayer{
+			Detail: d.Rows(),
+		}
 	}
 
 	return SWTResult{
 		Layers:   layers,
-		Residual: current,
+		Residual: residual.Rows(),
 	}
 }
 
-func EstimateNoiseMAD(layer [][]float32) float32 {
+// EstimateNoiseMADPlane returns the Gaussian-equivalent
+// noise sigma of a layer (1.4826 · MAD).
+func EstimateNoiseMADPlane(layer *Plane) float32 {
 
-	var values []float64
-	for y := range layer {
-		for x := range layer[y] {
-			values = append(values, float64(layer[y][x]))
+	values := make([]float64, 0, layer.W*layer.H)
+	for y := 0; y < layer.H; y++ {
+		for _, v := range layer.Row(y) {
+			values = append(values, float64(v))
 		}
 	}
 
@@ -97,6 +147,11 @@ func EstimateNoiseMAD(layer [][]float32) float32 {
 	return float32(1.4826 * mad)
 }
 
+// EstimateNoiseMAD is the [][]float32 adapter for EstimateNoiseMADPlane.
+func EstimateNoiseMAD(layer [][]float32) float32 {
+	return EstimateNoiseMADPlane(PlaneFromRows(layer))
+}
+
 func shrink(v, t float32, soft bool) float32 {
 	av := float32(math.Abs(float64(v)))
 	if av < t {
@@ -108,50 +163,114 @@ func shrink(v, t float32, soft bool) float32 {
 	return v
 }
 
-func SWTDenoise(
-	src [][]float32,
+// SWTDenoisePlane thresholds each SWT detail layer at
+// sigmas[i] times its MAD noise estimate and reconstructs.
+// A non-positive multiplier leaves the layer untouched.
+func SWTDenoisePlane(
+	src *Plane,
 	sigmas []float32,
 	soft bool,
-) [][]float32 {
+	edge Edge,
+) *Plane {
+	out, err := SWTDenoisePlaneCtx(context.Background(), src, sigmas, soft, edge, nil)
+	panicOnError(err)
+	return out
+}
 
-	res := SWTDecompose(src, len(sigmas))
+// SWTDenoisePlaneCtx is SWTDenoisePlane with cancellation.
+// It reports one progress step per level plus a final step
+// for thresholding and reconstruction.
+func SWTDenoisePlaneCtx(
+	ctx context.Context,
+	src *Plane,
+	sigmas []float32,
+	soft bool,
+	edge Edge,
+	progress ProgressFunc,
+) (*Plane, error) {
+	return SWTDenoiseOptsPlaneCtx(ctx, src, sigmas, soft, edge, DenoiseOptions{}, progress)
+}
 
-	for i := range res.Layers {
+// SWTDenoiseOptsPlane is SWTDenoisePlane with options. A nil
+// opts.Transform is the SWT; opts.Shrinkage overrides soft.
+func SWTDenoiseOptsPlane(
+	src *Plane,
+	sigmas []float32,
+	soft bool,
+	edge Edge,
+	opts DenoiseOptions,
+) *Plane {
+	out, err := SWTDenoiseOptsPlaneCtx(context.Background(), src, sigmas, soft, edge, opts, nil)
+	panicOnError(err)
+	return out
+}
+
+// SWTDenoiseOptsPlaneCtx is SWTDenoiseOptsPlane with
+// cancellation. It reports progress like SWTDenoisePlaneCtx.
+func SWTDenoiseOptsPlaneCtx(
+	ctx context.Context,
+	src *Plane,
+	sigmas []float32,
+	soft bool,
+	edge Edge,
+	opts DenoiseOptions,
+	progress ProgressFunc,
+) (*Plane, error) {
+	if err := opts.validate(len(sigmas)); err != nil {
+		return nil, err
+	}
+
+	total := len(sigmas) + 1
+	details, residual, err := opts.transformOr(SWTDecomposePlaneCtx)(ctx, src, len(sigmas), edge, progress.withTotal(total))
+	if err != nil {
+		return nil, err
+	}
+
+	var propagated []float32
+	if opts.NoiseGains != nil {
+		propagated = propagatedNoise(details, opts.NoiseGains)
+	}
+	s := opts.shrinkage(func(v, t float32) float32 { return shrink(v, t, soft) })
+	for i, layer := range details {
 		sigma := sigmas[i]
 		if sigma <= 0 {
 			continue
 		}
 
-		layer := res.Layers[i].Detail
-		noise := EstimateNoiseMAD(layer)
-		th := sigma * noise
-
-		for y := range layer {
-			for x := range layer[y] {
-				layer[y][x] = shrink(layer[y][x], th, soft)
-			}
+		var noise float32
+		if propagated != nil {
+			noise = propagated[i]
+		} else {
+			noise = EstimateNoiseMADPlane(layer)
 		}
+		th := opts.threshold(layer, noise, sigma)
+
+		shrinkPlane(layer, th, s)
 	}
 
 	// reconstruct
-	h := len(src)
-	w := len(src[0])
-	out := make([][]float32, h)
-
-	for y := 0; y < h; y++ {
-		out[y] = make([]float32, w)
-		for x := 0; x < w; x++ {
-			out[y][x] = res.Residual[y][x]
-		}
-	}
+	out := AtrousReconstructPlane(details, residual)
+	progress.report(total, total)
+	return out, nil
+}
 
-	for _, l := range res.Layers {
-		for y := 0; y < h; y++ {
-			for x := 0; x < w; x++ {
-				out[y][x] += l.Detail[y][x]
-			}
-		}
-	}
+// SWTDenoise is the [][]float32 adapter for SWTDenoisePlane
+// (clamp-to-edge).
+func SWTDenoise(
+	src [][]float32,
+	sigmas []float32,
+	soft bool,
+) [][]float32 {
+	return SWTDenoisePlane(PlaneFromRows(src), sigmas, soft, Edge{}).Rows()
+}
 
-	return out
+// SWTDenoiseOpts is the [][]float32 adapter for
+// SWTDenoiseOptsPlane (clamp-to-edge).
+func SWTDenoiseOpts(
+	src [][]float32,
+	sigmas []float32,
+	soft bool,
+	opts DenoiseOptions,
+) [][]float32 {
+	return SWTDenoiseOptsPlane(PlaneFromRows(src), sigmas, soft, Edge{}, opts).Rows()
 }
@@ -0,0 +1,170 @@
+// Automatic wavelet threshold selection
+package goimagefreq
+
+import (
+	"context"
+	"math"
+	"sort"
+)
+
+// ThresholdSelector picks a detail layer's threshold from its
+// statistics and noise sigma.
+type ThresholdSelector int
+
+const (
+	// ManualThreshold selects nothing: the denoiser keeps
+	// its own k-sigma thresholds. It is the zero value, so
+	// DenoiseOptions without a Selector are unchanged.
+	ManualThreshold ThresholdSelector = iota
+	// VisuShrink is Donoho's universal threshold σ·√(2 ln N)
+	// for a layer of N coefficients: it removes nearly all
+	// noise and tends to over-smooth.
+	VisuShrink
+	// BayesShrink (Chang, Yu & Vetterli 2000) is σ²/σₓ, with
+	// σₓ² the layer variance minus the noise variance, and
+	// is meant for soft thresholding. Layers with no signal
+	// above the noise are zeroed.
+	BayesShrink
+	// SUREShrink (Donoho & Johnstone 1995) minimizes Stein's
+	// unbiased estimate of the soft-thresholding risk, and
+	// falls back to VisuShrink on layers too sparse for the
+	// estimate to be reliable. It sorts the layer, so it is
+	// the slowest of the three.
+	SUREShrink
+)
+
+// validate checks that the selector is known and selects a
+// threshold.
+func (s ThresholdSelector) validate() error {
+	if s < VisuShrink || s > SUREShrink {
+		return invalidParam("unknown threshold selector %d", s)
+	}
+	return nil
+}
+
+// SelectThresholdPlane returns the threshold sel picks for a
+// detail layer whose noise sigma is noise.
+func SelectThresholdPlane(layer *Plane, noise float32, sel ThresholdSelector) float32 {
+	panicOnError(sel.validate())
+	if noise <= 0 {
+		return 0
+	}
+	n := float64(layer.W * layer.H)
+	sigma := float64(noise)
+	universal := sigma * math.Sqrt(2*math.Log(n))
+
+	switch sel {
+	case BayesShrink:
+		var ss, peak float64
+		for y := 0; y < layer.H; y++ {
+			for _, v := range layer.Row(y) {
+				ss += float64(v) * float64(v)
+				peak = math.Max(peak, math.Abs(float64(v)))
+			}
+		}
+		signal := ss/n - sigma*sigma
+		if signal <= 0 {
+			return float32(peak)
+		}
+		return float32(sigma * sigma / math.Sqrt(signal))
+
+	case SUREShrink:
+		sq := make([]float64, 0, layer.W*layer.H)
+		var energy float64
+		for y := 0; y < layer.H; y++ {
+			for _, v := range layer.Row(y) {
+				x := float64(v) / sigma
+				sq = append(sq, x*x)
+				energy += x * x
+			}
+		}
+		if (energy-n)/n <= math.Pow(math.Log2(n), 1.5)/math.Sqrt(n) {
+			return float32(universal)
+		}
+		sort.Float64s(sq)
+
+		// With t² = sq[k]: risk = N − 2(k+1) + Σ_{i≤k} sq[i] +
+		// (N−k−1)·sq[k]. t = 0 has risk N.
+		best, bestRisk := 0.0, n
+		var cum float64
+		for k, a := range sq {
+			cum += a
+			risk := n - 2*float64(k+1) + cum + (n-float64(k+1))*a
+			if risk < bestRisk {
+				best, bestRisk = a, risk
+			}
+		}
+		return float32(math.Min(sigma*math.Sqrt(best), universal))
+	}
+	return float32(universal)
+}
+
+// SelectThreshold is the [][]float32 adapter for
+// SelectThresholdPlane.
+func SelectThreshold(layer [][]float32, noise float32, sel ThresholdSelector) float32 {
+	return SelectThresholdPlane(PlaneFromRows(layer), noise, sel)
+}
+
+// WaveletDenoiseAutoPlane thresholds each detail layer at
+// the threshold sel picks for it and reconstructs, with no
+// per-image tuning. Layer noise is measured by MAD, or
+// propagated with opts.NoiseGains.
+//
+// The decomposition is à trous unless opts.Transform is set,
+// e.g. to SWTDecomposePlaneCtx or MultiBandTransform, and
+// opts.Shrinkage overrides soft. The selector is sel, so
+// opts.Selector must be left unset. The absolute thresholds
+// used, fine → coarse, are returned.
+func WaveletDenoiseAutoPlane(src *Plane, levels int, sel ThresholdSelector, soft bool, edge Edge, opts DenoiseOptions) (*Plane, []float32) {
+	out, thr, err := WaveletDenoiseAutoPlaneCtx(context.Background(), src, levels, sel, soft, edge, opts, nil)
+	panicOnError(err)
+	return out, thr
+}
+
+// WaveletDenoiseAutoPlaneCtx is WaveletDenoiseAutoPlane with
+// cancellation. It reports one progress step per level plus
+// a final step for thresholding and reconstruction.
+func WaveletDenoiseAutoPlaneCtx(ctx context.Context, src *Plane, levels int, sel ThresholdSelector, soft bool, edge Edge, opts DenoiseOptions, progress ProgressFunc) (*Plane, []float32, error) {
+	if err := sel.validate(); err != nil {
+		return nil, nil, err
+	}
+	if opts.Selector != ManualThreshold {
+		return nil, nil, invalidParam("pass the threshold selector as sel, not in opts")
+	}
+	if err := opts.validate(levels); err != nil {
+		return nil, nil, err
+	}
+
+	total := levels + 1
+	details, residual, err := opts.transformOr(AtrousWaveletPlaneCtx)(ctx, src, levels, edge, progress.withTotal(total))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var propagated []float32
+	if opts.NoiseGains != nil {
+		propagated = propagatedNoise(details, opts.NoiseGains)
+	}
+	s := opts.shrinkage(func(v, t float32) float32 { return shrink(v, t, soft) })
+	thr := dispatch(len(details), func(i int) float32 {
+		noise := EstimateNoiseMADPlane(details[i])
+		if propagated != nil {
+			noise = propagated[i]
+		}
+		t := SelectThresholdPlane(details[i], noise, sel)
+
+		shrinkPlane(details[i], t, s)
+		return t
+	})
+
+	out := AtrousReconstructPlane(details, residual)
+	progress.report(total, total)
+	return out, thr, nil
+}
+
+// WaveletDenoiseAuto is the [][]float32 adapter for
+// WaveletDenoiseAutoPlane (clamp-to-edge).
+func WaveletDenoiseAuto(src [][]float32, levels int, sel ThresholdSelector, soft bool, opts DenoiseOptions) ([][]float32, []float32) {
+	out, thr := WaveletDenoiseAutoPlane(PlaneFromRows(src), levels, sel, soft, Edge{}, opts)
+	return out.Rows(), thr
+}
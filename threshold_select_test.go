@@ -0,0 +1,111 @@
+package goimagefreq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// noisyLayer returns a detail layer of Gaussian noise of the
+// given sigma, plus a sparse Laplacian signal of scale
+// signal on a tenth of the coefficients.
+func noisyLayer(r *rand.Rand, w, h int, sigma, signal float32) *Plane {
+	p := NewPlane(w, h)
+	for i := range p.Data {
+		p.Data[i] = sigma * float32(r.NormFloat64())
+		if r.Intn(10) == 0 {
+			p.Data[i] += signal * float32(r.ExpFloat64()) * float32(1-2*r.Intn(2))
+		}
+	}
+	return p
+}
+
+func TestSelectThresholdPlane(t *testing.T) {
+	r := rand.New(rand.NewSource(16))
+	const sigma = 0.05
+	for _, signal := range []float32{0, 0.2, 1} {
+		layer := noisyLayer(r, 64, 48, sigma, signal)
+		visu := SelectThresholdPlane(layer, sigma, VisuShrink)
+		if want := sigma * math.Sqrt(2*math.Log(64*48)); math.Abs(float64(visu)-want) > 1e-6 {
+			t.Errorf("signal %g: VisuShrink %g, want %g", signal, visu, want)
+		}
+		for _, sel := range []ThresholdSelector{BayesShrink, SUREShrink} {
+			if signal == 0 && sel == BayesShrink {
+				// no signal above the noise: the layer is zeroed
+				continue
+			}
+			if th := SelectThresholdPlane(layer, sigma, sel); !(th > 0 && th <= visu) {
+				t.Errorf("signal %g selector %d: threshold %g, VisuShrink %g", signal, sel, th, visu)
+			}
+		}
+	}
+	if th := SelectThresholdPlane(NewPlane(4, 4), 0, SUREShrink); th != 0 {
+		t.Errorf("zero noise: threshold %g", th)
+	}
+}
+
+// Setting DenoiseOptions.Selector makes the denoisers
+// threshold like WaveletDenoiseAuto in the same transform.
+func TestDenoiseOptionsSelector(t *testing.T) {
+	r := rand.New(rand.NewSource(17))
+	src := NewPlane(48, 40)
+	for y := 0; y < src.H; y++ {
+		for x := 0; x < src.W; x++ {
+			src.Set(x, y, 0.3+0.4*float32(x)/48+0.05*float32(r.NormFloat64()))
+		}
+	}
+	const levels = 3
+	ones := []float32{1, 1, 1}
+	transforms := []struct {
+		name string
+		tr   Transform
+	}{
+		{"à trous", AtrousWaveletPlaneCtx},
+		{"SWT", SWTDecomposePlaneCtx},
+		{"multiband", MultiBandTransform(1, GaussianFIR)},
+	}
+	for _, tr := range transforms {
+		for _, sel := range []ThresholdSelector{VisuShrink, BayesShrink, SUREShrink} {
+			name := fmt.Sprintf("%s selector %d", tr.name, sel)
+			want, _ := WaveletDenoiseAutoPlane(src, levels, sel, true, Edge{}, DenoiseOptions{Transform: tr.tr})
+			opts := DenoiseOptions{Transform: tr.tr, Selector: sel}
+			got := map[string]*Plane{
+				"SWTDenoiseOpts":        SWTDenoiseOptsPlane(src, ones, true, Edge{}, opts),
+				"AtrousWaveletDenoiseL": AtrousWaveletDenoiseLOptsPlane(src, levels, ones, Edge{}, opts),
+				"WaveletDenoiseMLTOpts": WaveletDenoiseMLTOptsPlane(src, ones, Edge{}, opts),
+			}
+			for fn, out := range got {
+				if e := MaxAbsErrorPlane(out, want); e > 1e-6 {
+					t.Errorf("%s: %s differs from WaveletDenoiseAuto by %g", name, fn, e)
+				}
+			}
+		}
+	}
+
+	// A non-positive per-layer value still skips the layer.
+	opts := DenoiseOptions{Selector: VisuShrink}
+	kept := AtrousWaveletDenoiseLOptsPlane(src, levels, []float32{0, 0, 0}, Edge{}, opts)
+	if e := MaxAbsErrorPlane(kept, src); e > 1e-6 {
+		t.Errorf("all layers skipped: image changed by %g", e)
+	}
+}
+
+func TestDenoiseOptionsSelectorErrors(t *testing.T) {
+	src := NewPlane(16, 16)
+	ctx := context.Background()
+	if _, err := SWTDenoiseOptsPlaneCtx(ctx, src, []float32{1}, true, Edge{}, DenoiseOptions{Selector: SUREShrink + 1}, nil); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("unknown selector: got %v", err)
+	}
+	if _, _, err := WaveletDenoiseAutoPlaneCtx(ctx, src, 1, ManualThreshold, true, Edge{}, DenoiseOptions{}, nil); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("WaveletDenoiseAuto with ManualThreshold: got %v", err)
+	}
+	if _, _, err := WaveletDenoiseAutoPlaneCtx(ctx, src, 1, VisuShrink, true, Edge{}, DenoiseOptions{Selector: BayesShrink}, nil); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("WaveletDenoiseAuto with opts.Selector: got %v", err)
+	}
+	if _, err := DWTDenoiseOptsPlaneCtx(ctx, src, Haar(), 1, 3, true, DenoiseOptions{Selector: VisuShrink}, nil); !errors.Is(err, ErrInvalidParameter) {
+		t.Errorf("DWT denoising with a selector: got %v", err)
+	}
+}
@@ -0,0 +1,471 @@
+// Floating-point TIFF reader and writer
+package goimagefreq
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// TIFF tags used by the reader and writer.
+const (
+	tiffImageWidth      = 256
+	tiffImageLength     = 257
+	tiffBitsPerSample   = 258
+	tiffCompression     = 259
+	tiffPhotometric     = 262
+	tiffStripOffsets    = 273
+	tiffSamplesPerPixel = 277
+	tiffRowsPerStrip    = 278
+	tiffStripByteCounts = 279
+	tiffPlanarConfig    = 284
+	tiffPredictor       = 317
+	tiffTileWidth       = 322
+	tiffTileLength      = 323
+	tiffTileOffsets     = 324
+	tiffTileByteCounts  = 325
+	tiffSampleFormat    = 339
+)
+
+// TIFF field types.
+const (
+	tiffShort = 3
+	tiffLong  = 4
+)
+
+// TIFFOptions controls WriteTIFF.
+type TIFFOptions struct {
+	// TileSize writes square tiles of this size (rounded up to
+	// a multiple of 16) instead of strips when > 0.
+	TileSize int
+}
+
+// SaveTIFF writes 1 (gray) or 3 (RGB) planes to path as an
+// uncompressed 32-bit float TIFF. Values are stored as is,
+// without any normalization or clipping.
+func SaveTIFF(path string, planes []*Plane, opts TIFFOptions) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteTIFF(f, planes, opts); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// SaveTIFFRGB writes an RGBImage as a 32-bit float RGB TIFF.
+func SaveTIFFRGB(path string, img RGBImage, opts TIFFOptions) error {
+	if err := img.Validate(); err != nil {
+		return fmt.Errorf("tiff: %w", err)
+	}
+	r, g, b := img.Planes()
+	return SaveTIFF(path, []*Plane{r, g, b}, opts)
+}
+
+// WriteTIFF encodes 1 or 3 planes as a little-endian,
+// uncompressed, chunky 32-bit IEEE float TIFF.
+func WriteTIFF(w io.Writer, planes []*Plane, opts TIFFOptions) error {
+	spp := len(planes)
+	if spp != 1 && spp != 3 {
+		return fmt.Errorf("tiff: need 1 or 3 planes, have %d", spp)
+	}
+	width, height := planes[0].W, planes[0].H
+	for _, p := range planes {
+		if p.W != width || p.H != height {
+			return fmt.Errorf("tiff: planes differ in size: %w", ErrDimensionMismatch)
+		}
+	}
+	if width == 0 || height == 0 {
+		return fmt.Errorf("tiff: %w", ErrEmptyImage)
+	}
+	pixSize := 4 * spp
+
+	// chunk layout: strips of ~64 KiB or tiles
+	var cw, ch int
+	tiled := opts.TileSize > 0
+	if tiled {
+		cw = (opts.TileSize + 15) / 16 * 16
+		ch = cw
+	} else {
+		cw = width
+		ch = max(1, min(height, (64<<10)/(width*pixSize)))
+	}
+	across := (width + cw - 1) / cw
+	down := (height + ch - 1) / ch
+
+	offsets := make([]uint32, 0, across*down)
+	counts := make([]uint32, 0, across*down)
+	pos := int64(8)
+	for ty := 0; ty < down; ty++ {
+		for tx := 0; tx < across; tx++ {
+			rows := ch
+			if !tiled {
+				rows = min(ch, height-ty*ch)
+			}
+			n := int64(cw * rows * pixSize)
+			offsets = append(offsets, uint32(pos))
+			counts = append(counts, uint32(n))
+			pos += n
+		}
+	}
+	ifdPos := pos + pos&1
+	if ifdPos > math.MaxUint32-4096 {
+		return fmt.Errorf("tiff: image too large for classic TIFF")
+	}
+
+	bits := make([]uint32, spp)
+	formats := make([]uint32, spp)
+	for i := range bits {
+		bits[i] = 32
+		formats[i] = 3 // IEEE float
+	}
+	photometric := uint32(1) // BlackIsZero
+	if spp == 3 {
+		photometric = 2
+	}
+	ifd := tiffIFD{
+		{tiffImageWidth, tiffLong, []uint32{uint32(width)}},
+		{tiffImageLength, tiffLong, []uint32{uint32(height)}},
+		{tiffBitsPerSample, tiffShort, bits},
+		{tiffCompression, tiffShort, []uint32{1}},
+		{tiffPhotometric, tiffShort, []uint32{photometric}},
+		{tiffSamplesPerPixel, tiffShort, []uint32{uint32(spp)}},
+		{tiffPlanarConfig, tiffShort, []uint32{1}},
+		{tiffSampleFormat, tiffShort, formats},
+	}
+	if tiled {
+		ifd = append(ifd,
+			tiffField{tiffTileWidth, tiffLong, []uint32{uint32(cw)}},
+			tiffField{tiffTileLength, tiffLong, []uint32{uint32(ch)}},
+			tiffField{tiffTileOffsets, tiffLong, offsets},
+			tiffField{tiffTileByteCounts, tiffLong, counts},
+		)
+	} else {
+		ifd = append(ifd,
+			tiffField{tiffStripOffsets, tiffLong, offsets},
+			tiffField{tiffRowsPerStrip, tiffLong, []uint32{uint32(ch)}},
+			tiffField{tiffStripByteCounts, tiffLong, counts},
+		)
+	}
+
+	bw := bufio.NewWriterSize(w, 1<<16)
+	hdr := []byte{'I', 'I', 42, 0, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(hdr[4:], uint32(ifdPos))
+	bw.Write(hdr)
+
+	// pixel data, chunk by chunk; tiles past the image edge
+	// are zero padded
+	buf := make([]byte, cw*pixSize)
+	for ty := 0; ty < down; ty++ {
+		for tx := 0; tx < across; tx++ {
+			rows := ch
+			if !tiled {
+				rows = min(ch, height-ty*ch)
+			}
+			for r := 0; r < rows; r++ {
+				clear(buf)
+				y := ty*ch + r
+				if y < height {
+					x0 := tx * cw
+					x1 := min(x0+cw, width)
+					for c, p := range planes {
+						row := p.Row(y)
+						for x := x0; x < x1; x++ {
+							binary.LittleEndian.PutUint32(buf[((x-x0)*spp+c)*4:], math.Float32bits(row[x]))
+						}
+					}
+				}
+				bw.Write(buf)
+			}
+		}
+	}
+	if pos&1 != 0 {
+		bw.WriteByte(0)
+	}
+	bw.Write(ifd.encode(uint32(ifdPos)))
+	return bw.Flush()
+}
+
+type tiffField struct {
+	tag    uint16
+	typ    uint16
+	values []uint32
+}
+
+type tiffIFD []tiffField
+
+// encode serializes the IFD placed at offset pos, followed by
+// the values that do not fit in an entry.
+func (ifd tiffIFD) encode(pos uint32) []byte {
+	sort.Slice(ifd, func(i, j int) bool { return ifd[i].tag < ifd[j].tag })
+	le := binary.LittleEndian
+	head := make([]byte, 2+12*len(ifd)+4)
+	var extra []byte
+	extraPos := pos + uint32(len(head))
+
+	le.PutUint16(head, uint16(len(ifd)))
+	for i, f := range ifd {
+		e := head[2+12*i:]
+		le.PutUint16(e[0:], f.tag)
+		le.PutUint16(e[2:], f.typ)
+		le.PutUint32(e[4:], uint32(len(f.values)))
+
+		size := 2
+		if f.typ == tiffLong {
+			size = 4
+		}
+		val := make([]byte, size*len(f.values))
+		for k, v := range f.values {
+			if size == 2 {
+				le.PutUint16(val[2*k:], uint16(v))
+			} else {
+				le.PutUint32(val[4*k:], v)
+			}
+		}
+		if len(val) <= 4 {
+			copy(e[8:12], val)
+		} else {
+			le.PutUint32(e[8:], extraPos+uint32(len(extra)))
+			extra = append(extra, val...)
+			if len(extra)&1 != 0 {
+				extra = append(extra, 0)
+			}
+		}
+	}
+	return append(head, extra...)
+}
+
+// LoadTIFF reads a TIFF file from disk.
+func LoadTIFF(path string) ([]*Plane, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadTIFF(f)
+}
+
+// ReadTIFF decodes the first image of a TIFF file into one
+// plane per sample.
+//
+// It accepts 32/64-bit float samples as stored and 8/16-bit
+// unsigned samples scaled to [0,1], in strips or tiles, chunky
+// or planar, uncompressed or Deflate without predictor. This
+// covers the files written by WriteTIFF and by most
+// astronomy tools.
+func ReadTIFF(r io.ReaderAt) ([]*Plane, error) {
+	var hdr [8]byte
+	if _, err := r.ReadAt(hdr[:], 0); err != nil {
+		return nil, fmt.Errorf("tiff: reading header: %w", err)
+	}
+	var bo binary.ByteOrder
+	switch string(hdr[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("tiff: bad byte order mark %q", hdr[:2])
+	}
+	if bo.Uint16(hdr[2:]) != 42 {
+		return nil, fmt.Errorf("tiff: not a classic TIFF file")
+	}
+
+	fields, err := readTIFFIFD(r, bo, int64(bo.Uint32(hdr[4:])))
+	if err != nil {
+		return nil, err
+	}
+	get := func(tag uint16, def uint32) uint32 {
+		if v := fields[tag]; len(v) > 0 {
+			return v[0]
+		}
+		return def
+	}
+
+	width := int(get(tiffImageWidth, 0))
+	height := int(get(tiffImageLength, 0))
+	spp := int(get(tiffSamplesPerPixel, 1))
+	bits := int(get(tiffBitsPerSample, 1))
+	format := get(tiffSampleFormat, 1)
+	compression := get(tiffCompression, 1)
+	planar := get(tiffPlanarConfig, 1) == 2
+	if width <= 0 || height <= 0 || spp <= 0 {
+		return nil, fmt.Errorf("tiff: invalid image geometry %dx%dx%d", width, height, spp)
+	}
+	for _, b := range fields[tiffBitsPerSample] {
+		if int(b) != bits {
+			return nil, fmt.Errorf("tiff: mixed bits per sample")
+		}
+	}
+	switch {
+	case format == 3 && (bits == 32 || bits == 64):
+	case format == 1 && (bits == 8 || bits == 16):
+	default:
+		return nil, fmt.Errorf("tiff: unsupported sample format %d/%d bits", format, bits)
+	}
+	if compression != 1 && compression != 8 && compression != 32946 {
+		return nil, fmt.Errorf("tiff: unsupported compression %d", compression)
+	}
+	if get(tiffPredictor, 1) != 1 {
+		return nil, fmt.Errorf("tiff: predictors are not supported")
+	}
+
+	bps := bits / 8
+	size, ok := mulDims(width, height, spp, bps)
+	if _, ok4 := mulDims(width, height, spp, 4); !ok || !ok4 {
+		return nil, fmt.Errorf("tiff: %dx%dx%d image of %d-bit samples is too large", width, height, spp, bits)
+	}
+
+	cw, ch := width, int(get(tiffRowsPerStrip, uint32(height)))
+	offsets, counts := fields[tiffStripOffsets], fields[tiffStripByteCounts]
+	if _, ok := fields[tiffTileWidth]; ok {
+		cw, ch = int(get(tiffTileWidth, 0)), int(get(tiffTileLength, 0))
+		offsets, counts = fields[tiffTileOffsets], fields[tiffTileByteCounts]
+	}
+	if cw <= 0 || ch <= 0 {
+		return nil, fmt.Errorf("tiff: invalid chunk size %dx%d", cw, ch)
+	}
+	ch = min(ch, max(height, 1))
+	if _, ok := mulDims(cw, ch, spp, bps); !ok {
+		return nil, fmt.Errorf("tiff: chunk size %dx%d is too large", cw, ch)
+	}
+	across := (width + cw - 1) / cw
+	down := (height + ch - 1) / ch
+	perPlane := across * down
+	chunkSpp := spp
+	nplanes := 1
+	if planar {
+		chunkSpp, nplanes = 1, spp
+	}
+	if len(offsets) < perPlane*nplanes || len(counts) < len(offsets) {
+		return nil, fmt.Errorf("tiff: missing chunk offsets")
+	}
+
+	// The chunks must be in the file, and hold enough bytes
+	// for the image, before the planes are allocated.
+	stored := 0
+	for k := 0; k < perPlane*nplanes; k++ {
+		if !readerAtHas(r, int64(offsets[k]), int64(counts[k])) {
+			return nil, fmt.Errorf("tiff: %w: chunk %d exceeds the file", io.ErrUnexpectedEOF, k)
+		}
+		stored += int(counts[k])
+	}
+	need := size
+	if compression != 1 {
+		// Deflate expands at most 1032:1.
+		need = (size + 1031) / 1032
+	}
+	if stored < need {
+		return nil, fmt.Errorf("tiff: %w: chunks hold %d bytes, image needs %d", io.ErrUnexpectedEOF, stored, size)
+	}
+
+	planes := make([]*Plane, spp)
+	for c := range planes {
+		planes[c] = NewPlane(width, height)
+	}
+	rowBytes := cw * chunkSpp * bps
+	for k := 0; k < perPlane*nplanes; k++ {
+		data := make([]byte, counts[k])
+		if _, err := r.ReadAt(data, int64(offsets[k])); err != nil {
+			return nil, fmt.Errorf("tiff: reading chunk %d: %w", k, err)
+		}
+		if compression != 1 {
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, fmt.Errorf("tiff: deflate: %w", err)
+			}
+			if data, err = io.ReadAll(io.LimitReader(zr, int64(ch*rowBytes))); err != nil {
+				return nil, fmt.Errorf("tiff: deflate: %w", err)
+			}
+		}
+
+		plane0 := k / perPlane
+		idx := k % perPlane
+		x0, y0 := idx%across*cw, idx/across*ch
+		for r := 0; r < ch && y0+r < height; r++ {
+			if (r+1)*rowBytes > len(data) {
+				return nil, fmt.Errorf("tiff: chunk %d is truncated", k)
+			}
+			src := data[r*rowBytes:]
+			for x := x0; x < min(x0+cw, width); x++ {
+				for s := 0; s < chunkSpp; s++ {
+					v := decodeTIFFSample(src[((x-x0)*chunkSpp+s)*bps:], bits, format, bo)
+					planes[plane0+s].Row(y0 + r)[x] = v
+				}
+			}
+		}
+	}
+	return planes, nil
+}
+
+func decodeTIFFSample(b []byte, bits int, format uint32, bo binary.ByteOrder) float32 {
+	switch {
+	case format == 3 && bits == 32:
+		return math.Float32frombits(bo.Uint32(b))
+	case format == 3:
+		return float32(math.Float64frombits(bo.Uint64(b)))
+	case bits == 8:
+		return float32(b[0]) / math.MaxUint8
+	default:
+		return float32(bo.Uint16(b)) / math.MaxUint16
+	}
+}
+
+// readTIFFIFD reads the SHORT and LONG fields of the IFD at pos.
+func readTIFFIFD(r io.ReaderAt, bo binary.ByteOrder, pos int64) (map[uint16][]uint32, error) {
+	var nb [2]byte
+	if _, err := r.ReadAt(nb[:], pos); err != nil {
+		return nil, fmt.Errorf("tiff: reading IFD: %w", err)
+	}
+	n := int(bo.Uint16(nb[:]))
+	entries := make([]byte, 12*n)
+	if _, err := r.ReadAt(entries, pos+2); err != nil {
+		return nil, fmt.Errorf("tiff: reading IFD: %w", err)
+	}
+
+	fields := make(map[uint16][]uint32, n)
+	for i := 0; i < n; i++ {
+		e := entries[12*i:]
+		tag, typ, count := bo.Uint16(e), bo.Uint16(e[2:]), int(bo.Uint32(e[4:]))
+		size := 0
+		switch typ {
+		case tiffShort:
+			size = 2
+		case tiffLong:
+			size = 4
+		default:
+			continue
+		}
+		if count > 1<<24 {
+			return nil, fmt.Errorf("tiff: field %d too large", tag)
+		}
+		val := e[8:12]
+		if count*size > 4 {
+			if !readerAtHas(r, int64(bo.Uint32(e[8:])), int64(count*size)) {
+				return nil, fmt.Errorf("tiff: %w: field %d exceeds the file", io.ErrUnexpectedEOF, tag)
+			}
+			val = make([]byte, count*size)
+			if _, err := r.ReadAt(val, int64(bo.Uint32(e[8:]))); err != nil {
+				return nil, fmt.Errorf("tiff: reading field %d: %w", tag, err)
+			}
+		}
+		vs := make([]uint32, count)
+		for k := range vs {
+			if size == 2 {
+				vs[k] = uint32(bo.Uint16(val[2*k:]))
+			} else {
+				vs[k] = bo.Uint32(val[4*k:])
+			}
+		}
+		fields[tag] = vs
+	}
+	return fields, nil
+}
@@ -0,0 +1,240 @@
+package goimagefreq
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func tiffTestPlanes(w, h, spp int) []*Plane {
+	planes := make([]*Plane, spp)
+	for c := range planes {
+		planes[c] = NewPlane(w, h)
+		for i := range planes[c].Data {
+			planes[c].Data[i] = float32((i*131+c*17)%256) / math.MaxUint8
+		}
+	}
+	return planes
+}
+
+func TestTIFFRoundTrip(t *testing.T) {
+	for _, spp := range []int{1, 3} {
+		for _, tile := range []int{0, 16, 40} {
+			name := fmt.Sprintf("spp %d tile %d", spp, tile)
+			planes := tiffTestPlanes(53, 37, spp)
+			var buf bytes.Buffer
+			if err := WriteTIFF(&buf, planes, TIFFOptions{TileSize: tile}); err != nil {
+				t.Fatalf("%s: WriteTIFF: %v", name, err)
+			}
+			got, err := ReadTIFF(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("%s: ReadTIFF: %v", name, err)
+			}
+			if len(got) != spp {
+				t.Fatalf("%s: read %d planes", name, len(got))
+			}
+			for c := range got {
+				if err := MaxAbsErrorPlane(got[c], planes[c]); err != 0 {
+					t.Errorf("%s: plane %d differs by %g", name, c, err)
+				}
+			}
+		}
+	}
+}
+
+// tiffTestFile builds a little-endian TIFF with one strip per
+// chunk, stored from offset 8, plus the given fields.
+func tiffTestFile(chunks [][]byte, fields ...tiffField) []byte {
+	file := []byte{'I', 'I', 42, 0, 0, 0, 0, 0}
+	var offsets, counts []uint32
+	for _, c := range chunks {
+		offsets = append(offsets, uint32(len(file)))
+		counts = append(counts, uint32(len(c)))
+		file = append(file, c...)
+	}
+	if len(file)&1 != 0 {
+		file = append(file, 0)
+	}
+	ifd := tiffIFD(fields)
+	if !tiffHasField(ifd, tiffStripOffsets) {
+		ifd = append(ifd, tiffField{tiffStripOffsets, tiffLong, offsets})
+	}
+	if !tiffHasField(ifd, tiffStripByteCounts) {
+		ifd = append(ifd, tiffField{tiffStripByteCounts, tiffLong, counts})
+	}
+	binary.LittleEndian.PutUint32(file[4:], uint32(len(file)))
+	return append(file, ifd.encode(uint32(len(file)))...)
+}
+
+func tiffHasField(ifd tiffIFD, tag uint16) bool {
+	for _, f := range ifd {
+		if f.tag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeTIFFTestSample(dst []byte, v float32, bits int) []byte {
+	le := binary.LittleEndian
+	switch bits {
+	case 8:
+		return append(dst, byte(math.Round(float64(v)*math.MaxUint8)))
+	case 16:
+		return le.AppendUint16(dst, uint16(math.Round(float64(v)*math.MaxUint16)))
+	case 32:
+		return le.AppendUint32(dst, math.Float32bits(v))
+	}
+	return le.AppendUint64(dst, math.Float64bits(float64(v)))
+}
+
+func TestReadTIFFFormats(t *testing.T) {
+	const w, h = 9, 5
+	for _, bits := range []int{8, 16, 32, 64} {
+		for _, planar := range []bool{false, true} {
+			for _, deflate := range []bool{false, true} {
+				name := fmt.Sprintf("%d bits planar %v deflate %v", bits, planar, deflate)
+				planes := tiffTestPlanes(w, h, 3)
+
+				var chunks [][]byte
+				if planar {
+					for _, p := range planes {
+						var c []byte
+						for _, v := range p.Data {
+							c = encodeTIFFTestSample(c, v, bits)
+						}
+						chunks = append(chunks, c)
+					}
+				} else {
+					var c []byte
+					for i := range planes[0].Data {
+						for _, p := range planes {
+							c = encodeTIFFTestSample(c, p.Data[i], bits)
+						}
+					}
+					chunks = [][]byte{c}
+				}
+				compression := uint32(1)
+				if deflate {
+					compression = 8
+					for i, c := range chunks {
+						var buf bytes.Buffer
+						zw := zlib.NewWriter(&buf)
+						zw.Write(c)
+						zw.Close()
+						chunks[i] = buf.Bytes()
+					}
+				}
+				format, planarConfig := uint32(1), uint32(1)
+				if bits > 16 {
+					format = 3
+				}
+				if planar {
+					planarConfig = 2
+				}
+				file := tiffTestFile(chunks,
+					tiffField{tiffImageWidth, tiffLong, []uint32{w}},
+					tiffField{tiffImageLength, tiffLong, []uint32{h}},
+					tiffField{tiffBitsPerSample, tiffShort, []uint32{uint32(bits), uint32(bits), uint32(bits)}},
+					tiffField{tiffCompression, tiffShort, []uint32{compression}},
+					tiffField{tiffSamplesPerPixel, tiffShort, []uint32{3}},
+					tiffField{tiffPlanarConfig, tiffShort, []uint32{planarConfig}},
+					tiffField{tiffSampleFormat, tiffShort, []uint32{format, format, format}},
+				)
+
+				got, err := ReadTIFF(bytes.NewReader(file))
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				for c := range got {
+					if err := MaxAbsErrorPlane(got[c], planes[c]); err > 1e-7 {
+						t.Errorf("%s: plane %d differs by %g", name, c, err)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestReadTIFFRejectsHostileHeader(t *testing.T) {
+	var bomb bytes.Buffer
+	zw := zlib.NewWriter(&bomb)
+	zw.Write(make([]byte, 1<<20))
+	zw.Close()
+
+	gray := func(w, h uint32, bits, compression uint32) []tiffField {
+		format := uint32(1)
+		if bits > 16 {
+			format = 3
+		}
+		return []tiffField{
+			{tiffImageWidth, tiffLong, []uint32{w}},
+			{tiffImageLength, tiffLong, []uint32{h}},
+			{tiffBitsPerSample, tiffShort, []uint32{bits}},
+			{tiffCompression, tiffShort, []uint32{compression}},
+			{tiffSampleFormat, tiffShort, []uint32{format}},
+		}
+	}
+	tests := []struct {
+		name string
+		file []byte
+		want error
+	}{
+		{"huge image", tiffTestFile([][]byte{make([]byte, 64)}, gray(65535, 65535, 64, 1)...), io.ErrUnexpectedEOF},
+		{"huge deflate image", tiffTestFile([][]byte{bomb.Bytes()}, gray(65535, 65535, 64, 8)...), io.ErrUnexpectedEOF},
+		{"overflow", tiffTestFile([][]byte{make([]byte, 64)}, append(gray(math.MaxUint32, math.MaxUint32, 64, 1),
+			tiffField{tiffSamplesPerPixel, tiffShort, []uint32{3}})...), nil},
+		{"chunk past EOF", tiffTestFile(nil, append(gray(8, 8, 8, 1),
+			tiffField{tiffStripOffsets, tiffLong, []uint32{8}},
+			tiffField{tiffStripByteCounts, tiffLong, []uint32{math.MaxUint32 - 16}})...), io.ErrUnexpectedEOF},
+		{"huge tile", tiffTestFile([][]byte{make([]byte, 64)}, append(gray(8, 8, 8, 1),
+			tiffField{tiffTileWidth, tiffLong, []uint32{math.MaxUint32}},
+			tiffField{tiffTileLength, tiffLong, []uint32{math.MaxUint32}},
+			tiffField{tiffTileOffsets, tiffLong, []uint32{8}},
+			tiffField{tiffTileByteCounts, tiffLong, []uint32{64}})...), nil},
+	}
+	for _, tt := range tests {
+		planes, err := ReadTIFF(bytes.NewReader(tt.file))
+		if err == nil {
+			t.Errorf("%s: read a %dx%d image", tt.name, planes[0].W, planes[0].H)
+			continue
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// A field whose values lie past the end of the file.
+	file := tiffTestFile([][]byte{make([]byte, 64)}, append(gray(8, 8, 8, 1),
+		tiffField{tiffTileOffsets, tiffLong, make([]uint32, 1<<20)})...)
+	file = file[:len(file)-1<<21]
+	if _, err := ReadTIFF(bytes.NewReader(file)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("field past EOF: got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestLoadTIFFShortFile(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteTIFF(&buf, tiffTestPlanes(64, 64, 1), TIFFOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	// Keep the IFD but drop half the pixel data.
+	file := buf.Bytes()
+	ifd := binary.LittleEndian.Uint32(file[4:])
+	short := append(append([]byte(nil), file[:8+64*64*2]...), file[ifd:]...)
+	binary.LittleEndian.PutUint32(short[4:], 8+64*64*2)
+	path := filepath.Join(t.TempDir(), "short.tif")
+	if err := os.WriteFile(path, short, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadTIFF(path); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
@@ -2,21 +2,22 @@
 package goimagefreq
 
 import (
+	"image"
 	"image/png"
 	"math"
 	"os"
-	"sync"
 )
 
-// MaxAbsError computes the maximum absolute
+// MaxAbsErrorPlane computes the maximum absolute
 // pixel-wise difference between two images.
-func MaxAbsError(a, b [][]float32) float32 {
-	h := len(a)
-	w := len(a[0])
+func MaxAbsErrorPlane(a, b *Plane) float32 {
+	h := a.H
+	w := a.W
 	maxErr := float32(0)
 	for y := 0; y < h; y++ {
+		ar, br := a.Row(y), b.Row(y)
 		for x := 0; x < w; x++ {
-			e := float32(math.Abs(float64(a[y][x] - b[y][x])))
+			e := float32(math.Abs(float64(ar[x] - br[x])))
 			if e > maxErr {
 				maxErr = e
 			}
@@ -25,25 +26,36 @@ func MaxAbsError(a, b [][]float32) float32 {
 	return maxErr
 }
 
-// DiffImage returns the absolute difference image
+// MaxAbsError is the [][]float32 adapter for MaxAbsErrorPlane.
+func MaxAbsError(a, b [][]float32) float32 {
+	return MaxAbsErrorPlane(PlaneFromRows(a), PlaneFromRows(b))
+}
+
+// DiffImagePlane returns the absolute difference image
 // for visual inspection.
-func DiffImage(a, b [][]float32) [][]float32 {
-	h := len(a)
-	w := len(a[0])
-	out := make([][]float32, h)
+func DiffImagePlane(a, b *Plane) *Plane {
+	h := a.H
+	w := a.W
+	out := NewPlane(w, h)
 	for y := 0; y < h; y++ {
-		out[y] = make([]float32, w)
+		ar, br, o := a.Row(y), b.Row(y), out.Row(y)
 		for x := 0; x < w; x++ {
-			out[y][x] = float32(math.Abs(float64(a[y][x] - b[y][x])))
+			o[x] = float32(math.Abs(float64(ar[x] - br[x])))
 		}
 	}
 	return out
 }
 
-// SaveF32PNG saves a float32 image as an 8-bit PNG
+// DiffImage is the [][]float32 adapter for DiffImagePlane.
+func DiffImage(a, b [][]float32) [][]float32 {
+	return DiffImagePlane(PlaneFromRows(a), PlaneFromRows(b)).Rows()
+}
+
+// SavePlanePNG saves a float32 plane as an 8-bit PNG
 // after linear normalization (debug/visualization only).
-func SaveF32PNG(path string, img [][]float32) error {
-	out := F32ToGray(img)
+// Use SaveTIFF or SavePlanePNG16 to keep absolute levels.
+func SavePlanePNG(path string, img *Plane) error {
+	out := PlaneToGray(img)
 	f, err := os.Create(path)
 	if err != nil {
 		return err
@@ -52,9 +64,16 @@ func SaveF32PNG(path string, img [][]float32) error {
 	return png.Encode(f, out)
 }
 
-// SaveF32PNGRGB saves three float32 channels as a PNG to path.
-func SaveF32PNGRGB(path string, rImg, gImg, bImg [][]float32) error {
-	out := F32ToRGB(rImg, gImg, bImg)
+// SaveF32PNG is the [][]float32 adapter for SavePlanePNG.
+func SaveF32PNG(path string, img [][]float32) error {
+	return SavePlanePNG(path, PlaneFromRows(img))
+}
+
+// SavePlanePNGRGB saves three float32 planes as a PNG to path,
+// normalizing each channel on its own (this changes the color
+// balance; use SaveTIFF or SavePlanePNG16RGB to preserve it).
+func SavePlanePNGRGB(path string, rImg, gImg, bImg *Plane) error {
+	out := PlanesToRGB(rImg, gImg, bImg)
 	f, err := os.Create(path)
 	if err != nil {
 		return err
@@ -63,42 +82,95 @@ func SaveF32PNGRGB(path string, rImg, gImg, bImg [][]float32) error {
 	return png.Encode(f, out)
 }
 
+// SaveF32PNGRGB is the [][]float32 adapter for SavePlanePNGRGB.
+func SaveF32PNGRGB(path string, rImg, gImg, bImg [][]float32) error {
+	return SavePlanePNGRGB(path, PlaneFromRows(rImg), PlaneFromRows(gImg), PlaneFromRows(bImg))
+}
+
+// SavePlanePNG16 saves a plane as a 16-bit grayscale PNG,
+// mapping [lo, hi] to the full 16-bit range and clipping
+// outside it.
+func SavePlanePNG16(path string, img *Plane, lo, hi float32) error {
+	return savePNG(path, PlaneToGray16(img, lo, hi))
+}
+
+// SaveF32PNG16 is the [][]float32 adapter for SavePlanePNG16.
+func SaveF32PNG16(path string, img [][]float32, lo, hi float32) error {
+	return SavePlanePNG16(path, PlaneFromRows(img), lo, hi)
+}
+
+// SavePlanePNG16RGB saves three planes as a 16-bit RGB PNG,
+// mapping [lo, hi] to the full 16-bit range in every channel.
+func SavePlanePNG16RGB(path string, rImg, gImg, bImg *Plane, lo, hi float32) error {
+	return savePNG(path, PlanesToRGB64(rImg, gImg, bImg, lo, hi))
+}
+
+// SaveF32PNG16RGB is the [][]float32 adapter for SavePlanePNG16RGB.
+func SaveF32PNG16RGB(path string, rImg, gImg, bImg [][]float32, lo, hi float32) error {
+	return SavePlanePNG16RGB(path, PlaneFromRows(rImg), PlaneFromRows(gImg), PlaneFromRows(bImg), lo, hi)
+}
+
+// SaveMultiImagePNG16 saves a 1- or 3-channel image as a
+// 16-bit PNG, mapping [lo, hi] to the full range and keeping
+// the alpha plane if there is one.
+func SaveMultiImagePNG16(path string, m *MultiImage, lo, hi float32) error {
+	img, err := m.NRGBA64(lo, hi)
+	if err != nil {
+		return err
+	}
+	return savePNG(path, img)
+}
+
+func savePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 // MaxAbsErrorRGB returns the maximum absolute error per channel (as triple).
 func MaxAbsErrorRGB(aR, aG, aB, bR, bG, bB [][]float32) (errR, errG, errB float32) {
-	var wg sync.WaitGroup
-	wg.Add(3)
-
-	go func() {
-		defer wg.Done()
-		errR = MaxAbsError(aR, bR)
-	}()
-	go func() {
-		defer wg.Done()
-		errG = MaxAbsError(aG, bG)
-	}()
-	go func() {
-		defer wg.Done()
-		errB = MaxAbsError(aB, bB)
-	}()
+	errR, errG, errB, err := MaxAbsErrorRGBErr(aR, aG, aB, bR, bG, bB)
+	panicOnError(err)
 	return
 }
 
+// MaxAbsErrorRGBErr is MaxAbsErrorRGB returning an error
+// instead of panicking on empty, ragged or mismatched images.
+func MaxAbsErrorRGBErr(aR, aG, aB, bR, bG, bB [][]float32) (errR, errG, errB float32, err error) {
+	if err := validateRowsSameSize(aR, aG, aB, bR, bG, bB); err != nil {
+		return 0, 0, 0, err
+	}
+	a := [3][][]float32{aR, aG, aB}
+	b := [3][][]float32{bR, bG, bB}
+	out := dispatch(3, func(c int) float32 {
+		return MaxAbsError(a[c], b[c])
+	})
+	return out[0], out[1], out[2], nil
+}
+
 // DiffImageRGB returns absolute-difference images per channel.
 func DiffImageRGB(aR, aG, aB, bR, bG, bB [][]float32) (dR, dG, dB [][]float32) {
-	var wg sync.WaitGroup
-	wg.Add(3)
-
-	go func() {
-		defer wg.Done()
-		dR = DiffImage(aR, bR)
-	}()
-	go func() {
-		defer wg.Done()
-		dG = DiffImage(aG, bG)
-	}()
-	go func() {
-		defer wg.Done()
-		dB = DiffImage(aB, bB)
-	}()
+	dR, dG, dB, err := DiffImageRGBErr(aR, aG, aB, bR, bG, bB)
+	panicOnError(err)
 	return
 }
+
+// DiffImageRGBErr is DiffImageRGB returning an error instead
+// of panicking on empty, ragged or mismatched images.
+func DiffImageRGBErr(aR, aG, aB, bR, bG, bB [][]float32) (dR, dG, dB [][]float32, err error) {
+	if err := validateRowsSameSize(aR, aG, aB, bR, bG, bB); err != nil {
+		return nil, nil, nil, err
+	}
+	a := [3][][]float32{aR, aG, aB}
+	b := [3][][]float32{bR, bG, bB}
+	out := dispatch(3, func(c int) [][]float32 {
+		return DiffImage(a[c], b[c])
+	})
+	return out[0], out[1], out[2], nil
+}
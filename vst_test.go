@@ -0,0 +1,119 @@
+package goimagefreq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// poissonGaussianPlane returns n samples of gain·Poisson(λ)
+// plus normal noise of the given sigma and offset.
+func poissonGaussianPlane(r *rand.Rand, n int, lambda float64, noise PoissonGaussian) *Plane {
+	p := NewPlane(n, 1)
+	limit := math.Exp(-lambda)
+	for i := range p.Data {
+		// Knuth's multiplication method
+		k, prod := -1, 1.0
+		for prod > limit {
+			prod *= r.Float64()
+			k++
+		}
+		p.Data[i] = float32(noise.Gain*float64(k) + noise.Offset + noise.ReadNoise*r.NormFloat64())
+	}
+	return p
+}
+
+func meanVariance(p *Plane) (mean, variance float64) {
+	for _, v := range p.Data {
+		mean += float64(v)
+	}
+	mean /= float64(len(p.Data))
+	for _, v := range p.Data {
+		d := float64(v) - mean
+		variance += d * d
+	}
+	return mean, variance / float64(len(p.Data)-1)
+}
+
+// The unbiased inverse maps the mean of the transformed
+// samples back to the photon rate, even at low counts.
+func TestInverseGeneralizedAnscombeIsUnbiased(t *testing.T) {
+	r := rand.New(rand.NewSource(19))
+	models := []PoissonGaussian{
+		{Gain: 1},
+		{Gain: 1, ReadNoise: 1},
+		{Gain: 0.01, ReadNoise: 0.005, Offset: 0.1},
+	}
+	for _, noise := range models {
+		for _, lambda := range []float64{0.5, 2, 20} {
+			name := fmt.Sprintf("%+v λ=%g", noise, lambda)
+			stable := GeneralizedAnscombePlane(poissonGaussianPlane(r, 200000, lambda, noise), noise)
+			mean, _ := meanVariance(stable)
+			m := NewPlane(1, 1)
+			m.Data[0] = float32(mean)
+			got := (float64(InverseGeneralizedAnscombePlane(m, noise).Data[0]) - noise.Offset) / noise.Gain
+			if math.Abs(got-lambda) > 0.03*lambda {
+				t.Errorf("%s: recovered λ=%g", name, got)
+			}
+		}
+	}
+}
+
+func TestGeneralizedAnscombeStabilizesVariance(t *testing.T) {
+	r := rand.New(rand.NewSource(20))
+	for _, noise := range []PoissonGaussian{{Gain: 1}, {Gain: 1, ReadNoise: 2}, {Gain: 0.01, ReadNoise: 0.03, Offset: 0.1}} {
+		for _, lambda := range []float64{20, 100} {
+			stable := GeneralizedAnscombePlane(poissonGaussianPlane(r, 100000, lambda, noise), noise)
+			if _, v := meanVariance(stable); math.Abs(v-1) > 0.05 {
+				t.Errorf("%+v λ=%g: variance %g after the transform", noise, lambda, v)
+			}
+		}
+	}
+}
+
+func TestGeneralizedAnscombeCtxErrors(t *testing.T) {
+	ctx := context.Background()
+	src := NewPlane(4, 4)
+	if _, err := GeneralizedAnscombePlaneCtx(ctx, &Plane{}, PoissonGaussian{Gain: 1}, nil); !errors.Is(err, ErrEmptyImage) {
+		t.Errorf("empty image: got %v", err)
+	}
+	for _, noise := range []PoissonGaussian{{}, {Gain: 1, ReadNoise: -1}, {Gain: 1, Offset: math.NaN()}} {
+		if _, err := GeneralizedAnscombePlaneCtx(ctx, src, noise, nil); !errors.Is(err, ErrInvalidParameter) {
+			t.Errorf("forward %+v: got %v", noise, err)
+		}
+		if _, err := InverseGeneralizedAnscombePlaneCtx(ctx, src, noise, nil); !errors.Is(err, ErrInvalidParameter) {
+			t.Errorf("inverse %+v: got %v", noise, err)
+		}
+	}
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := InverseGeneralizedAnscombePlaneCtx(canceled, src, PoissonGaussian{Gain: 1}, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled: got %v", err)
+	}
+}
+
+func TestVSTTableCacheIsBounded(t *testing.T) {
+	first := unbiasedInverse(0.5)
+	if unbiasedInverse(0.5) != first {
+		t.Fatal("cached table was rebuilt")
+	}
+	for i := 0; i < 3*vstTablesMax; i++ {
+		unbiasedInverse(1 + float64(i)/7)
+		unbiasedInverse(0.5) // keep it recently used
+	}
+	vstTablesMu.Lock()
+	n := len(vstTables)
+	vstTablesMu.Unlock()
+	if n > vstTablesMax {
+		t.Errorf("cache holds %d tables, want at most %d", n, vstTablesMax)
+	}
+	if unbiasedInverse(0.5) != first {
+		t.Error("recently used table was evicted")
+	}
+	if unbiasedInverse(1) == unbiasedInverse(1+1.0/7) {
+		t.Error("different read noise shares a table")
+	}
+}
@@ -2,16 +2,17 @@
 package goimagefreq
 
 import (
+	"context"
 	"math"
 	"math/rand"
 )
 
-// Median Absolute Deviation (robust sigma estimator)
-func MAD(img [][]float32) float64 {
-	var vals []float64
-	for y := range img {
-		for x := range img[y] {
-			vals = append(vals, float64(img[y][x]))
+// MADPlane returns the Median Absolute Deviation (robust sigma estimator)
+func MADPlane(img *Plane) float64 {
+	vals := make([]float64, 0, img.W*img.H)
+	for y := 0; y < img.H; y++ {
+		for _, v := range img.Row(y) {
+			vals = append(vals, float64(v))
 		}
 	}
 	median := quickMedian(vals)
@@ -21,6 +22,11 @@ func MAD(img [][]float32) float64 {
 	return quickMedian(vals)
 }
 
+// MAD is the [][]float32 adapter for MADPlane.
+func MAD(img [][]float32) float64 {
+	return MADPlane(PlaneFromRows(img))
+}
+
 // Soft-threshold shrinkage
 func softThreshold(v, t float32) float32 {
 	if math.Abs(float64(v)) <= float64(t) {
@@ -32,26 +38,151 @@ func softThreshold(v, t float32) float32 {
 	return float32(v + t)
 }
 
-// AtrousWaveletDenoiseL applies wavelet denoising to luminance only.
-func AtrousWaveletDenoiseL(L [][]float32, levels int, strength []float32) [][]float32 {
-	details, residual := AtrousWavelet(L, levels)
+// DenoiseOptions are optional settings of the wavelet
+// denoisers. The zero value gives their plain behavior.
+type DenoiseOptions struct {
+	// Transform replaces the à trous decomposition, e.g.
+	// with MMTPlaneCtx so that thresholding leaves no rings
+	// around stars. nil is à trous.
+	Transform Transform
 
-	for i := 0; i < levels; i++ {
-		sigma := MAD(details[i]) / 0.6745
-		thr := strength[i] * float32(sigma)
+	// NoiseGains, when set, makes the denoisers measure the
+	// noise once, on the first layer, and scale it to layer
+	// i by NoiseGains[i]/NoiseGains[0] instead of measuring
+	// every layer, which overestimates the noise of coarse
+	// layers where signal dominates. Use the table of the
+	// transform: StarletNoiseGains, SWTNoiseGains or
+	// MultiBandNoiseGains.
+	NoiseGains []float64
 
-		for y := range details[i] {
-			for x := range details[i][y] {
-				details[i][y][x] =
-					softThreshold(details[i][y][x], thr)
-			}
+	// Shrinkage replaces the denoiser's thresholding rule,
+	// e.g. with GarroteShrink, FirmShrink(2) or
+	// AmountShrink(SoftShrink, 0.7). nil keeps the default.
+	Shrinkage Shrinkage
+
+	// Selector, when set, replaces the k-sigma thresholds:
+	// each layer is thresholded where the selector puts it
+	// for that layer's coefficients and noise, and the
+	// denoiser's per-layer values only enable (> 0) or skip
+	// a layer. ManualThreshold keeps the k-sigma thresholds.
+	Selector ThresholdSelector
+}
+
+// transformOr returns the decomposition to denoise in, def
+// unless Transform is set.
+func (o DenoiseOptions) transformOr(def Transform) Transform {
+	if o.Transform == nil {
+		return def
+	}
+	return o.Transform
+}
+
+// shrinkage returns the thresholding rule to use, def unless
+// Shrinkage is set.
+func (o DenoiseOptions) shrinkage(def Shrinkage) Shrinkage {
+	if o.Shrinkage == nil {
+		return def
+	}
+	return o.Shrinkage
+}
+
+// threshold returns the threshold for layer: k times its
+// noise sigma, or the Selector's choice when one is set.
+func (o DenoiseOptions) threshold(layer *Plane, noise, k float32) float32 {
+	if o.Selector == ManualThreshold {
+		return k * noise
+	}
+	return SelectThresholdPlane(layer, noise, o.Selector)
+}
+
+// validate checks the options for a levels-deep denoise.
+func (o DenoiseOptions) validate(levels int) error {
+	if o.Selector != ManualThreshold {
+		if err := o.Selector.validate(); err != nil {
+			return err
+		}
+	}
+	if o.NoiseGains != nil {
+		return validateNoiseGains(o.NoiseGains, levels)
+	}
+	return nil
+}
+
+// AtrousWaveletDenoiseLPlane applies wavelet denoising to luminance only.
+func AtrousWaveletDenoiseLPlane(L *Plane, levels int, strength []float32, edge Edge) *Plane {
+	out, err := AtrousWaveletDenoiseLPlaneCtx(context.Background(), L, levels, strength, edge, nil)
+	panicOnError(err)
+	return out
+}
+
+// AtrousWaveletDenoiseLPlaneCtx is AtrousWaveletDenoiseLPlane
+// with cancellation. It reports one progress step per level
+// plus a final step for thresholding and reconstruction.
+func AtrousWaveletDenoiseLPlaneCtx(ctx context.Context, L *Plane, levels int, strength []float32, edge Edge, progress ProgressFunc) (*Plane, error) {
+	return AtrousWaveletDenoiseLOptsPlaneCtx(ctx, L, levels, strength, edge, DenoiseOptions{}, progress)
+}
+
+// AtrousWaveletDenoiseLOptsPlane is AtrousWaveletDenoiseLPlane
+// with options.
+func AtrousWaveletDenoiseLOptsPlane(L *Plane, levels int, strength []float32, edge Edge, opts DenoiseOptions) *Plane {
+	out, err := AtrousWaveletDenoiseLOptsPlaneCtx(context.Background(), L, levels, strength, edge, opts, nil)
+	panicOnError(err)
+	return out
+}
+
+// AtrousWaveletDenoiseLOptsPlaneCtx is
+// AtrousWaveletDenoiseLOptsPlane with cancellation. It
+// reports progress like AtrousWaveletDenoiseLPlaneCtx.
+func AtrousWaveletDenoiseLOptsPlaneCtx(ctx context.Context, L *Plane, levels int, strength []float32, edge Edge, opts DenoiseOptions, progress ProgressFunc) (*Plane, error) {
+	if len(strength) < levels {
+		return nil, invalidParam("%d strength values for %d levels", len(strength), levels)
+	}
+	if err := opts.validate(levels); err != nil {
+		return nil, err
+	}
+
+	total := levels + 1
+	details, residual, err := opts.transformOr(AtrousWaveletPlaneCtx)(ctx, L, levels, edge, progress.withTotal(total))
+	if err != nil {
+		return nil, err
+	}
+
+	var noise []float32
+	if opts.NoiseGains != nil {
+		noise = propagatedNoise(details, opts.NoiseGains)
+	}
+	for i := 0; i < levels; i++ {
+		if opts.Selector != ManualThreshold && strength[i] <= 0 {
+			continue
 		}
+		sigma := MADPlane(details[i]) / 0.6745
+		if noise != nil {
+			sigma = float64(noise[i])
+		}
+		thr := opts.threshold(details[i], float32(sigma), strength[i])
+
+		shrinkPlane(details[i], thr, opts.shrinkage(softThreshold))
 	}
 
-	return AtrousReconstruct(details, residual)
+	out := AtrousReconstructPlane(details, residual)
+	progress.report(total, total)
+	return out, nil
 }
 
-// quickMedian returns the median value of the slice.
+// AtrousWaveletDenoiseL is the [][]float32 adapter for AtrousWaveletDenoiseLPlane
+// (clamp-to-edge).
+func AtrousWaveletDenoiseL(L [][]float32, levels int, strength []float32) [][]float32 {
+	return AtrousWaveletDenoiseLPlane(PlaneFromRows(L), levels, strength, Edge{}).Rows()
+}
+
+// AtrousWaveletDenoiseLOpts is the [][]float32 adapter for
+// AtrousWaveletDenoiseLOptsPlane (clamp-to-edge).
+func AtrousWaveletDenoiseLOpts(L [][]float32, levels int, strength []float32, opts DenoiseOptions) [][]float32 {
+	return AtrousWaveletDenoiseLOptsPlane(PlaneFromRows(L), levels, strength, Edge{}, opts).Rows()
+}
+
+// quickMedian returns the median value of the slice: the
+// element of rank n/2, i.e. the upper median for even n.
 // The input slice is modified.
 func quickMedian(a []float64) float64 {
 	n := len(a)
@@ -60,51 +191,115 @@ func quickMedian(a []float64) float64 {
 	}
 	k := n / 2
 
-	lo, hi := 0, n-1
-	for {
-		if lo == hi {
-			return a[lo]
-		}
-		p := partition(a, lo, hi)
-		if k == p {
+	// a[lo:hi] holds the ranks still in question.
+	lo, hi := 0, n
+	for hi-lo > 1 {
+		lt, gt := partition(a, lo, hi)
+		switch {
+		case k < lt:
+			hi = lt
+		case k >= gt:
+			lo = gt
+		default:
 			return a[k]
-		} else if k < p {
-			hi = p - 1
-		} else {
-			lo = p + 1
 		}
 	}
+	return a[lo]
 }
 
-func partition(a []float64, lo, hi int) int {
-	pivot := a[lo+rand.Intn(hi-lo+1)]
-	i, j := lo, hi
-
-	for {
-		for a[i] < pivot {
+// partition rearranges a[lo:hi] around a random pivot into
+// a[lo:lt] < pivot, a[lt:gt] == pivot and a[gt:hi] > pivot.
+// The middle run is never empty, so quickMedian always makes
+// progress.
+func partition(a []float64, lo, hi int) (lt, gt int) {
+	pivot := a[lo+rand.Intn(hi-lo)]
+	lt, gt = lo, hi
+	for i := lo; i < gt; {
+		switch v := a[i]; {
+		case v < pivot:
+			a[i], a[lt] = a[lt], a[i]
+			lt++
+			i++
+		case v > pivot:
+			gt--
+			a[i], a[gt] = a[gt], a[i]
+		default:
 			i++
 		}
-		for a[j] > pivot {
-			j--
-		}
-		if i >= j {
-			return j
-		}
-		a[i], a[j] = a[j], a[i]
-		i++
-		j--
 	}
+	return lt, gt
 }
 
-func WaveletDenoiseMLT(
-	L [][]float32,
+// WaveletDenoiseMLTPlane soft-thresholds each à trous layer
+// with an absolute threshold (fine → coarse). Layers beyond
+// len(sigma) reuse the last entry; zero disables a layer.
+func WaveletDenoiseMLTPlane(
+	L *Plane,
 	sigma []float32,
-) [][]float32 {
+	edge Edge,
+) *Plane {
+	out, err := WaveletDenoiseMLTPlaneCtx(context.Background(), L, sigma, edge, nil)
+	panicOnError(err)
+	return out
+}
+
+// WaveletDenoiseMLTPlaneCtx is WaveletDenoiseMLTPlane with
+// cancellation. It reports one progress step per layer plus a
+// final step for thresholding and reconstruction.
+func WaveletDenoiseMLTPlaneCtx(
+	ctx context.Context,
+	L *Plane,
+	sigma []float32,
+	edge Edge,
+	progress ProgressFunc,
+) (*Plane, error) {
+	return WaveletDenoiseMLTOptsPlaneCtx(ctx, L, sigma, edge, DenoiseOptions{}, progress)
+}
+
+// WaveletDenoiseMLTOptsPlane is WaveletDenoiseMLTPlane with
+// options. With NoiseGains set, sigma holds k-sigma
+// multipliers of each layer's propagated noise rather than
+// absolute thresholds; with a Selector, its positive entries
+// only enable layers.
+func WaveletDenoiseMLTOptsPlane(
+	L *Plane,
+	sigma []float32,
+	edge Edge,
+	opts DenoiseOptions,
+) *Plane {
+	out, err := WaveletDenoiseMLTOptsPlaneCtx(context.Background(), L, sigma, edge, opts, nil)
+	panicOnError(err)
+	return out
+}
+
+// WaveletDenoiseMLTOptsPlaneCtx is WaveletDenoiseMLTOptsPlane
+// with cancellation. It reports progress like
+// WaveletDenoiseMLTPlaneCtx.
+func WaveletDenoiseMLTOptsPlaneCtx(
+	ctx context.Context,
+	L *Plane,
+	sigma []float32,
+	edge Edge,
+	opts DenoiseOptions,
+	progress ProgressFunc,
+) (*Plane, error) {
 
 	levels := len(sigma)
+	if err := opts.validate(levels); err != nil {
+		return nil, err
+	}
+	total := levels + 1
+
+	// Multiscale decomposition
+	details, residual, err := opts.transformOr(AtrousWaveletPlaneCtx)(ctx, L, levels, edge, progress.withTotal(total))
+	if err != nil {
+		return nil, err
+	}
 
-	// À trous decomposition
-	details, residual := AtrousWavelet(L, levels)
+	var noise []float32
+	if opts.NoiseGains != nil {
+		noise = propagatedNoise(details, opts.NoiseGains)
+	}
 
 	// Threshold each detail layer
 	for i := 0; i < len(details); i++ {
@@ -113,16 +308,43 @@ func WaveletDenoiseMLT(
 		if t <= 0 {
 			continue
 		}
-
-		for y := range details[i] {
-			for x := range details[i][y] {
-				details[i][y][x] = softThreshold(details[i][y][x], t)
+		switch {
+		case opts.Selector != ManualThreshold:
+			n := EstimateNoiseMADPlane(details[i])
+			if noise != nil {
+				n = noise[i]
 			}
+			t = SelectThresholdPlane(details[i], n, opts.Selector)
+		case noise != nil:
+			t *= noise[i]
 		}
+
+		shrinkPlane(details[i], t, opts.shrinkage(softThreshold))
 	}
 
 	// Reconstruct
-	return AtrousReconstruct(details, residual)
+	out := AtrousReconstructPlane(details, residual)
+	progress.report(total, total)
+	return out, nil
+}
+
+// WaveletDenoiseMLT is the [][]float32 adapter for WaveletDenoiseMLTPlane
+// (clamp-to-edge).
+func WaveletDenoiseMLT(
+	L [][]float32,
+	sigma []float32,
+) [][]float32 {
+	return WaveletDenoiseMLTPlane(PlaneFromRows(L), sigma, Edge{}).Rows()
+}
+
+// WaveletDenoiseMLTOpts is the [][]float32 adapter for
+// WaveletDenoiseMLTOptsPlane (clamp-to-edge).
+func WaveletDenoiseMLTOpts(
+	L [][]float32,
+	sigma []float32,
+	opts DenoiseOptions,
+) [][]float32 {
+	return WaveletDenoiseMLTOptsPlane(PlaneFromRows(L), sigma, Edge{}, opts).Rows()
 }
 
 func min(a, b int) int {
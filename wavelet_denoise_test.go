@@ -0,0 +1,41 @@
+package goimagefreq
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestQuickMedian(t *testing.T) {
+	r := rand.New(rand.NewSource(9))
+	for _, n := range []int{1, 2, 3, 4, 5, 10, 101, 1000, 4096} {
+		for _, distinct := range []int{1, 3, 1 << 30} {
+			a := make([]float64, n)
+			for i := range a {
+				a[i] = float64(r.Intn(distinct))
+			}
+			sorted := append([]float64(nil), a...)
+			sort.Float64s(sorted)
+			want := sorted[n/2]
+			for trial := 0; trial < 5; trial++ {
+				b := append([]float64(nil), a...)
+				if got := quickMedian(b); got != want {
+					t.Fatalf("n=%d, %d distinct values: median %g, want %g", n, distinct, got, want)
+				}
+			}
+		}
+	}
+	if got := quickMedian(nil); got != 0 {
+		t.Errorf("empty slice: %g", got)
+	}
+}
+
+func TestMADPlaneIsDeterministic(t *testing.T) {
+	p := randomPlane(rand.New(rand.NewSource(10)), 37, 23)
+	want := MADPlane(p)
+	for i := 0; i < 10; i++ {
+		if got := MADPlane(p); got != want {
+			t.Fatalf("MADPlane returned %g, then %g", want, got)
+		}
+	}
+}
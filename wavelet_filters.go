@@ -0,0 +1,383 @@
+// Filter banks for the decimated wavelet transform
+package goimagefreq
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Wavelet is a two-channel filter bank for DWTPlane, in the
+// convention of PyWavelets: DecLo/DecHi analyze, RecLo/RecHi
+// synthesize, all of the same even length.
+type Wavelet struct {
+	Name         string
+	DecLo, DecHi []float64
+	RecLo, RecHi []float64
+}
+
+// Len returns the filter length.
+func (wv Wavelet) Len() int { return len(wv.DecLo) }
+
+// validate checks that the four filters are usable.
+func (wv Wavelet) validate() error {
+	l := len(wv.DecLo)
+	if l < 2 || l%2 != 0 || len(wv.DecHi) != l || len(wv.RecLo) != l || len(wv.RecHi) != l {
+		return invalidParam("wavelet %q needs four filters of one even length", wv.Name)
+	}
+	return nil
+}
+
+// orthogonalWavelet builds the filter bank of an orthogonal
+// wavelet from its scaling (reconstruction low-pass) filter.
+func orthogonalWavelet(name string, h []float64) Wavelet {
+	l := len(h)
+	wv := Wavelet{Name: name, RecLo: h}
+	wv.DecLo = make([]float64, l)
+	wv.RecHi = make([]float64, l)
+	wv.DecHi = make([]float64, l)
+	for n := 0; n < l; n++ {
+		wv.DecLo[n] = h[l-1-n]
+		wv.RecHi[n] = h[l-1-n]
+		wv.DecHi[n] = h[n]
+		if n%2 == 1 {
+			wv.RecHi[n] = -wv.RecHi[n]
+		} else {
+			wv.DecHi[n] = -wv.DecHi[n]
+		}
+	}
+	return wv
+}
+
+// biorthogonalWavelet builds the filter bank of a symmetric
+// biorthogonal wavelet from its two low-pass filters.
+func biorthogonalWavelet(name string, decLo, recLo []float64) Wavelet {
+	l := len(decLo)
+	wv := Wavelet{Name: name, DecLo: decLo, RecLo: recLo}
+	wv.DecHi = make([]float64, l)
+	wv.RecHi = make([]float64, l)
+	for n := 0; n < l; n++ {
+		wv.DecHi[n] = recLo[n]
+		wv.RecHi[n] = decLo[n]
+		if n%2 == 0 {
+			wv.DecHi[n] = -wv.DecHi[n]
+		} else {
+			wv.RecHi[n] = -wv.RecHi[n]
+		}
+	}
+	return wv
+}
+
+// Haar returns the Haar wavelet (db1).
+func Haar() Wavelet {
+	return orthogonalWavelet("haar", []float64{math.Sqrt2 / 2, math.Sqrt2 / 2})
+}
+
+// MaxDaubechiesOrder is the largest order accepted by
+// Daubechies and Symlet.
+const MaxDaubechiesOrder = 20
+
+// Daubechies returns the Daubechies wavelet dbN: the
+// minimum-phase orthogonal wavelet with n vanishing moments
+// and 2n taps, 1 ≤ n ≤ MaxDaubechiesOrder.
+func Daubechies(n int) (Wavelet, error) {
+	if n < 1 || n > MaxDaubechiesOrder {
+		return Wavelet{}, invalidParam("Daubechies order must be in [1, %d], got %d", MaxDaubechiesOrder, n)
+	}
+	return cachedWavelet("db"+strconv.Itoa(n), func() Wavelet {
+		var zs []complex128
+		for _, g := range daubechiesZeros(n) {
+			zs = append(zs, g[0]...)
+		}
+		return orthogonalWavelet("db"+strconv.Itoa(n), daubechiesFilter(n, zs))
+	}), nil
+}
+
+// Symlet returns the symlet symN: the least asymmetric
+// orthogonal wavelet with n vanishing moments and 2n taps
+// (Daubechies 1992), 2 ≤ n ≤ MaxDaubechiesOrder.
+//
+// It is selected among all spectral factorizations by the
+// deviation of its phase from linear; of the two mirror-image
+// optima the one with its reconstruction energy in the second
+// half is kept, as in the usual tables. sym2 and sym3 equal
+// db2 and db3.
+func Symlet(n int) (Wavelet, error) {
+	if n < 2 || n > MaxDaubechiesOrder {
+		return Wavelet{}, invalidParam("symlet order must be in [2, %d], got %d", MaxDaubechiesOrder, n)
+	}
+	if n <= 3 {
+		wv, err := Daubechies(n)
+		wv.Name = "sym" + strconv.Itoa(n)
+		return wv, err
+	}
+	return cachedWavelet("sym"+strconv.Itoa(n), func() Wavelet {
+		groups := daubechiesZeros(n)
+		var best []float64
+		bestDev := math.Inf(1)
+		for mask := 0; mask < 1<<len(groups); mask++ {
+			var zs []complex128
+			for i, g := range groups {
+				zs = append(zs, g[(mask>>i)&1]...)
+			}
+			h := daubechiesFilter(n, zs)
+			dev := phaseNonlinearity(h)
+			switch {
+			case dev < bestDev-1e-6:
+			case dev < bestDev+1e-6 && lateEnergy(h) && !lateEnergy(best):
+			default:
+				continue
+			}
+			best, bestDev = h, dev
+		}
+		return orthogonalWavelet("sym"+strconv.Itoa(n), best)
+	}), nil
+}
+
+// CDF53 returns the Cohen-Daubechies-Feauveau 5/3 (LeGall)
+// biorthogonal wavelet of lossless JPEG 2000 (bior2.2).
+func CDF53() Wavelet {
+	s := math.Sqrt2
+	return biorthogonalWavelet("cdf53",
+		[]float64{0, -s / 8, s / 4, 3 * s / 4, s / 4, -s / 8},
+		[]float64{0, s / 4, s / 2, s / 4, 0, 0},
+	)
+}
+
+// CDF97 returns the Cohen-Daubechies-Feauveau 9/7
+// biorthogonal wavelet of lossy JPEG 2000 (bior4.4).
+func CDF97() Wavelet {
+	s := math.Sqrt2
+	a := []float64{0.6029490182363579, 0.2668641184428723, -0.07822326652898785, -0.01686411844287495, 0.02674875741080976}
+	b := []float64{0.5575435262285023, 0.2956358815571235, -0.02877176311425092, -0.04563588155712431}
+	return biorthogonalWavelet("cdf97",
+		[]float64{0, s * a[4], s * a[3], s * a[2], s * a[1], s * a[0], s * a[1], s * a[2], s * a[3], s * a[4]},
+		[]float64{0, s * b[3], s * b[2], s * b[1], s * b[0], s * b[1], s * b[2], s * b[3], 0, 0},
+	)
+}
+
+// ParseWavelet returns the wavelet named "haar", "dbN",
+// "symN", "cdf53" (or "bior2.2") or "cdf97" (or "bior4.4").
+func ParseWavelet(name string) (Wavelet, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch name {
+	case "haar":
+		return Haar(), nil
+	case "cdf53", "bior2.2":
+		return CDF53(), nil
+	case "cdf97", "bior4.4":
+		return CDF97(), nil
+	}
+	for prefix, fn := range map[string]func(int) (Wavelet, error){"db": Daubechies, "sym": Symlet} {
+		if rest, ok := strings.CutPrefix(name, prefix); ok {
+			if n, err := strconv.Atoi(rest); err == nil {
+				return fn(n)
+			}
+		}
+	}
+	return Wavelet{}, fmt.Errorf("unknown wavelet %q", name)
+}
+
+var (
+	waveletsMu sync.Mutex
+	wavelets   = map[string]Wavelet{}
+)
+
+// cachedWavelet returns the wavelet cached under name,
+// building it on first use.
+func cachedWavelet(name string, build func() Wavelet) Wavelet {
+	waveletsMu.Lock()
+	wv, ok := wavelets[name]
+	waveletsMu.Unlock()
+	if ok {
+		return wv
+	}
+
+	wv = build()
+
+	waveletsMu.Lock()
+	wavelets[name] = wv
+	waveletsMu.Unlock()
+	return wv
+}
+
+// daubechiesZeros returns the zeros of the Daubechies
+// factor Q(z) of order n, grouped so that each group keeps
+// the filter real: [0] holds zeros inside the unit circle,
+// [1] their reciprocals.
+//
+// |Q|² is P(y) = Σ C(n-1+k, k) yᵏ with y = (2 - z - 1/z)/4,
+// so each root y of P gives a pair z, 1/z.
+func daubechiesZeros(n int) [][2][]complex128 {
+	coef := make([]float64, n)
+	for k := range coef {
+		coef[k] = binomial(n-1+k, k)
+	}
+	var groups [][2][]complex128
+	for _, y := range polyRoots(coef) {
+		if math.Abs(imag(y)) < 1e-9 {
+			y = complex(real(y), 0)
+		} else if imag(y) < 0 {
+			continue // taken with its conjugate
+		}
+		b := 2 - 4*y
+		d := cmplx.Sqrt(b*b - 4)
+		in, out := (b-d)/2, (b+d)/2
+		if cmplx.Abs(in) > cmplx.Abs(out) {
+			in, out = out, in
+		}
+		if imag(y) == 0 {
+			groups = append(groups, [2][]complex128{{in}, {out}})
+		} else {
+			groups = append(groups, [2][]complex128{{in, cmplx.Conj(in)}, {out, cmplx.Conj(out)}})
+		}
+	}
+	return groups
+}
+
+// daubechiesFilter expands (1 + 1/z)ⁿ Π (1 - zₖ/z) and
+// normalizes it to sum √2.
+func daubechiesFilter(n int, zeros []complex128) []float64 {
+	p := []complex128{1}
+	mul := func(r complex128) {
+		q := make([]complex128, len(p)+1)
+		for i, v := range p {
+			q[i] += v
+			q[i+1] -= v * r
+		}
+		p = q
+	}
+	for i := 0; i < n; i++ {
+		mul(-1)
+	}
+	for _, z := range zeros {
+		mul(z)
+	}
+	h := make([]float64, len(p))
+	sum := 0.0
+	for i, v := range p {
+		h[i] = real(v)
+		sum += h[i]
+	}
+	for i := range h {
+		h[i] *= math.Sqrt2 / sum
+	}
+	return h
+}
+
+// phaseNonlinearity returns the largest deviation of the
+// unwrapped phase of h from its least-squares linear fit
+// over (0, π).
+func phaseNonlinearity(h []float64) float64 {
+	const m = 256
+	omega := make([]float64, m)
+	phase := make([]float64, m)
+	offset := 0.0
+	for i := range phase {
+		w := math.Pi * (float64(i) + 0.5) / m * 0.999 // H(π) = 0
+		var resp complex128
+		for n, v := range h {
+			resp += complex(v, 0) * cmplx.Rect(1, -w*float64(n))
+		}
+		a := cmplx.Phase(resp) + offset
+		if i > 0 {
+			for a-phase[i-1] > math.Pi {
+				a -= 2 * math.Pi
+				offset -= 2 * math.Pi
+			}
+			for a-phase[i-1] < -math.Pi {
+				a += 2 * math.Pi
+				offset += 2 * math.Pi
+			}
+		}
+		omega[i], phase[i] = w, a
+	}
+
+	var sx, sy, sxx, sxy float64
+	for i := range phase {
+		sx += omega[i]
+		sy += phase[i]
+		sxx += omega[i] * omega[i]
+		sxy += omega[i] * phase[i]
+	}
+	slope := (m*sxy - sx*sy) / (m*sxx - sx*sx)
+	icept := (sy - slope*sx) / m
+	dev := 0.0
+	for i := range phase {
+		dev = math.Max(dev, math.Abs(phase[i]-slope*omega[i]-icept))
+	}
+	return dev
+}
+
+// lateEnergy reports whether the energy centroid of h lies
+// in its second half.
+func lateEnergy(h []float64) bool {
+	var e, c float64
+	for n, v := range h {
+		e += v * v
+		c += float64(n) * v * v
+	}
+	return c/e > float64(len(h)-1)/2
+}
+
+// polyRoots returns the roots of Σ c[k] xᵏ (Durand-Kerner,
+// then Newton polishing).
+func polyRoots(c []float64) []complex128 {
+	n := len(c) - 1
+	a := make([]complex128, n+1)
+	for i := range c {
+		a[i] = complex(c[i]/c[n], 0)
+	}
+	eval := func(x complex128) (p, dp complex128) {
+		for k := n; k >= 0; k-- {
+			dp = dp*x + p
+			p = p*x + a[k]
+		}
+		return p, dp
+	}
+
+	z := make([]complex128, n)
+	for i := range z {
+		z[i] = cmplx.Pow(complex(0.4, 0.9), complex(float64(i), 0))
+	}
+	for iter := 0; iter < 1000; iter++ {
+		moved := 0.0
+		for i := range z {
+			p, _ := eval(z[i])
+			den := complex(1, 0)
+			for j := range z {
+				if j != i {
+					den *= z[i] - z[j]
+				}
+			}
+			step := p / den
+			z[i] -= step
+			moved = math.Max(moved, cmplx.Abs(step))
+		}
+		if moved < 1e-15 {
+			break
+		}
+	}
+	for i := range z {
+		for iter := 0; iter < 3; iter++ {
+			p, dp := eval(z[i])
+			if dp == 0 {
+				break
+			}
+			z[i] -= p / dp
+		}
+	}
+	return z
+}
+
+// binomial returns C(n, k).
+func binomial(n, k int) float64 {
+	r := 1.0
+	for i := 1; i <= k; i++ {
+		r = r * float64(n-k+i) / float64(i)
+	}
+	return r
+}
@@ -0,0 +1,605 @@
+// XISF (PixInsight) image reader and writer
+package goimagefreq
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const xisfSignature = "XISF0100"
+
+// XISFCompression selects the block codec used by WriteXISF.
+type XISFCompression int
+
+const (
+	XISFUncompressed XISFCompression = iota
+	XISFZlib
+	XISFLZ4
+)
+
+// XISFProperty is a scalar or string XISF property.
+// Value holds the serialized value (the text content for
+// String properties, the value attribute otherwise).
+type XISFProperty struct {
+	ID    string
+	Type  string
+	Value string
+}
+
+// XISFImage is the first image of a monolithic XISF file.
+//
+// Planes are normalized like the rest of the package:
+// floating-point samples are read as stored (PixInsight keeps
+// them in [0,1]) and unsigned integers are scaled by
+// 1/max, e.g. UInt16 65535 → 1.0.
+type XISFImage struct {
+	Planes       []*Plane
+	ColorSpace   string // "Gray" or "RGB"
+	SampleFormat string // as stored: "Float32", "UInt16", ...
+	FITSKeywords FITSHeader
+	Properties   []XISFProperty
+}
+
+// XISFOptions controls WriteXISF.
+type XISFOptions struct {
+	// SampleFormat is "Float32" (default) or "UInt16".
+	// UInt16 clips samples to [0,1]; Float32 stores them as
+	// is, with their actual range as the image bounds.
+	SampleFormat string
+	Compression  XISFCompression
+	// Shuffle enables byte shuffling before compression,
+	// which usually improves the ratio on sample data.
+	Shuffle bool
+}
+
+// XISFImageFromRGB wraps an RGBImage for writing.
+func XISFImageFromRGB(img RGBImage) *XISFImage {
+	r, g, b := img.Planes()
+	return &XISFImage{Planes: []*Plane{r, g, b}, ColorSpace: "RGB"}
+}
+
+// Gray returns the first plane.
+func (x *XISFImage) Gray() *Plane {
+	return x.Planes[0]
+}
+
+// RGB returns the image as an RGBImage. It fails unless the
+// image has exactly three planes.
+func (x *XISFImage) RGB() (RGBImage, error) {
+	if len(x.Planes) != 3 {
+		return RGBImage{}, fmt.Errorf("xisf: RGB needs 3 channels, have %d", len(x.Planes))
+	}
+	return RGBImageFromPlanes(x.Planes[0], x.Planes[1], x.Planes[2]), nil
+}
+
+// Property returns the value of the property with the given id.
+func (x *XISFImage) Property(id string) (string, bool) {
+	for _, p := range x.Properties {
+		if p.ID == id {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+type xisfDoc struct {
+	XMLName  xml.Name       `xml:"xisf"`
+	Version  string         `xml:"version,attr"`
+	Xmlns    string         `xml:"xmlns,attr,omitempty"`
+	Images   []xisfImageXML `xml:"Image"`
+	Metadata *xisfMetadata  `xml:"Metadata"`
+}
+
+type xisfMetadata struct {
+	Properties []xisfPropertyXML `xml:"Property"`
+}
+
+type xisfImageXML struct {
+	Geometry     string            `xml:"geometry,attr"`
+	SampleFormat string            `xml:"sampleFormat,attr"`
+	Bounds       string            `xml:"bounds,attr,omitempty"`
+	ColorSpace   string            `xml:"colorSpace,attr,omitempty"`
+	PixelStorage string            `xml:"pixelStorage,attr,omitempty"`
+	ByteOrder    string            `xml:"byteOrder,attr,omitempty"`
+	Location     string            `xml:"location,attr"`
+	Compression  string            `xml:"compression,attr,omitempty"`
+	Subblocks    string            `xml:"subblocks,attr,omitempty"`
+	Keywords     []xisfKeywordXML  `xml:"FITSKeyword"`
+	Properties   []xisfPropertyXML `xml:"Property"`
+}
+
+type xisfKeywordXML struct {
+	Name    string `xml:"name,attr"`
+	Value   string `xml:"value,attr"`
+	Comment string `xml:"comment,attr"`
+}
+
+type xisfPropertyXML struct {
+	ID    string `xml:"id,attr"`
+	Type  string `xml:"type,attr"`
+	Value string `xml:"value,attr,omitempty"`
+	Text  string `xml:",chardata"`
+}
+
+// LoadXISF reads an XISF file from disk.
+func LoadXISF(path string) (*XISFImage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadXISF(f)
+}
+
+// ReadXISF decodes the first image of a monolithic XISF file.
+//
+// Attached data blocks may be uncompressed or compressed with
+// zlib, lz4 or lz4hc, optionally byte-shuffled and split into
+// sub-blocks. Sample formats UInt8/16/32 and Float32/64 are
+// accepted, in planar or normal pixel storage.
+func ReadXISF(r io.ReaderAt) (*XISFImage, error) {
+	var pre [16]byte
+	if _, err := r.ReadAt(pre[:], 0); err != nil {
+		return nil, fmt.Errorf("xisf: reading signature: %w", err)
+	}
+	if string(pre[:8]) != xisfSignature {
+		return nil, fmt.Errorf("xisf: bad signature %q", pre[:8])
+	}
+	hlen := binary.LittleEndian.Uint32(pre[8:12])
+	if !readerAtHas(r, 16, int64(hlen)) {
+		return nil, fmt.Errorf("xisf: %w: header of %d bytes exceeds the file", io.ErrUnexpectedEOF, hlen)
+	}
+	hdr := make([]byte, hlen)
+	if _, err := r.ReadAt(hdr, 16); err != nil {
+		return nil, fmt.Errorf("xisf: reading header: %w", err)
+	}
+
+	var doc xisfDoc
+	if err := xml.Unmarshal(bytes.TrimRight(hdr, "\x00"), &doc); err != nil {
+		return nil, fmt.Errorf("xisf: parsing header: %w", err)
+	}
+	if len(doc.Images) == 0 {
+		return nil, fmt.Errorf("xisf: no image in file")
+	}
+	im := doc.Images[0]
+
+	w, h, nc, err := parseXISFGeometry(im.Geometry)
+	if err != nil {
+		return nil, err
+	}
+	sampleSize, err := xisfSampleSize(im.SampleFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	size, ok := mulDims(w, h, nc, sampleSize)
+	if _, ok4 := mulDims(w, h, nc, 4); !ok || !ok4 {
+		return nil, fmt.Errorf("xisf: %s %s image is too large", im.Geometry, im.SampleFormat)
+	}
+	raw, err := readXISFBlock(r, im.Location, im.Compression, im.Subblocks, size)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &XISFImage{
+		ColorSpace:   im.ColorSpace,
+		SampleFormat: im.SampleFormat,
+	}
+	if out.ColorSpace == "" {
+		out.ColorSpace = "Gray"
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if im.ByteOrder == "big" {
+		order = binary.BigEndian
+	}
+	normal := im.PixelStorage == "Normal"
+
+	for c := 0; c < nc; c++ {
+		p := NewPlane(w, h)
+		parallelRows(h, func(y int) {
+			row := p.Row(y)
+			for x := range row {
+				idx := (c*h+y)*w + x
+				if normal {
+					idx = (y*w+x)*nc + c
+				}
+				row[x] = decodeXISFSample(raw[idx*sampleSize:], im.SampleFormat, order)
+			}
+		})
+		out.Planes = append(out.Planes, p)
+	}
+
+	for _, k := range im.Keywords {
+		out.FITSKeywords.Cards = append(out.FITSKeywords.Cards,
+			FITSCard{Key: k.Name, Value: k.Value, Comment: k.Comment})
+	}
+	for _, p := range im.Properties {
+		v := p.Value
+		if v == "" {
+			v = p.Text
+		}
+		out.Properties = append(out.Properties, XISFProperty{ID: p.ID, Type: p.Type, Value: v})
+	}
+
+	return out, nil
+}
+
+func parseXISFGeometry(g string) (w, h, c int, err error) {
+	parts := strings.Split(g, ":")
+	if len(parts) != 3 {
+		return 0, 0, 0, fmt.Errorf("xisf: unsupported geometry %q", g)
+	}
+	dims := make([]int, 3)
+	for i, s := range parts {
+		dims[i], err = strconv.Atoi(s)
+		if err != nil || dims[i] <= 0 {
+			return 0, 0, 0, fmt.Errorf("xisf: invalid geometry %q", g)
+		}
+	}
+	return dims[0], dims[1], dims[2], nil
+}
+
+func xisfSampleSize(format string) (int, error) {
+	switch format {
+	case "UInt8":
+		return 1, nil
+	case "UInt16":
+		return 2, nil
+	case "UInt32", "Float32":
+		return 4, nil
+	case "Float64":
+		return 8, nil
+	}
+	return 0, fmt.Errorf("xisf: unsupported sample format %q", format)
+}
+
+func decodeXISFSample(b []byte, format string, order binary.ByteOrder) float32 {
+	switch format {
+	case "UInt8":
+		return float32(b[0]) / math.MaxUint8
+	case "UInt16":
+		return float32(order.Uint16(b)) / math.MaxUint16
+	case "UInt32":
+		return float32(float64(order.Uint32(b)) / math.MaxUint32)
+	case "Float32":
+		return math.Float32frombits(order.Uint32(b))
+	default:
+		return float32(math.Float64frombits(order.Uint64(b)))
+	}
+}
+
+// readXISFBlock reads and decompresses an attached block,
+// which must hold exactly want bytes of sample data. Sizes
+// are checked against want and the file before anything is
+// allocated.
+func readXISFBlock(r io.ReaderAt, location, compression, subblocks string, want int) ([]byte, error) {
+	loc := strings.Split(location, ":")
+	if len(loc) != 3 || loc[0] != "attachment" {
+		return nil, fmt.Errorf("xisf: unsupported data location %q", location)
+	}
+	pos, err1 := strconv.ParseInt(loc[1], 10, 64)
+	size, err2 := strconv.ParseInt(loc[2], 10, 64)
+	if err1 != nil || err2 != nil || pos < 0 || size < 0 {
+		return nil, fmt.Errorf("xisf: invalid data location %q", location)
+	}
+	if compression == "" && size != int64(want) {
+		return nil, fmt.Errorf("xisf: data block is %d bytes, want %d", size, want)
+	}
+	if !readerAtHas(r, pos, size) {
+		return nil, fmt.Errorf("xisf: %w: data block at %d of %d bytes exceeds the file", io.ErrUnexpectedEOF, pos, size)
+	}
+	data := make([]byte, size)
+	if _, err := r.ReadAt(data, pos); err != nil {
+		return nil, fmt.Errorf("xisf: reading data block: %w", err)
+	}
+	if compression == "" {
+		return data, nil
+	}
+
+	// codec:uncompressed-size[:item-size]
+	cp := strings.Split(compression, ":")
+	if len(cp) < 2 {
+		return nil, fmt.Errorf("xisf: invalid compression %q", compression)
+	}
+	codec := cp[0]
+	usize, err := strconv.Atoi(cp[1])
+	if err != nil {
+		return nil, fmt.Errorf("xisf: invalid compression %q", compression)
+	}
+	if usize != want {
+		return nil, fmt.Errorf("xisf: uncompressed size is %d bytes, want %d", usize, want)
+	}
+	shuffled := strings.HasSuffix(codec, "+sh")
+	codec = strings.TrimSuffix(codec, "+sh")
+	itemSize := 1
+	if shuffled && len(cp) > 2 {
+		itemSize, _ = strconv.Atoi(cp[2])
+	}
+
+	// sub-blocks: "csize,usize:csize,usize:..."
+	type span struct{ c, u int }
+	blocks := []span{{len(data), usize}}
+	if subblocks != "" {
+		blocks = blocks[:0]
+		total := 0
+		for _, sb := range strings.Split(subblocks, ":") {
+			var s span
+			if _, err := fmt.Sscanf(sb, "%d,%d", &s.c, &s.u); err != nil {
+				return nil, fmt.Errorf("xisf: invalid subblocks %q", subblocks)
+			}
+			if s.c < 0 || s.u < 0 || s.u > usize-total {
+				return nil, fmt.Errorf("xisf: invalid subblocks %q", subblocks)
+			}
+			total += s.u
+			blocks = append(blocks, s)
+		}
+	}
+
+	out := make([]byte, 0, usize)
+	off := 0
+	for _, b := range blocks {
+		if off+b.c > len(data) {
+			return nil, fmt.Errorf("xisf: sub-block exceeds data block")
+		}
+		chunk := data[off : off+b.c]
+		off += b.c
+
+		var dec []byte
+		switch codec {
+		case "zlib":
+			zr, err := zlib.NewReader(bytes.NewReader(chunk))
+			if err != nil {
+				return nil, fmt.Errorf("xisf: zlib: %w", err)
+			}
+			// Read one byte past the declared size so an
+			// oversized stream is caught without inflating it.
+			dec, err = io.ReadAll(io.LimitReader(zr, int64(b.u)+1))
+			if err != nil {
+				return nil, fmt.Errorf("xisf: zlib: %w", err)
+			}
+		case "lz4", "lz4hc":
+			dec, err = lz4Decompress(chunk, b.u)
+			if err != nil {
+				return nil, fmt.Errorf("xisf: %w", err)
+			}
+		default:
+			return nil, fmt.Errorf("xisf: unsupported codec %q", codec)
+		}
+		if len(dec) != b.u {
+			return nil, fmt.Errorf("xisf: sub-block decompressed to %d bytes, want %d", len(dec), b.u)
+		}
+		out = append(out, dec...)
+	}
+
+	if len(out) != usize {
+		return nil, fmt.Errorf("xisf: decompressed %d bytes, want %d", len(out), usize)
+	}
+	if shuffled {
+		out = unshuffleBytes(out, itemSize)
+	}
+	return out, nil
+}
+
+// xisfBounds returns the "low:high" range of the finite
+// samples of planes, widened to include 0 and 1 when it
+// would otherwise be empty, as XISF requires low < high.
+func xisfBounds(planes []*Plane) string {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, p := range planes {
+		for y := 0; y < p.H; y++ {
+			for _, v := range p.Row(y) {
+				f := float64(v)
+				if math.IsNaN(f) || math.IsInf(f, 0) {
+					continue
+				}
+				lo, hi = math.Min(lo, f), math.Max(hi, f)
+			}
+		}
+	}
+	if !(lo < hi) {
+		lo, hi = math.Min(lo, 0), math.Max(hi, 1)
+	}
+	return strconv.FormatFloat(lo, 'g', -1, 32) + ":" + strconv.FormatFloat(hi, 'g', -1, 32)
+}
+
+// readerAtHas reports whether r holds n bytes from off on,
+// by reading the last of them.
+func readerAtHas(r io.ReaderAt, off, n int64) bool {
+	if off < 0 || n < 0 || off > math.MaxInt64-n {
+		return false
+	}
+	if n == 0 {
+		return true
+	}
+	var b [1]byte
+	_, err := r.ReadAt(b[:], off+n-1)
+	return err == nil
+}
+
+// shuffleBytes groups byte k of every item together, which
+// makes sample data far more compressible.
+func shuffleBytes(src []byte, itemSize int) []byte {
+	if itemSize <= 1 {
+		return src
+	}
+	n := len(src) / itemSize
+	dst := make([]byte, len(src))
+	for k := 0; k < itemSize; k++ {
+		for i := 0; i < n; i++ {
+			dst[k*n+i] = src[i*itemSize+k]
+		}
+	}
+	copy(dst[n*itemSize:], src[n*itemSize:])
+	return dst
+}
+
+func unshuffleBytes(src []byte, itemSize int) []byte {
+	if itemSize <= 1 {
+		return src
+	}
+	n := len(src) / itemSize
+	dst := make([]byte, len(src))
+	for k := 0; k < itemSize; k++ {
+		for i := 0; i < n; i++ {
+			dst[i*itemSize+k] = src[k*n+i]
+		}
+	}
+	copy(dst[n*itemSize:], src[n*itemSize:])
+	return dst
+}
+
+// SaveXISF writes img to path.
+func SaveXISF(path string, img *XISFImage, opts XISFOptions) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteXISF(f, img, opts); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteXISF encodes img as a monolithic XISF file with a
+// single attached, planar, little-endian data block.
+func WriteXISF(w io.Writer, img *XISFImage, opts XISFOptions) error {
+	if len(img.Planes) == 0 {
+		return fmt.Errorf("xisf: no planes to write: %w", ErrEmptyImage)
+	}
+	pw, ph := img.Planes[0].W, img.Planes[0].H
+	for _, p := range img.Planes {
+		if p.W != pw || p.H != ph {
+			return fmt.Errorf("xisf: planes differ in size: %w", ErrDimensionMismatch)
+		}
+	}
+	format := opts.SampleFormat
+	if format == "" {
+		format = "Float32"
+	}
+	if format != "Float32" && format != "UInt16" {
+		return fmt.Errorf("xisf: unsupported output sample format %q", format)
+	}
+	sampleSize, _ := xisfSampleSize(format)
+
+	// planar sample data
+	raw := make([]byte, pw*ph*len(img.Planes)*sampleSize)
+	for c, p := range img.Planes {
+		parallelRows(ph, func(y int) {
+			off := ((c*ph + y) * pw) * sampleSize
+			for x, v := range p.Row(y) {
+				b := raw[off+x*sampleSize:]
+				if format == "UInt16" {
+					v = float32(math.Max(0, math.Min(1, float64(v))))
+					binary.LittleEndian.PutUint16(b, uint16(math.Round(float64(v)*math.MaxUint16)))
+				} else {
+					binary.LittleEndian.PutUint32(b, math.Float32bits(v))
+				}
+			}
+		})
+	}
+
+	block := raw
+	compression := ""
+	if opts.Compression != XISFUncompressed {
+		src := raw
+		codec := "zlib"
+		if opts.Compression == XISFLZ4 {
+			codec = "lz4"
+		}
+		if opts.Shuffle {
+			src = shuffleBytes(raw, sampleSize)
+			codec += "+sh"
+		}
+		if opts.Compression == XISFLZ4 {
+			block = lz4Compress(src)
+		} else {
+			var buf bytes.Buffer
+			zw := zlib.NewWriter(&buf)
+			zw.Write(src)
+			zw.Close()
+			block = buf.Bytes()
+		}
+		compression = fmt.Sprintf("%s:%d", codec, len(raw))
+		if opts.Shuffle {
+			compression += fmt.Sprintf(":%d", sampleSize)
+		}
+	}
+
+	colorSpace := img.ColorSpace
+	if colorSpace == "" {
+		colorSpace = "Gray"
+		if len(img.Planes) == 3 {
+			colorSpace = "RGB"
+		}
+	}
+
+	im := xisfImageXML{
+		Geometry:     fmt.Sprintf("%d:%d:%d", pw, ph, len(img.Planes)),
+		SampleFormat: format,
+		ColorSpace:   colorSpace,
+		Compression:  compression,
+	}
+	if format == "Float32" {
+		im.Bounds = xisfBounds(img.Planes)
+	}
+	for _, c := range img.FITSKeywords.Cards {
+		im.Keywords = append(im.Keywords, xisfKeywordXML{Name: c.Key, Value: c.Value, Comment: c.Comment})
+	}
+	for _, p := range img.Properties {
+		px := xisfPropertyXML{ID: p.ID, Type: p.Type}
+		if p.Type == "String" {
+			px.Text = p.Value
+		} else {
+			px.Value = p.Value
+		}
+		im.Properties = append(im.Properties, px)
+	}
+
+	doc := xisfDoc{
+		Version: "1.0",
+		Xmlns:   "http://www.pixinsight.com/xisf",
+		Metadata: &xisfMetadata{Properties: []xisfPropertyXML{
+			{ID: "XISF:CreationTime", Type: "TimePoint", Value: time.Now().UTC().Format(time.RFC3339)},
+			{ID: "XISF:CreatorApplication", Type: "String", Text: "goimagefreq"},
+		}},
+	}
+
+	// The block position depends on the header length, which
+	// depends on the position: iterate until it is stable.
+	var hdr []byte
+	pos := 0
+	for {
+		im.Location = fmt.Sprintf("attachment:%d:%d", pos, len(block))
+		doc.Images = []xisfImageXML{im}
+		body, err := xml.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("xisf: encoding header: %w", err)
+		}
+		hdr = append([]byte(xml.Header), body...)
+		next := 16 + len(hdr)
+		if next == pos {
+			break
+		}
+		pos = next
+	}
+
+	var pre [16]byte
+	copy(pre[:], xisfSignature)
+	binary.LittleEndian.PutUint32(pre[8:], uint32(len(hdr)))
+	for _, b := range [][]byte{pre[:], hdr, block} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
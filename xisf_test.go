@@ -0,0 +1,228 @@
+package goimagefreq
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestXISFRoundTrip(t *testing.T) {
+	for _, format := range []string{"Float32", "UInt16"} {
+		for _, comp := range []XISFCompression{XISFUncompressed, XISFZlib, XISFLZ4} {
+			for _, shuffle := range []bool{false, true} {
+				if comp == XISFUncompressed && shuffle {
+					continue
+				}
+				for _, depth := range []int{1, 3} {
+					opts := XISFOptions{SampleFormat: format, Compression: comp, Shuffle: shuffle}
+					name := fmt.Sprintf("%s compression %d shuffle %v depth %d", format, comp, shuffle, depth)
+					testXISFRoundTrip(t, name, depth, opts)
+				}
+			}
+		}
+	}
+}
+
+func testXISFRoundTrip(t *testing.T, name string, depth int, opts XISFOptions) {
+	img := &XISFImage{}
+	for c := 0; c < depth; c++ {
+		p := NewPlane(19, 11)
+		for i := range p.Data {
+			p.Data[i] = float32((i*37+c*11)%65536) / math.MaxUint16
+		}
+		img.Planes = append(img.Planes, p)
+	}
+	img.FITSKeywords.Set("EXPTIME", 120.0, "seconds")
+	img.Properties = []XISFProperty{{ID: "Observation:Object:Name", Type: "String", Value: "M 42"}}
+
+	var buf bytes.Buffer
+	if err := WriteXISF(&buf, img, opts); err != nil {
+		t.Fatalf("%s: WriteXISF: %v", name, err)
+	}
+	got, err := ReadXISF(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("%s: ReadXISF: %v", name, err)
+	}
+	if got.SampleFormat != opts.SampleFormat {
+		t.Errorf("%s: sample format %q", name, got.SampleFormat)
+	}
+	if len(got.Planes) != depth {
+		t.Fatalf("%s: read %d planes", name, len(got.Planes))
+	}
+	// UInt16 samples on the 1/65535 grid survive exactly up
+	// to float32 rounding.
+	for c, p := range got.Planes {
+		if p.W != 19 || p.H != 11 {
+			t.Fatalf("%s: plane %d is %dx%d", name, c, p.W, p.H)
+		}
+		if err := MaxAbsErrorPlane(p, img.Planes[c]); err > 1e-7 {
+			t.Errorf("%s: plane %d differs by %g", name, c, err)
+		}
+	}
+	if v, _ := got.FITSKeywords.Float("EXPTIME"); v != 120 {
+		t.Errorf("%s: EXPTIME = %g", name, v)
+	}
+	if v, _ := got.Property("Observation:Object:Name"); v != "M 42" {
+		t.Errorf("%s: object name = %q", name, v)
+	}
+}
+
+// xisfTestFile builds a monolithic XISF file around im with
+// block stored at offset 4096. An empty im.Location points
+// at block.
+func xisfTestFile(im xisfImageXML, block []byte) []byte {
+	const pos = 4096
+	if im.Location == "" {
+		im.Location = fmt.Sprintf("attachment:%d:%d", pos, len(block))
+	}
+	body, err := xml.Marshal(xisfDoc{Version: "1.0", Images: []xisfImageXML{im}})
+	if err != nil {
+		panic(err)
+	}
+	file := make([]byte, pos, pos+len(block))
+	copy(file, xisfSignature)
+	binary.LittleEndian.PutUint32(file[8:], pos-16)
+	copy(file[16:], body)
+	return append(file, block...)
+}
+
+func TestXISFSubblocks(t *testing.T) {
+	raw := make([]byte, 6*4*2)
+	for i := range raw {
+		raw[i] = byte(i * 5)
+	}
+	var block []byte
+	var subblocks string
+	for i := 0; i < 2; i++ {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write(raw[i*24 : (i+1)*24])
+		zw.Close()
+		if i > 0 {
+			subblocks += ":"
+		}
+		subblocks += fmt.Sprintf("%d,%d", buf.Len(), 24)
+		block = append(block, buf.Bytes()...)
+	}
+	file := xisfTestFile(xisfImageXML{Geometry: "6:4:1", SampleFormat: "UInt16",
+		Compression: "zlib:48", Subblocks: subblocks}, block)
+	got, err := ReadXISF(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range got.Planes[0].Data {
+		want := float32(binary.LittleEndian.Uint16(raw[2*i:])) / math.MaxUint16
+		if v != want {
+			t.Fatalf("sample %d = %g, want %g", i, v, want)
+		}
+	}
+}
+
+func TestReadXISFRejectsHostileHeader(t *testing.T) {
+	var bomb bytes.Buffer
+	zw := zlib.NewWriter(&bomb)
+	zw.Write(make([]byte, 1<<20))
+	zw.Close()
+
+	tests := []struct {
+		name  string
+		im    xisfImageXML
+		block []byte
+		want  error
+	}{
+		{"huge geometry", xisfImageXML{Geometry: "65535:65535:3", SampleFormat: "Float32",
+			Location: "attachment:4096:51538034700"}, make([]byte, 64), io.ErrUnexpectedEOF},
+		{"overflow", xisfImageXML{Geometry: "4294967296:4294967296:3", SampleFormat: "Float64"}, make([]byte, 64), nil},
+		{"short block", xisfImageXML{Geometry: "8:8:1", SampleFormat: "UInt16"}, make([]byte, 100), nil},
+		{"location past EOF", xisfImageXML{Geometry: "8:8:1", SampleFormat: "UInt8",
+			Location: "attachment:1000000:64"}, make([]byte, 64), io.ErrUnexpectedEOF},
+		{"uncompressed size mismatch", xisfImageXML{Geometry: "8:8:1", SampleFormat: "UInt8",
+			Compression: "zlib:1048576"}, bomb.Bytes(), nil},
+		{"zlib bomb", xisfImageXML{Geometry: "8:8:1", SampleFormat: "UInt8",
+			Compression: "zlib:64"}, bomb.Bytes(), nil},
+		{"oversized subblocks", xisfImageXML{Geometry: "8:8:1", SampleFormat: "UInt8",
+			Compression: "lz4:64", Subblocks: "10,2000000000:10,64"}, make([]byte, 20), nil},
+	}
+	for _, tt := range tests {
+		img, err := ReadXISF(bytes.NewReader(xisfTestFile(tt.im, tt.block)))
+		if err == nil {
+			t.Errorf("%s: read a %dx%d image", tt.name, img.Planes[0].W, img.Planes[0].H)
+			continue
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// A header length beyond the file.
+	file := xisfTestFile(xisfImageXML{Geometry: "1:1:1", SampleFormat: "UInt8"}, []byte{0})
+	binary.LittleEndian.PutUint32(file[8:], math.MaxUint32)
+	if _, err := ReadXISF(bytes.NewReader(file)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("huge header: got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestLoadXISFShortFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "short.xisf")
+	file := xisfTestFile(xisfImageXML{Geometry: "100:100:1", SampleFormat: "UInt8",
+		Location: "attachment:4096:10000"}, make([]byte, 50))
+	if err := os.WriteFile(path, file, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadXISF(path); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+// xisfTestHeader parses the XML header of an XISF file.
+func xisfTestHeader(t *testing.T, file []byte) xisfImageXML {
+	t.Helper()
+	hlen := binary.LittleEndian.Uint32(file[8:])
+	var doc xisfDoc
+	if err := xml.Unmarshal(bytes.TrimRight(file[16:16+hlen], "\x00"), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc.Images[0]
+}
+
+func TestWriteXISFBounds(t *testing.T) {
+	nan := float32(math.NaN())
+	tests := []struct {
+		values []float32
+		want   string
+	}{
+		{[]float32{0.25, 0.5, 0.75}, "0.25:0.75"},
+		{[]float32{-0.5, 0, 2}, "-0.5:2"},
+		{[]float32{1000, 65535, nan}, "1000:65535"},
+		{[]float32{0.5, 0.5, 0.5}, "0:1"},
+		{[]float32{3, 3, 3}, "0:3"},
+		{[]float32{nan, nan, nan}, "0:1"},
+	}
+	for _, tt := range tests {
+		p := NewPlane(3, 1)
+		copy(p.Data, tt.values)
+		var buf bytes.Buffer
+		if err := WriteXISF(&buf, &XISFImage{Planes: []*Plane{p}}, XISFOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if got := xisfTestHeader(t, buf.Bytes()).Bounds; got != tt.want {
+			t.Errorf("%v: bounds %q, want %q", tt.values, got, tt.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteXISF(&buf, &XISFImage{Planes: []*Plane{NewPlane(2, 2)}}, XISFOptions{SampleFormat: "UInt16"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := xisfTestHeader(t, buf.Bytes()).Bounds; got != "" {
+		t.Errorf("UInt16: bounds %q, want none", got)
+	}
+}